@@ -23,14 +23,14 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/status": {
+        "/job": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Get status summary from Manager",
+                "description": "Get all the jobs added by a batch or a template, without their status",
                 "consumes": [
                     "application/json"
                 ],
@@ -38,12 +38,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "status"
+                    "job"
+                ],
+                "summary": "Get all the jobs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "limit output DB",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page output DB",
+                        "name": "page",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get status summary from Manager",
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Job"
+                            }
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -60,14 +80,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/task": {
+        "/job/{ID}": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Get status of tasks",
+                "description": "Get the number of tasks by status, the progress and the outputs of the tasks of a job",
                 "consumes": [
                     "application/json"
                 ],
@@ -75,104 +95,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "task"
+                    "job"
                 ],
-                "summary": "Get all tasks",
+                "summary": "Get status of a job",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Task ID",
+                        "description": "job ID",
                         "name": "ID",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task command",
-                        "name": "command",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task files",
-                        "name": "file",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task name",
-                        "name": "name",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task createdAt",
-                        "name": "createdAt",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task updatedAt",
-                        "name": "updatedAt",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task executedAt",
-                        "name": "executedAt",
-                        "in": "query"
-                    },
-                    {
-                        "enum": [
-                            "pending",
-                            "running",
-                            "done",
-                            "failed",
-                            "deleted"
-                        ],
-                        "type": "string",
-                        "description": "Task status",
-                        "name": "status",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task workerName",
-                        "name": "workerName",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task username",
-                        "name": "username",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task priority",
-                        "name": "priority",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Task callbackURL",
-                        "name": "callbackURL",
-                        "in": "query"
+                        "in": "path",
+                        "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Task callbackToken",
-                        "name": "callbackToken",
+                        "type": "boolean",
+                        "description": "Include the outputs of the tasks (default true)",
+                        "name": "outputs",
                         "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "limit output DB",
+                        "description": "limit of tasks",
                         "name": "limit",
                         "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "page output DB",
+                        "description": "page of tasks",
                         "name": "page",
                         "in": "query"
                     }
@@ -181,10 +129,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/globalstructs.Task"
-                            }
+                            "$ref": "#/definitions/globalstructs.Job"
                         }
                     },
                     "400": {
@@ -201,13 +146,13 @@ const docTemplate = `{
                     }
                 }
             },
-            "post": {
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Add a new tasks",
+                "description": "Delete the pending and running tasks of a job, the finished tasks are kept",
                 "consumes": [
                     "application/json"
                 ],
@@ -215,25 +160,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "task"
+                    "job"
                 ],
-                "summary": "Add a new tasks",
+                "summary": "Cancel a job",
                 "parameters": [
                     {
-                        "description": "Task object to create",
-                        "name": "task",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/globalstructs.TaskSwagger"
-                        }
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/globalstructs.Task"
+                            "$ref": "#/definitions/globalstructs.Job"
                         }
                     },
                     "400": {
@@ -251,14 +194,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/task/{ID}": {
+        "/module": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Get status of a task",
+                "description": "Get the modules configured in the workers that are up and how many workers have each one",
                 "consumes": [
                     "application/json"
                 ],
@@ -266,25 +209,16 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "task"
-                ],
-                "summary": "Get status of a task",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "task ID",
-                        "name": "ID",
-                        "in": "path",
-                        "required": true
-                    }
+                    "module"
                 ],
+                "summary": "Get modules",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/globalstructs.Task"
+                                "$ref": "#/definitions/utils.StatusModule"
                             }
                         }
                     },
@@ -301,14 +235,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/queue": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Delete a tasks",
+                "description": "Get the pending and running tasks and the limits of each queue",
                 "consumes": [
                     "application/json"
                 ],
@@ -316,23 +252,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "task"
-                ],
-                "summary": "Delete a tasks",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "task ID",
-                        "name": "ID",
-                        "in": "path",
-                        "required": true
-                    }
+                    "queue"
                 ],
+                "summary": "Get queues",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/globalstructs.Task"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/utils.StatusQueue"
+                            }
                         }
                     },
                     "400": {
@@ -350,14 +280,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/worker": {
+        "/schedule": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Handle worker request",
+                "description": "Get all the schedules",
                 "consumes": [
                     "application/json"
                 ],
@@ -365,16 +295,16 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "worker"
+                    "schedule"
                 ],
-                "summary": "Get workers",
+                "summary": "Get all the schedules",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/globalstructs.Worker"
+                                "$ref": "#/definitions/globalstructs.Schedule"
                             }
                         }
                     },
@@ -398,7 +328,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Add a worker, normally done by the worker",
+                "description": "Add a task template that is added as a new task on each cron match or once at runAt",
                 "consumes": [
                     "application/json"
                 ],
@@ -406,17 +336,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "worker"
+                    "schedule"
                 ],
-                "summary": "Add a worker",
+                "summary": "Add a new schedule",
                 "parameters": [
                     {
-                        "description": "Worker object to create",
-                        "name": "worker",
+                        "description": "Schedule object to create",
+                        "name": "schedule",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/globalstructs.Worker"
+                            "$ref": "#/definitions/globalstructs.ScheduleSwagger"
                         }
                     }
                 ],
@@ -424,10 +354,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/globalstructs.Worker"
-                            }
+                            "$ref": "#/definitions/globalstructs.Schedule"
                         }
                     },
                     "400": {
@@ -445,14 +372,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/worker/{NAME}": {
+        "/schedule/{ID}": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Get status of worker",
+                "description": "Get a schedule with its next and last execution",
                 "consumes": [
                     "application/json"
                 ],
@@ -460,14 +387,14 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "worker"
+                    "schedule"
                 ],
-                "summary": "Get status of worker",
+                "summary": "Get a schedule",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Worker NAME",
-                        "name": "NAME",
+                        "description": "schedule ID",
+                        "name": "ID",
                         "in": "path",
                         "required": true
                     }
@@ -476,7 +403,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/globalstructs.Worker"
+                            "$ref": "#/definitions/globalstructs.Schedule"
                         }
                     },
                     "400": {
@@ -499,7 +426,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Remove a worker from the system",
+                "description": "Delete a schedule, the tasks already added are not deleted",
                 "consumes": [
                     "application/json"
                 ],
@@ -507,14 +434,14 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "worker"
+                    "schedule"
                 ],
-                "summary": "Remove a worker",
+                "summary": "Delete a schedule",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Worker NAME",
-                        "name": "NAME",
+                        "description": "schedule ID",
+                        "name": "ID",
                         "in": "path",
                         "required": true
                     }
@@ -523,10 +450,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/globalstructs.Schedule"
                         }
                     },
                     "400": {
@@ -543,35 +467,1253 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "globalstructs.Command": {
-            "type": "object",
-            "properties": {
-                "args": {
-                    "type": "string"
-                },
-                "module": {
-                    "type": "string"
-                },
-                "output": {
-                    "type": "string"
-                }
-            }
         },
-        "globalstructs.CommandSwagger": {
-            "type": "object",
-            "properties": {
-                "args": {
-                    "type": "string"
-                },
-                "module": {
-                    "type": "string"
+        "/status": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get status summary from Manager",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Get status summary from Manager",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
                 }
             }
         },
-        "globalstructs.Error": {
+        "/task": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get status of tasks",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Get all tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "ID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task command",
+                        "name": "command",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task files",
+                        "name": "file",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task createdAt",
+                        "name": "createdAt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task updatedAt",
+                        "name": "updatedAt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task executedAt",
+                        "name": "executedAt",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "running",
+                            "done",
+                            "failed",
+                            "cancelled",
+                            "deleted",
+                            "skipped"
+                        ],
+                        "type": "string",
+                        "description": "Task status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task workerName",
+                        "name": "workerName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task username",
+                        "name": "username",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task priority",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task timeout",
+                        "name": "timeout",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task callbackURL",
+                        "name": "callbackURL",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task callbackToken",
+                        "name": "callbackToken",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Task retries",
+                        "name": "retries",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task requires",
+                        "name": "requires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task groupID (job ID)",
+                        "name": "groupID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task queue",
+                        "name": "queue",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task rateKey",
+                        "name": "rateKey",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "done",
+                            "failed",
+                            "cancelled",
+                            "skipped"
+                        ],
+                        "type": "string",
+                        "description": "Status of a command of the task",
+                        "name": "commandStatus",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Exit code of a command of the task",
+                        "name": "exitCode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "limit output DB",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page output DB",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Task"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a new tasks",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Add a new tasks",
+                "parameters": [
+                    {
+                        "description": "Task object to create",
+                        "name": "task",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.TaskSwagger"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/batch": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add many tasks in a single transaction, the body is a JSON array of tasks or one JSON task per line (JSON Lines). If a task is invalid none is added. All the tasks share a groupID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Add many tasks",
+                "parameters": [
+                    {
+                        "description": "Tasks to create",
+                        "name": "tasks",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.TaskSwagger"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.TaskBatch"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/template": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a task for each value of the template replacing {{key}} in the args of the commands and in the name, the values are a list or a base64 file with a value per line. All the tasks share a groupID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Add the tasks of a template",
+                "parameters": [
+                    {
+                        "description": "Template to expand",
+                        "name": "template",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.TaskTemplateSwagger"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.TaskBatch"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get status of a task, with the history of its attempts",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Get status of a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Task"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Delete a task, a running task is stopped and its worker sends it back as cancelled",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Delete a tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}/artifacts": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get the files collected by the worker with the artifacts of the task, of every attempt\nor only of the attempt parameter",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Get the artifacts of a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "attempt number",
+                        "name": "attempt",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Artifact"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}/artifacts/{n}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Download the artifact n of the current attempt of a task (retries+1), or of the attempt parameter",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Download an artifact of a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "artifact number",
+                        "name": "n",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "attempt number",
+                        "name": "attempt",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "content of the artifact",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}/graph": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get the dependency graph of a task, with every task connected to it through dependsOn",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Get the dependency graph of a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.TaskGraph"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}/output/{n}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get the output of the command n (starting at 0) of a task, from the result store if it was too big\nto be saved in the database. Use attempt to get the output of a previous attempt.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Get the output of a command",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "command number",
+                        "name": "n",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "attempt number",
+                        "name": "attempt",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "output of the command",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/task/{ID}/stream": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Follow the output of a task while it runs using Server-Sent Events.\nEach \"output\" event has a globalstructs.TaskOutput, the \"end\" event is sent when the task finishes.\nUse the from parameter or the Last-Event-ID header to resume after a seq.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "task"
+                ],
+                "summary": "Follow the output of a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "task ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Send only the chunks after this seq",
+                        "name": "from",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.TaskOutput"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/token": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get all the API tokens added with the API, without the tokens, only for admins",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "token"
+                ],
+                "summary": "Get all the API tokens",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Token"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add an API token of a user or a worker, the token is only returned in this response, only for admins",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "token"
+                ],
+                "summary": "Add a new API token",
+                "parameters": [
+                    {
+                        "description": "Token object to create",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.TokenSwagger"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Token"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/{ID}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Delete an API token, the requests with it are rejected from now on, only for admins",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "token"
+                ],
+                "summary": "Delete an API token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "token ID",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Token"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/worker": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Handle worker request",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "worker"
+                ],
+                "summary": "Get workers",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Worker"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a worker, normally done by the worker",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "worker"
+                ],
+                "summary": "Add a worker",
+                "parameters": [
+                    {
+                        "description": "Worker object to create",
+                        "name": "worker",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Worker"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/globalstructs.Worker"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/worker/{NAME}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get status of worker",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "worker"
+                ],
+                "summary": "Get status of worker",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Worker NAME",
+                        "name": "NAME",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Worker"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove a worker from the system",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "worker"
+                ],
+                "summary": "Remove a worker",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Worker NAME",
+                        "name": "NAME",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/globalstructs.Error"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "globalstructs.Artifact": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "description": "attempt of the task that produced it",
+                    "type": "integer"
+                },
+                "key": {
+                    "description": "key in the result store",
+                    "type": "string"
+                },
+                "num": {
+                    "description": "position in the artifacts of the attempt, used to download it",
+                    "type": "integer"
+                },
+                "path": {
+                    "description": "path in the worker",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "globalstructs.Command": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "string"
+                },
+                "durationMs": {
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "why the command failed, e.g. limit exceeded",
+                    "type": "string"
+                },
+                "exitCode": {
+                    "description": "-1 if the command was killed by a signal or didn't start",
+                    "type": "integer"
+                },
+                "finishedAt": {
+                    "description": "RFC 3339",
+                    "type": "string"
+                },
+                "module": {
+                    "type": "string"
+                },
+                "onFailure": {
+                    "description": "abort (default), continue or skip-rest",
+                    "type": "string"
+                },
+                "output": {
+                    "description": "stdout followed by stderr, built from them when reading, not stored nor sent",
+                    "type": "string"
+                },
+                "outputKey": {
+                    "description": "key in the result store when the output is too big, Output is empty",
+                    "type": "string"
+                },
+                "outputSize": {
+                    "description": "size of the output in the result store",
+                    "type": "integer"
+                },
+                "runIf": {
+                    "description": "condition on the previous commands, e.g. commands[0].exitCode == 0",
+                    "type": "string"
+                },
+                "startedAt": {
+                    "description": "RFC 3339",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "done, failed, cancelled or skipped, empty until the task runs",
+                    "type": "string"
+                },
+                "stderr": {
+                    "description": "empty if the output is in the result store",
+                    "type": "string"
+                },
+                "stdin": {
+                    "description": "input of the command, e.g. {{commands[0].stdout}}",
+                    "type": "string"
+                },
+                "stdout": {
+                    "description": "empty if the output is in the result store",
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.CommandSwagger": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "string"
+                },
+                "module": {
+                    "type": "string"
+                },
+                "onFailure": {
+                    "description": "What to do if the command fails: abort (default), continue or skip-rest",
+                    "type": "string"
+                },
+                "runIf": {
+                    "description": "Run the command only if the condition on the previous commands is true",
+                    "type": "string"
+                },
+                "stdin": {
+                    "description": "Input of the command, can use the results of the previous commands like the args",
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.Error": {
             "type": "object",
             "properties": {
                 "error": {
@@ -590,15 +1732,178 @@ const docTemplate = `{
                 }
             }
         },
+        "globalstructs.Job": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "batch, template",
+                    "type": "string"
+                },
+                "progress": {
+                    "description": "percent of tasks finished",
+                    "type": "number"
+                },
+                "status": {
+                    "description": "number of tasks by status",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/globalstructs.JobTask"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.JobTask": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "outputs": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.Limits": {
+            "type": "object",
+            "properties": {
+                "cpuSeconds": {
+                    "description": "max CPU time",
+                    "type": "integer"
+                },
+                "memoryMB": {
+                    "description": "max memory in MiB",
+                    "type": "integer"
+                },
+                "openFiles": {
+                    "description": "max open files",
+                    "type": "integer"
+                },
+                "outputBytes": {
+                    "description": "max bytes of stdout and stderr",
+                    "type": "integer"
+                }
+            }
+        },
+        "globalstructs.Schedule": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "cron": {
+                    "description": "minute hour day-of-month month day-of-week",
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastRunAt": {
+                    "type": "string"
+                },
+                "lastTaskID": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nextRunAt": {
+                    "type": "string"
+                },
+                "runAt": {
+                    "description": "RFC3339 time to run only once",
+                    "type": "string"
+                },
+                "task": {
+                    "$ref": "#/definitions/globalstructs.Task"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.ScheduleSwagger": {
+            "type": "object",
+            "properties": {
+                "cron": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "runAt": {
+                    "type": "string"
+                },
+                "task": {
+                    "$ref": "#/definitions/globalstructs.TaskSwagger"
+                }
+            }
+        },
         "globalstructs.Task": {
             "type": "object",
             "properties": {
+                "artifactFiles": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/globalstructs.Artifact"
+                    }
+                },
+                "artifacts": {
+                    "description": "glob paths of the files collected by the worker after the execution",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/globalstructs.TaskAttempt"
+                    }
+                },
                 "callbackToken": {
                     "type": "string"
                 },
                 "callbackURL": {
                     "type": "string"
                 },
+                "cancelGraceSeconds": {
+                    "description": "seconds between SIGTERM and SIGKILL when the task is cancelled",
+                    "type": "integer"
+                },
+                "cancelRequested": {
+                    "description": "deleted by the user while running, it runs until the worker stops it",
+                    "type": "boolean"
+                },
                 "commands": {
                     "type": "array",
                     "items": {
@@ -608,6 +1913,16 @@ const docTemplate = `{
                 "createdAt": {
                     "type": "string"
                 },
+                "dependsOn": {
+                    "description": "IDs of the tasks that must be done before this one",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "duration": {
+                    "type": "number"
+                },
                 "executedAt": {
                     "type": "string"
                 },
@@ -617,9 +1932,24 @@ const docTemplate = `{
                         "$ref": "#/definitions/globalstructs.File"
                     }
                 },
+                "groupID": {
+                    "description": "ID shared by the tasks added by the same batch or template",
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
+                "limits": {
+                    "description": "resources of each command",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/globalstructs.Limits"
+                        }
+                    ]
+                },
+                "maxRetries": {
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -629,8 +1959,27 @@ const docTemplate = `{
                 "priority": {
                     "type": "integer"
                 },
+                "queue": {
+                    "description": "queue of the manager config, default if empty",
+                    "type": "string"
+                },
+                "rateKey": {
+                    "description": "key of the rate limits of the manager config, e.g. the target host",
+                    "type": "string"
+                },
+                "requires": {
+                    "description": "label selector of the workers that can run the task, e.g. \"region=eu,has-nmap,gpu!=true\"",
+                    "type": "string"
+                },
+                "retries": {
+                    "type": "integer"
+                },
+                "retryBackoffSeconds": {
+                    "description": "seconds before the first retry, doubled after each attempt",
+                    "type": "integer"
+                },
                 "status": {
-                    "description": "pending, running, done, failed, deleted",
+                    "description": "pending, running, done, failed, deleted, skipped, cancelled",
                     "type": "string"
                 },
                 "timeout": {
@@ -648,21 +1997,119 @@ const docTemplate = `{
                 }
             }
         },
+        "globalstructs.TaskAttempt": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "commands": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/globalstructs.Command"
+                    }
+                },
+                "duration": {
+                    "type": "number"
+                },
+                "executedAt": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "workerName": {
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.TaskBatch": {
+            "type": "object",
+            "properties": {
+                "groupID": {
+                    "type": "string"
+                },
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "globalstructs.TaskOutput": {
+            "type": "object",
+            "properties": {
+                "command": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "data": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "task ID",
+                    "type": "string"
+                },
+                "seq": {
+                    "description": "set by the manager, increases with each chunk",
+                    "type": "integer"
+                },
+                "stream": {
+                    "description": "stdout or stderr",
+                    "type": "string"
+                }
+            }
+        },
         "globalstructs.TaskSwagger": {
             "type": "object",
             "properties": {
+                "artifacts": {
+                    "description": "Glob paths of the files collected by the worker after the execution",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "cancelGraceSeconds": {
+                    "description": "Seconds between SIGTERM and SIGKILL when the task is cancelled",
+                    "type": "integer"
+                },
                 "commands": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/globalstructs.CommandSwagger"
                     }
                 },
+                "dependsOn": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "files": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/globalstructs.File"
                     }
                 },
+                "limits": {
+                    "description": "Resources that each command can use in the worker",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/globalstructs.Limits"
+                        }
+                    ]
+                },
+                "maxRetries": {
+                    "description": "Number of times the task is executed again if it fails",
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -672,12 +2119,120 @@ const docTemplate = `{
                 "priority": {
                     "type": "integer"
                 },
+                "queue": {
+                    "description": "Queue of the manager config, default if empty",
+                    "type": "string"
+                },
+                "rateKey": {
+                    "description": "Key of the rate limits of the manager config, e.g. the target host",
+                    "type": "string"
+                },
+                "requires": {
+                    "description": "Label selector of the workers that can run the task",
+                    "type": "string"
+                },
+                "retryBackoffSeconds": {
+                    "type": "integer"
+                },
                 "timeout": {
                     "description": "timeout in seconds",
                     "type": "integer"
                 }
             }
         },
+        "globalstructs.TaskTemplateSwagger": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string"
+                },
+                "task": {
+                    "$ref": "#/definitions/globalstructs.TaskSwagger"
+                },
+                "values": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "valuesFile": {
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.Token": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "user or worker",
+                    "type": "string"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "role of the user, admin, submitter or read-only",
+                    "type": "string"
+                },
+                "scopes": {
+                    "description": "API paths the token can use, e.g. task or worker, all if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "token": {
+                    "description": "only returned when the token is added",
+                    "type": "string"
+                },
+                "username": {
+                    "description": "name of the user or the worker",
+                    "type": "string"
+                }
+            }
+        },
+        "globalstructs.TokenSwagger": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "description": "RFC3339 time when the token expires, never if empty",
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
         "globalstructs.Worker": {
             "type": "object",
             "properties": {
@@ -690,12 +2245,119 @@ const docTemplate = `{
                 "iddleThreads": {
                     "type": "integer"
                 },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "modules": {
+                    "description": "modules configured in the worker",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "name": {
                     "description": "Workers name (unique)",
                     "type": "string"
                 },
                 "up": {
                     "type": "boolean"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.StatusModule": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "workerNames": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "workers": {
+                    "type": "integer"
+                }
+            }
+        },
+        "utils.StatusQueue": {
+            "type": "object",
+            "properties": {
+                "maxRunning": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "workers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "utils.TaskGraph": {
+            "type": "object",
+            "properties": {
+                "edges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/utils.TaskGraphEdge"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/utils.TaskGraphNode"
+                    }
+                }
+            }
+        },
+        "utils.TaskGraphEdge": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.TaskGraphNode": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
                 }
             }
         }
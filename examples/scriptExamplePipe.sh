@@ -0,0 +1,65 @@
+#!/bin/bash
+
+# Function to send a POST request and get the task ID
+function send_post_request() {
+    local url="$1"
+    local oauthToken="$2"
+    local data="$3"
+    
+    # Send POST request and capture the task ID
+    task_id=$(curl -s -k -X POST -H "Authorization: $oauthToken" -H "Content-Type: application/json" -d "$data" "$url" | jq -r '.id')
+    echo "$task_id"
+}
+
+# Function to check the status of a task using a GET request
+function get_task() {
+    local url="$1"
+    local oauthToken="$2"
+    
+    # Send GET request to check task status
+    task=$(curl -s -k -H "Authorization: $oauthToken" "$url")
+    echo "$task"
+}
+
+function wait_task(){
+    local url="$1"
+    local oauthToken="$2"
+    local task_id="$3"
+    # Wait for task done
+    while true; do
+        task=$(get_task "$url/task/$task_id" "$oauthToken" )
+        status=$(echo $task | jq -r '.status')
+        if [ "$status" == "done" ] || [ "$status" == "failed" ]; then
+            echo $task
+            break  # Exit the loop
+        else
+            sleep 1  # Adjust the sleep duration as needed
+        fi
+    done
+}
+
+# Define vars
+## oauth token, IP, port, range to scan
+oauthToken="WLJ2xVQZ5TXVw4qEznZDnmEE2"
+nTaskIP="127.0.0.1"
+nTaskPort="8080"
+scanRange="127.0.0.1/26"
+url="https://$nTaskIP:$nTaskPort"
+
+# Find the IPs up in the range and scan them with nmap in the same task,
+# the second command reads the output of the first one from its stdin
+command1="{\"module\": \"nmapIPs\", \"args\": \"$scanRange\"}"
+command2="{\"module\": \"nmap\", \"args\": \"-iL -\", \"stdin\": \"{{commands[0].stdout}}\"}"
+task_data="{\"commands\": [$command1, $command2], \"priority\": 0}"
+task_id=$(send_post_request "$url/task" "$oauthToken" "$task_data")
+echo task_id: $task_id
+
+# Wait for task done
+TASK=$(wait_task $url $oauthToken $task_id)
+
+echo "IPs up:"
+echo "${TASK}" | jq -r '.commands[0].stdout'
+echo "NMAP results:"
+echo "${TASK}" | jq -r '.commands[1].output'
+
+exit 0
@@ -0,0 +1,104 @@
+package globalstructs
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// conditionTermRegex one comparison of a runIf condition, e.g. commands[0].exitCode != 0
+var conditionTermRegex = regexp.MustCompile(`^commands\[(\d+)\]\.(exitCode|status)\s*(==|!=|<=|>=|<|>)\s*(\S+)$`)
+
+// conditionTerm one comparison of a runIf condition
+type conditionTerm struct {
+	Command  int
+	Field    string // exitCode or status
+	Operator string
+	Value    string
+}
+
+// Condition runIf of a command, true if any of its groups has all the terms true
+type Condition [][]conditionTerm
+
+// ParseCondition parses the runIf of the command num of a task. The terms compare the exitCode
+// or the status of a previous command and are joined with && and ||, && first, e.g.
+// "commands[0].exitCode == 0 || commands[0].status == skipped && commands[1].exitCode < 2"
+func ParseCondition(condition string, num int) (Condition, error) {
+	var parsed Condition
+	for _, group := range strings.Split(condition, "||") {
+		var terms []conditionTerm
+		for _, term := range strings.Split(group, "&&") {
+			term = strings.TrimSpace(term)
+			match := conditionTermRegex.FindStringSubmatch(term)
+			if match == nil {
+				return nil, fmt.Errorf("invalid runIf term %q", term)
+			}
+
+			t := conditionTerm{Field: match[2], Operator: match[3], Value: match[4]}
+			t.Command, _ = strconv.Atoi(match[1])
+			if t.Command >= num {
+				return nil, fmt.Errorf("invalid runIf term %q: only the previous commands can be used", term)
+			}
+			if t.Field == "exitCode" {
+				if _, err := strconv.Atoi(t.Value); err != nil {
+					return nil, fmt.Errorf("invalid runIf term %q: the exitCode must be a number", term)
+				}
+			} else {
+				if t.Operator != "==" && t.Operator != "!=" {
+					return nil, fmt.Errorf("invalid runIf term %q: the status can only use == and !=", term)
+				}
+				if !slices.Contains(CommandStatuses, t.Value) {
+					return nil, fmt.Errorf("invalid runIf term %q: unknown status", term)
+				}
+			}
+			terms = append(terms, t)
+		}
+		parsed = append(parsed, terms)
+	}
+	return parsed, nil
+}
+
+// Eval returns true if the condition matches the results of the commands
+func (c Condition) Eval(commands []Command) bool {
+	for _, group := range c {
+		matched := true
+		for _, term := range group {
+			if !term.eval(commands[term.Command]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// eval compares the command, the exitCode of a command that didn't run never matches
+func (t conditionTerm) eval(command Command) bool {
+	if t.Field == "status" {
+		return (command.Status == t.Value) == (t.Operator == "==")
+	}
+	if command.ExitCode == nil {
+		return false
+	}
+	value, _ := strconv.Atoi(t.Value)
+	exitCode := *command.ExitCode
+	switch t.Operator {
+	case "==":
+		return exitCode == value
+	case "!=":
+		return exitCode != value
+	case "<":
+		return exitCode < value
+	case "<=":
+		return exitCode <= value
+	case ">":
+		return exitCode > value
+	default:
+		return exitCode >= value
+	}
+}
@@ -0,0 +1,29 @@
+package globalstructs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ResultPlaceholderRegex placeholder of the result of a previous command in the args and the stdin
+// of a command, e.g. {{commands[0].output}}, replaced by the worker before the command runs
+var ResultPlaceholderRegex = regexp.MustCompile(`\{\{commands\[(\d+)\]\.(output|stdout|stderr|exitCode)\}\}`)
+
+// resultPlaceholderLikeRegex anything that looks like a result placeholder, to find the invalid ones
+var resultPlaceholderLikeRegex = regexp.MustCompile(`\{\{\s*commands\b[^}]*\}\}`)
+
+// CheckResultPlaceholders returns an error if s has an invalid placeholder or one
+// of the command num or a later one, which have no result yet
+func CheckResultPlaceholders(s string, num int) error {
+	for _, placeholder := range resultPlaceholderLikeRegex.FindAllString(s, -1) {
+		match := ResultPlaceholderRegex.FindStringSubmatch(placeholder)
+		if match == nil {
+			return fmt.Errorf("invalid placeholder %s", placeholder)
+		}
+		if command, _ := strconv.Atoi(match[1]); command >= num {
+			return fmt.Errorf("invalid placeholder %s: only the previous commands can be used", placeholder)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package globalstructs
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -11,29 +12,159 @@ import (
 
 // Task Struct to store all Task information.
 type Task struct {
-	ID            string    `json:"id"`
-	Notes         string    `json:"notes"`
-	Commands      []Command `json:"commands"`
-	Files         []File    `json:"files"`
-	Name          string    `json:"name"`
-	CreatedAt     string    `json:"createdAt"`
-	UpdatedAt     string    `json:"updatedAt"`
-	ExecutedAt    string    `json:"executedAt"`
-	Status        string    `json:"status"` // pending, running, done, failed, deleted
-	Duration      float64   `json:"duration"`
-	WorkerName    string    `json:"workerName"`
-	Username      string    `json:"username"`
-	Priority      int       `json:"priority"`
-	Timeout       int       `json:"timeout"` // timeout in seconds
-	CallbackURL   string    `json:"callbackURL"`
-	CallbackToken string    `json:"callbackToken"`
+	ID                  string        `json:"id"`
+	Notes               string        `json:"notes"`
+	Commands            []Command     `json:"commands"`
+	Files               []File        `json:"files"`
+	Name                string        `json:"name"`
+	CreatedAt           string        `json:"createdAt"`
+	UpdatedAt           string        `json:"updatedAt"`
+	ExecutedAt          string        `json:"executedAt"`
+	Status              string        `json:"status"` // pending, running, done, failed, deleted, skipped, cancelled
+	Duration            float64       `json:"duration"`
+	WorkerName          string        `json:"workerName"`
+	Username            string        `json:"username"`
+	Priority            int           `json:"priority"`
+	Timeout             int           `json:"timeout"` // timeout in seconds
+	CallbackURL         string        `json:"callbackURL"`
+	CallbackToken       string        `json:"callbackToken"`
+	DependsOn           []string      `json:"dependsOn"` // IDs of the tasks that must be done before this one
+	MaxRetries          int           `json:"maxRetries"`
+	RetryBackoffSeconds int           `json:"retryBackoffSeconds"` // seconds before the first retry, doubled after each attempt
+	Retries             int           `json:"retries"`
+	Attempts            []TaskAttempt `json:"attempts,omitempty"`
+	Requires            string        `json:"requires"`           // label selector of the workers that can run the task, e.g. "region=eu,has-nmap,gpu!=true"
+	GroupID             string        `json:"groupID"`            // ID shared by the tasks added by the same batch or template
+	CancelGraceSeconds  int           `json:"cancelGraceSeconds"` // seconds between SIGTERM and SIGKILL when the task is cancelled
+	Artifacts           []string      `json:"artifacts"`          // glob paths of the files collected by the worker after the execution
+	ArtifactFiles       []Artifact    `json:"artifactFiles,omitempty"`
+	Limits              Limits        `json:"limits"`                    // resources of each command
+	Queue               string        `json:"queue"`                     // queue of the manager config, default if empty
+	RateKey             string        `json:"rateKey"`                   // key of the rate limits of the manager config, e.g. the target host
+	CancelRequested     bool          `json:"cancelRequested,omitempty"` // deleted by the user while running, it runs until the worker stops it
+}
+
+// Limits resources that each command of a task can use in the worker, 0 is no limit
+type Limits struct {
+	MemoryMB    int   `json:"memoryMB"`    // max memory in MiB
+	CPUSeconds  int   `json:"cpuSeconds"`  // max CPU time
+	OutputBytes int64 `json:"outputBytes"` // max bytes of stdout and stderr
+	OpenFiles   int   `json:"openFiles"`   // max open files
+}
+
+// TaskAttempt result of one execution of a task
+type TaskAttempt struct {
+	Attempt    int       `json:"attempt"`
+	WorkerName string    `json:"workerName"`
+	Status     string    `json:"status"`
+	Commands   []Command `json:"commands"`
+	Duration   float64   `json:"duration"`
+	ExecutedAt string    `json:"executedAt"`
+	FinishedAt string    `json:"finishedAt"`
 }
 
 // Command struct for Commands in a task
 type Command struct {
-	Module string `json:"module"`
-	Args   string `json:"args"`
-	Output string `json:"output"`
+	Module     string `json:"module"`
+	Args       string `json:"args"`
+	OnFailure  string `json:"onFailure,omitempty"`  // abort (default), continue or skip-rest
+	RunIf      string `json:"runIf,omitempty"`      // condition on the previous commands, e.g. commands[0].exitCode == 0
+	Stdin      string `json:"stdin,omitempty"`      // input of the command, e.g. {{commands[0].stdout}}
+	Status     string `json:"status,omitempty"`     // done, failed, cancelled or skipped, empty until the task runs
+	ExitCode   *int   `json:"exitCode,omitempty"`   // -1 if the command was killed by a signal or didn't start
+	Output     string `json:"output"`               // stdout followed by stderr, built from them when reading, not stored nor sent
+	Stdout     string `json:"stdout,omitempty"`     // empty if the output is in the result store
+	Stderr     string `json:"stderr,omitempty"`     // empty if the output is in the result store
+	Error      string `json:"error,omitempty"`      // why the command failed, e.g. limit exceeded
+	OutputKey  string `json:"outputKey,omitempty"`  // key in the result store when the output is too big, Output is empty
+	OutputSize int64  `json:"outputSize,omitempty"` // size of the output in the result store
+	StartedAt  string `json:"startedAt,omitempty"`  // RFC 3339
+	FinishedAt string `json:"finishedAt,omitempty"` // RFC 3339
+	DurationMs int64  `json:"durationMs,omitempty"`
+}
+
+// CombinedOutput returns the stdout followed by the stderr of the command
+func (c Command) CombinedOutput() string {
+	if c.Stdout == "" || c.Stderr == "" {
+		return c.Stdout + c.Stderr
+	}
+	return c.Stdout + "\n" + c.Stderr
+}
+
+// SetOutputs sets the Output of the commands that don't have it to their CombinedOutput
+func SetOutputs(commands []Command) {
+	for i := range commands {
+		if commands[i].Output == "" {
+			commands[i].Output = commands[i].CombinedOutput()
+		}
+	}
+}
+
+// Command status values
+const (
+	CommandDone      = "done"
+	CommandFailed    = "failed"
+	CommandCancelled = "cancelled"
+	CommandSkipped   = "skipped" // not executed because a previous command failed or its runIf was false
+)
+
+// CommandStatuses valid values of Command.Status
+var CommandStatuses = []string{CommandDone, CommandFailed, CommandCancelled, CommandSkipped}
+
+// Command onFailure values, with continue and skip-rest the task is done even if the command
+// failed: its dependents run and it isn't retried
+const (
+	OnFailureAbort    = "abort"     // the task fails and the rest of the commands are skipped
+	OnFailureContinue = "continue"  // the next commands run, the failure doesn't fail the task
+	OnFailureSkipRest = "skip-rest" // the rest of the commands are skipped, the failure doesn't fail the task
+)
+
+// Artifact file matched by the artifacts of a task, collected by the worker to the result store
+type Artifact struct {
+	Num     int    `json:"num"`     // position in the artifacts of the attempt, used to download it
+	Attempt int    `json:"attempt"` // attempt of the task that produced it
+	Path    string `json:"path"`    // path in the worker
+	Key     string `json:"key"`     // key in the result store
+	Size    int64  `json:"size"`
+}
+
+// ResultChunk chunk of a big output of a command, or of an artifact, uploaded by the worker to the result store
+type ResultChunk struct {
+	ID       string `json:"id"`      // task ID
+	Attempt  int    `json:"attempt"` // retries of the task when it was executed
+	Index    int    `json:"index"`   // number of the command, or of the artifact
+	Artifact bool   `json:"artifact,omitempty"`
+	Offset   int64  `json:"offset"`
+	Data     []byte `json:"data"`
+	Last     bool   `json:"last"`
+}
+
+// Key returns the key in the result store of the output or artifact of the chunk
+func (c ResultChunk) Key() string {
+	if c.Artifact {
+		return ArtifactKey(c.ID, c.Attempt, c.Index)
+	}
+	return ResultKey(c.ID, c.Attempt, c.Index)
+}
+
+// ResultKey key of the output of a command of a task in the result store
+func ResultKey(id string, attempt, command int) string {
+	return fmt.Sprintf("%s/%d/%d", id, attempt, command)
+}
+
+// ArtifactKey key of an artifact of a task in the result store
+func ArtifactKey(id string, attempt, num int) string {
+	return fmt.Sprintf("%s/%d/artifacts/%d", id, attempt, num)
+}
+
+// TaskOutput chunk of the output of a command while the task is running
+type TaskOutput struct {
+	Seq       int64  `json:"seq"` // set by the manager, increases with each chunk
+	ID        string `json:"id"`  // task ID
+	Command   int    `json:"command"`
+	Stream    string `json:"stream"` // stdout or stderr
+	Data      string `json:"data"`
+	CreatedAt string `json:"createdAt"`
 }
 
 // File Files struct to encapsulate FileContent and RemoteFilePath
@@ -44,29 +175,153 @@ type File struct {
 
 // TaskSwagger Task Struct for swagger docs, for the POST
 type TaskSwagger struct {
-	Commands []CommandSwagger `json:"commands"`
-	Files    []File           `json:"files"`
-	Name     string           `json:"name"`
-	Notes    string           `json:"notes"`
-	Priority int              `json:"priority"`
-	Timeout  int              `json:"timeout"` // timeout in seconds
+	Commands  []CommandSwagger `json:"commands"`
+	Files     []File           `json:"files"`
+	Name      string           `json:"name"`
+	Notes     string           `json:"notes"`
+	Priority  int              `json:"priority"`
+	Timeout   int              `json:"timeout"` // timeout in seconds
+	DependsOn []string         `json:"dependsOn"`
+	// Number of times the task is executed again if it fails
+	MaxRetries          int `json:"maxRetries"`
+	RetryBackoffSeconds int `json:"retryBackoffSeconds"`
+	// Label selector of the workers that can run the task
+	Requires string `json:"requires"`
+	// Seconds between SIGTERM and SIGKILL when the task is cancelled
+	CancelGraceSeconds int `json:"cancelGraceSeconds"`
+	// Glob paths of the files collected by the worker after the execution
+	Artifacts []string `json:"artifacts"`
+	// Resources that each command can use in the worker
+	Limits Limits `json:"limits"`
+	// Queue of the manager config, default if empty
+	Queue string `json:"queue"`
+	// Key of the rate limits of the manager config, e.g. the target host
+	RateKey string `json:"rateKey"`
 }
 
 // CommandSwagger Command struct for swagger documentation
 type CommandSwagger struct {
 	Module string `json:"module"`
 	Args   string `json:"args"`
+	// What to do if the command fails: abort (default), continue or skip-rest
+	OnFailure string `json:"onFailure"`
+	// Run the command only if the condition on the previous commands is true
+	RunIf string `json:"runIf"`
+	// Input of the command, can use the results of the previous commands like the args
+	Stdin string `json:"stdin"`
+}
+
+// TaskBatch response of a batch of tasks, the IDs are in the order of the request
+type TaskBatch struct {
+	GroupID string   `json:"groupID"`
+	IDs     []string `json:"ids"`
+}
+
+// TaskTemplate task with {{key}} placeholders expanded into one task per value
+type TaskTemplate struct {
+	Task       Task     `json:"task"`
+	Key        string   `json:"key"`        // name of the placeholder, {{key}}
+	Values     []string `json:"values"`     // values of the placeholder
+	ValuesFile string   `json:"valuesFile"` // base64 file with a value per line
+}
+
+// TaskTemplateSwagger TaskTemplate struct for swagger docs, for the POST
+type TaskTemplateSwagger struct {
+	Task       TaskSwagger `json:"task"`
+	Key        string      `json:"key"`
+	Values     []string    `json:"values"`
+	ValuesFile string      `json:"valuesFile"`
+}
+
+// Job group of tasks added by a batch or a template, the ID is the groupID of its tasks
+type Job struct {
+	ID        string         `json:"id"`
+	Kind      string         `json:"kind"` // batch, template
+	Username  string         `json:"username"`
+	CreatedAt string         `json:"createdAt"`
+	Total     int            `json:"total"`
+	Status    map[string]int `json:"status"`   // number of tasks by status
+	Progress  float64        `json:"progress"` // percent of tasks finished
+	Tasks     []JobTask      `json:"tasks,omitempty"`
+}
+
+// JobTask output of the commands of a task of a job
+type JobTask struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Outputs []string `json:"outputs"`
+}
+
+// Schedule task template added as a new task periodically with a cron expression or once at runAt
+type Schedule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Task       Task   `json:"task"`
+	Cron       string `json:"cron"`  // minute hour day-of-month month day-of-week
+	RunAt      string `json:"runAt"` // RFC3339 time to run only once
+	NextRunAt  string `json:"nextRunAt"`
+	LastRunAt  string `json:"lastRunAt"`
+	LastTaskID string `json:"lastTaskID"`
+	Enabled    bool   `json:"enabled"`
+	Username   string `json:"username"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// ScheduleSwagger Schedule struct for swagger docs, for the POST
+type ScheduleSwagger struct {
+	Name  string      `json:"name"`
+	Task  TaskSwagger `json:"task"`
+	Cron  string      `json:"cron"`
+	RunAt string      `json:"runAt"`
+}
+
+// Token API token of a user or a worker saved in the database, only its hash is saved
+type Token struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`     // user or worker
+	Username   string   `json:"username"` // name of the user or the worker
+	Role       string   `json:"role"`     // role of the user, admin, submitter or read-only
+	Scopes     []string `json:"scopes"`   // API paths the token can use, e.g. task or worker, all if empty
+	ExpiresAt  string   `json:"expiresAt"`
+	LastUsedAt string   `json:"lastUsedAt"`
+	CreatedBy  string   `json:"createdBy"`
+	CreatedAt  string   `json:"createdAt"`
+	Token      string   `json:"token,omitempty"` // only returned when the token is added
+}
+
+// Token kind values
+const (
+	TokenUser   = "user"
+	TokenWorker = "worker"
+)
+
+// TokenScopes valid values of Token.Scopes, the first element of the API path
+var TokenScopes = []string{"status", "worker", "module", "task", "job", "schedule", "token", "queue"}
+
+// TokenSwagger Token struct for swagger docs, for the POST
+type TokenSwagger struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"`
+	// RFC3339 time when the token expires, never if empty
+	ExpiresAt string `json:"expiresAt"`
 }
 
 // Worker struct to store all worker information.
 type Worker struct {
 	// Workers name (unique)
-	Name           string `json:"name"`
-	DefaultThreads int    `json:"defaultThreads"`
-	IddleThreads   int    `json:"iddleThreads"`
-	UP             bool   `json:"up"`
-	DownCount      int    `json:"downCount"`
-	UpdatedAt      string `json:"updatedAt"`
+	Name           string            `json:"name"`
+	DefaultThreads int               `json:"defaultThreads"`
+	IddleThreads   int               `json:"iddleThreads"`
+	UP             bool              `json:"up"`
+	DownCount      int               `json:"downCount"`
+	UpdatedAt      string            `json:"updatedAt"`
+	Labels         map[string]string `json:"labels"`
+	Modules        []string          `json:"modules"` // modules configured in the worker
 }
 
 // WorkerStatus struct to process the worker status response.
@@ -74,6 +329,7 @@ type WorkerStatus struct {
 	Name         string         `json:"name"`
 	IddleThreads int            `json:"iddleThreads"`
 	WorkingIDs   map[string]int `json:"workingIds"`
+	Modules      []string       `json:"modules"`
 }
 
 // Error struct to JSON error
@@ -37,6 +37,7 @@ type Arguments struct {
 	Verbose         bool
 	Debug           bool
 	VerifyAltName   bool
+	DryRun          bool
 }
 
 func main() {
@@ -79,6 +80,23 @@ func main() {
 	managerCmd.Flags().StringVarP(&arguments.ConfigCloudFile,
 		"configCloudFile", "C", "", "Path to the config Cloud file (default: empty)")
 
+	// Add migrate subcommand to the manager
+	var migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending database migrations of the manager",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateStart(&arguments)
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return validateSubcommandFlags(cmd.Flags(), &arguments)
+		},
+	}
+	migrateCmd.Flags().StringVarP(&arguments.ConfigFile,
+		"configFile", "c", "", "Path to the config file (default: manager.conf)")
+	migrateCmd.Flags().BoolVar(&arguments.DryRun,
+		"dry-run", false, "Print the pending migrations without applying them")
+	managerCmd.AddCommand(migrateCmd)
+
 	// Add worker subcommand
 	var workerCmd = &cobra.Command{
 		Use:   "worker",
@@ -114,6 +132,13 @@ func managerStart(arguments *Arguments) {
 		arguments.ConfigSSHFile, arguments.ConfigCloudFile, arguments.VerifyAltName, arguments.Verbose, arguments.Debug)
 }
 
+func migrateStart(arguments *Arguments) error {
+	if arguments.ConfigFile == "" {
+		arguments.ConfigFile = "manager.conf"
+	}
+	return manager.MigrateManager(arguments.ConfigFile, arguments.DryRun, arguments.Verbose, arguments.Debug)
+}
+
 func workerStart(arguments *Arguments) {
 	// Use config parameters to start the worker
 	if arguments.ConfigFile == "" {
@@ -2,12 +2,12 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/r4ulcl/nTask/manager/database"
 	"github.com/r4ulcl/nTask/manager/utils"
 )
 
@@ -22,7 +22,7 @@ import (
 // @failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /status [get]
-func HandleStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleStatus(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
 	_, ok := r.Context().Value(utils.UsernameKey).(string)
 	if !ok {
 		// if not username is a worker
@@ -64,7 +64,7 @@ func HandleStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, d
 }
 
 // Generic handler function for fetching and encoding data
-func handleEntityStatus[T any](w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool, fetchDataFunc func(*sql.DB, string, bool, bool) (T, error), entityName string) {
+func handleEntityStatus[T any](w http.ResponseWriter, r *http.Request, verbose, debug bool, fetchDataFunc func(string, bool, bool) (T, error), entityName string) {
 	_, ok := r.Context().Value(utils.UsernameKey).(string)
 	if !ok {
 		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
@@ -75,7 +75,7 @@ func handleEntityStatus[T any](w http.ResponseWriter, r *http.Request, db *sql.D
 	idOrName := vars[entityName]
 
 	// Fetch the entity (task or worker)
-	entity, err := fetchDataFunc(db, idOrName, verbose, debug)
+	entity, err := fetchDataFunc(idOrName, verbose, debug)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \"Invalid "+entityName+" body: "+err.Error()+"\"}", http.StatusBadRequest)
 		return
@@ -115,3 +115,41 @@ func getUsername(r *http.Request, verbose, debug bool) (bool, string) {
 
 	return ok, username
 }
+
+// isAdmin returns true if the request is from a user with the admin role
+func isAdmin(r *http.Request) bool {
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+	return role == utils.RoleAdmin
+}
+
+// ownerFilter returns the user whose tasks, jobs and schedules the request can use,
+// empty for the admins that can use all of them
+func ownerFilter(r *http.Request) string {
+	if isAdmin(r) {
+		return ""
+	}
+	username, _ := r.Context().Value(utils.UsernameKey).(string)
+	return username
+}
+
+// checkOwner writes a Forbidden error and returns false if the request can't use a resource of owner
+func checkOwner(w http.ResponseWriter, r *http.Request, owner string) bool {
+	if filter := ownerFilter(r); filter != "" && filter != owner {
+		http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkTaskOwner like checkOwner with the task id, it writes the error if the task doesn't exist
+func checkTaskOwner(w http.ResponseWriter, r *http.Request, db database.Store, id string, verbose, debug bool) bool {
+	if ownerFilter(r) == "" {
+		return true
+	}
+	owner, err := db.GetTaskUsername(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return false
+	}
+	return checkOwner(w, r, owner)
+}
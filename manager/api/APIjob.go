@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// HandleJobGet Get all the jobs
+// @description Get all the jobs added by a batch or a template, without their status
+// @summary Get all the jobs
+// @Tags job
+// @accept application/json
+// @produce application/json
+// @param limit query int false "limit output DB"
+// @param page query int false "page output DB"
+// @success 200 {array} globalstructs.Job
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /job [get]
+func HandleJobGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	page, limit := queryInt(r, "page", 1), queryInt(r, "limit", 0)
+	jobs, err := db.GetJobs(ownerFilter(r), page, limit, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid GetJobs: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(jobs)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid jobs encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// HandleJobStatus Get status of a job
+// @description Get the number of tasks by status, the progress and the outputs of the tasks of a job
+// @summary Get status of a job
+// @Tags job
+// @accept application/json
+// @produce application/json
+// @param ID path string true "job ID"
+// @param outputs query bool false "Include the outputs of the tasks (default true)"
+// @param limit query int false "limit of tasks"
+// @param page query int false "page of tasks"
+// @success 200 {object} globalstructs.Job
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /job/{ID} [get]
+func HandleJobStatus(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	page, limit := queryInt(r, "page", 1), queryInt(r, "limit", 0)
+	if r.URL.Query().Get("outputs") == "false" {
+		page = 0
+	}
+	if job, err := db.GetJob(mux.Vars(r)["ID"], verbose, debug); err == nil && !checkOwner(w, r, job.Username) {
+		return
+	}
+
+	handleEntityStatus(w, r, verbose, debug, func(id string, verbose, debug bool) (globalstructs.Job, error) {
+		return utils.GetJobStatus(db, id, page, limit, verbose, debug)
+	}, "ID")
+}
+
+// HandleJobDelete Cancel a job
+// @description Delete the pending and running tasks of a job, the finished tasks are kept
+// @summary Cancel a job
+// @Tags job
+// @accept application/json
+// @produce application/json
+// @param ID path string true "job ID"
+// @success 200 {object} globalstructs.Job
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /job/{ID} [delete]
+func HandleJobDelete(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["ID"]
+
+	job, err := db.GetJob(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	if !checkOwner(w, r, job.Username) {
+		return
+	}
+
+	if _, err := utils.CancelJob(db, config, id, verbose, debug, writeLock); err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	job, err = utils.GetJobStatus(db, id, 0, 0, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(job)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid job encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// queryInt returns a positive int query parameter or d
+func queryInt(r *http.Request, key string, d int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get(key)); err == nil && n > 0 {
+		return n
+	}
+	return d
+}
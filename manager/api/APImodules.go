@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// HandleModuleGet Get the modules available in the workers
+// @description Get the modules configured in the workers that are up and how many workers have each one
+// @summary Get modules
+// @Tags module
+// @accept application/json
+// @produce application/json
+// @success 200 {array} utils.StatusModule
+// @failure 400 {object} globalstructs.Error
+// @failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /module [get]
+func HandleModuleGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	modules, err := utils.GetStatusModules(db, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid GetStatusModules: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	if debug {
+		log.Println("API modules", modules)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(modules)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid modules encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
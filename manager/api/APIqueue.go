@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// HandleQueueGet Get the queues of the tasks
+// @description Get the pending and running tasks and the limits of each queue
+// @summary Get queues
+// @Tags queue
+// @accept application/json
+// @produce application/json
+// @success 200 {array} utils.StatusQueue
+// @failure 400 {object} globalstructs.Error
+// @failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /queue [get]
+func HandleQueueGet(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	queues, err := utils.GetStatusQueues(config, db, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid GetStatusQueues: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	if debug {
+		log.Println("API queues", queues)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(queues)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid queues encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// HandleScheduleGet Get all the schedules
+// @description Get all the schedules
+// @summary Get all the schedules
+// @Tags schedule
+// @accept application/json
+// @produce application/json
+// @success 200 {array} globalstructs.Schedule
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /schedule [get]
+func HandleScheduleGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	schedules, err := db.GetSchedules(ownerFilter(r), verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid GetSchedules: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(schedules)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedules encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// HandleSchedulePost Add a new schedule
+// @description Add a task template that is added as a new task on each cron match or once at runAt
+// @summary Add a new schedule
+// @Tags schedule
+// @accept application/json
+// @produce application/json
+// @param schedule body globalstructs.ScheduleSwagger true "Schedule object to create"
+// @success 200 {object} globalstructs.Schedule
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /schedule [post]
+func HandleSchedulePost(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, username := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+	if debug {
+		log.Println("API HandleSchedulePost", username)
+	}
+
+	var request globalstructs.Schedule
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedule body: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	runAt, nextRunAt, err := checkSchedule(config, db, &request, username, ownerFilter(r), verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	request.ID, err = utils.GenerateRandomID(30, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid ID generated: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+	request.Username = username
+	request.Enabled = true
+
+	err = db.AddSchedule(request, runAt, nextRunAt, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedule info: "+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	if verbose {
+		log.Println("API Add Schedule to DB", request.ID)
+	}
+
+	schedule, err := db.GetSchedule(request.ID, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedule info: "+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(schedule)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedule encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// checkSchedule checks the cron or runAt of a schedule and its task template, the parents
+// of the template must be of owner if it is not empty. Returns runAt and the first execution
+func checkSchedule(config *utils.ManagerConfig, db database.Store, schedule *globalstructs.Schedule, username, owner string, verbose, debug bool) (*time.Time, *time.Time, error) {
+	if (schedule.Cron == "") == (schedule.RunAt == "") {
+		return nil, nil, fmt.Errorf("Invalid schedule: set cron or runAt")
+	}
+
+	var runAt, nextRunAt *time.Time
+	if schedule.RunAt != "" {
+		t, err := time.Parse(time.RFC3339, schedule.RunAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid runAt: %s", err.Error())
+		}
+		runAt, nextRunAt = &t, &t
+	} else {
+		var err error
+		nextRunAt, err = utils.NextScheduleRun(schedule.Cron, time.Now())
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid cron: %s", err.Error())
+		}
+	}
+
+	// The status and ID of the template are set on each run
+	schedule.Task.ID = ""
+	schedule.Task.Status = ""
+	schedule.Task.GroupID = ""
+	refs, err := getTaskRefs(db, []globalstructs.Task{schedule.Task}, owner, verbose, debug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkTask(refs, &schedule.Task); err != nil {
+		return nil, nil, err
+	}
+	if err := utils.CheckQueue(config, &schedule.Task, username); err != nil {
+		return nil, nil, err
+	}
+	schedule.Task.Status = ""
+	return runAt, nextRunAt, nil
+}
+
+// HandleScheduleStatus Get a schedule
+// @description Get a schedule with its next and last execution
+// @summary Get a schedule
+// @Tags schedule
+// @accept application/json
+// @produce application/json
+// @param ID path string true "schedule ID"
+// @success 200 {object} globalstructs.Schedule
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /schedule/{ID} [get]
+func HandleScheduleStatus(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if schedule, err := db.GetSchedule(mux.Vars(r)["ID"], verbose, debug); err == nil && !checkOwner(w, r, schedule.Username) {
+		return
+	}
+	handleEntityStatus(w, r, verbose, debug, db.GetSchedule, "ID")
+}
+
+// HandleScheduleDelete Delete a schedule
+// @description Delete a schedule, the tasks already added are not deleted
+// @summary Delete a schedule
+// @Tags schedule
+// @accept application/json
+// @produce application/json
+// @param ID path string true "schedule ID"
+// @success 200 {object} globalstructs.Schedule
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /schedule/{ID} [delete]
+func HandleScheduleDelete(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["ID"]
+
+	schedule, err := db.GetSchedule(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	if !checkOwner(w, r, schedule.Username) {
+		return
+	}
+
+	err = db.RmSchedule(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(schedule)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid schedule encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
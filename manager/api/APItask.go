@@ -1,20 +1,39 @@
 package api
 
 import (
-	"crypto/rand"
-	"database/sql"
-	"encoding/hex"
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	globalstructs "github.com/r4ulcl/nTask/globalstructs"
 	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/resultstore"
 	"github.com/r4ulcl/nTask/manager/utils"
 )
 
+const (
+	// streamPollInterval time between reads of the database in HandleTaskStream
+	streamPollInterval = 1 * time.Second
+	// streamBatchSize max chunks read from the database at once
+	streamBatchSize = 500
+	// streamWriteTimeout max time to send a batch of chunks to the client
+	streamWriteTimeout = 30 * time.Second
+	// maxBatchTasks max tasks in a request to HandleTaskBatch
+	maxBatchTasks = 100000
+	// maxBatchBytes max size of the body of HandleTaskBatch and HandleTaskTemplate
+	maxBatchBytes = 256 << 20 // 256 MiB
+)
+
 // HandleTaskGet Get status of tasks
 // @description Get status of tasks
 // @summary Get all tasks
@@ -28,13 +47,20 @@ import (
 // @param createdAt query string false "Task createdAt"
 // @param updatedAt query string false "Task updatedAt"
 // @param executedAt query string false "Task executedAt"
-// @param status query string false "Task status" Enums(pending, running, done, failed, deleted)
+// @param status query string false "Task status" Enums(pending, running, done, failed, cancelled, deleted, skipped)
 // @param workerName query string false "Task workerName"
 // @param username query string false "Task username"
 // @param priority query string false "Task priority"
 // @param timeout query string false "Task timeout"
 // @param callbackURL query string false "Task callbackURL"
 // @param callbackToken query string false "Task callbackToken"
+// @param retries query int false "Task retries"
+// @param requires query string false "Task requires"
+// @param groupID query string false "Task groupID (job ID)"
+// @param queue query string false "Task queue"
+// @param rateKey query string false "Task rateKey"
+// @param commandStatus query string false "Status of a command of the task" Enums(done, failed, cancelled, skipped)
+// @param exitCode query int false "Exit code of a command of the task"
 // @param limit query int false "limit output DB"
 // @param page query int false "page output DB"
 // @success 200 {array} globalstructs.Task
@@ -42,15 +68,22 @@ import (
 // @Failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /task [get]
-func HandleTaskGet(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleTaskGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
 	ok, _ := getUsername(r, verbose, debug)
 	if !ok {
 		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
 		return
 	}
 
+	// The command filters are equality filters on the task_command rows
+	if err := checkCommandFilters(r); err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
 	// get tasks
-	tasks, err := database.GetTasks(r, db, verbose, debug)
+	// The users that are not admins only see their own tasks
+	tasks, err := db.GetTasks(r, ownerFilter(r), verbose, debug)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \"Invalid callback body GetTasks: "+err.Error()+"\"}", http.StatusBadRequest)
 		return
@@ -92,9 +125,10 @@ func HandleTaskGet(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose,
 // @success 200 {object} globalstructs.Task
 // @Failure 400 {object} globalstructs.Error
 // @Failure 403 {object} globalstructs.Error
+// @Failure 429 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /task [post]
-func HandleTaskPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleTaskPost(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
 	ok, username := getUsername(r, verbose, debug)
 	if !ok {
 		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
@@ -114,30 +148,21 @@ func HandleTaskPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose,
 		return
 	}
 
-	// Set Random ID
-	request.ID, err = generateRandomID(30, verbose, debug)
+	refs, err := getTaskRefs(db, []globalstructs.Task{request}, ownerFilter(r), verbose, debug)
 	if err != nil {
-		http.Error(w, "{ \"error\" : \"Invalid ID generated: "+err.Error()+"\"}", http.StatusBadRequest)
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
 		return
 	}
-
-	// set status
-	request.Status = "pending"
-	request.Username = username
-
-	if request.WorkerName != "" {
-		// Check if worker from user exists
-		_, err := database.GetWorker(db, request.WorkerName, verbose, debug)
-		if err != nil {
-			http.Error(w, "{ \"error\" : \"Invalid WorkerName (not found): "+err.Error()+"\"}", http.StatusBadRequest)
-			return
-		}
+	// Set ID, status and user and check the task
+	err = prepareTask(config, refs, &request, username, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
+		return
 	}
 
-	err = database.AddTask(db, request, verbose, debug)
+	err = db.AddTask(request, config.UserQuota(username).MaxPending, verbose, debug)
 	if err != nil {
-		message := "{ \"error\" : \"Invalid task info: " + err.Error() + "\" }"
-		http.Error(w, message, http.StatusBadRequest)
+		addTaskError(w, err)
 		return
 	}
 
@@ -145,7 +170,7 @@ func HandleTaskPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose,
 		log.Println("API Add Task to DB", request.ID)
 	}
 
-	task, err := database.GetTask(db, request.ID, verbose, debug)
+	task, err := db.GetTask(request.ID, verbose, debug)
 	if err != nil {
 		message := "{ \"error\" : \"Invalid task info: " + err.Error() + "\" }"
 		http.Error(w, message, http.StatusBadRequest)
@@ -162,8 +187,312 @@ func HandleTaskPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose,
 	}
 }
 
+// HandleTaskBatch Add many tasks
+// @description Add many tasks in a single transaction, the body is a JSON array of tasks or one JSON task per line (JSON Lines). If a task is invalid none is added. All the tasks share a groupID
+// @summary Add many tasks
+// @Tags task
+// @accept application/json
+// @produce application/json
+// @param tasks body []globalstructs.TaskSwagger true "Tasks to create"
+// @success 200 {object} globalstructs.TaskBatch
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @Failure 429 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/batch [post]
+func HandleTaskBatch(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, username := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+	if debug {
+		log.Println("API HandleTaskBatch", username)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	tasks, err := decodeTasks(r)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid batch body: "+err.Error()+"\"}", bodyErrorCode(err))
+		return
+	}
+	if len(tasks) == 0 {
+		http.Error(w, "{ \"error\" : \"Invalid batch body: no tasks\"}", http.StatusBadRequest)
+		return
+	}
+
+	addTaskGroup(w, r, config, db, tasks, "batch", username, verbose, debug)
+}
+
+// HandleTaskTemplate Add a task for each value of a template
+// @description Add a task for each value of the template replacing {{key}} in the args of the commands and in the name, the values are a list or a base64 file with a value per line. All the tasks share a groupID
+// @summary Add the tasks of a template
+// @Tags task
+// @accept application/json
+// @produce application/json
+// @param template body globalstructs.TaskTemplateSwagger true "Template to expand"
+// @success 200 {object} globalstructs.TaskBatch
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @Failure 429 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/template [post]
+func HandleTaskTemplate(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, username := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+	if debug {
+		log.Println("API HandleTaskTemplate", username)
+	}
+
+	var request globalstructs.TaskTemplate
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes)).Decode(&request)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid template body: "+err.Error()+"\"}", bodyErrorCode(err))
+		return
+	}
+
+	tasks, err := utils.ExpandTemplate(request)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid template: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+	if len(tasks) > maxBatchTasks {
+		http.Error(w, "{ \"error\" : \"Invalid template: more than "+strconv.Itoa(maxBatchTasks)+" values\"}", http.StatusBadRequest)
+		return
+	}
+
+	addTaskGroup(w, r, config, db, tasks, "template", username, verbose, debug)
+}
+
+// addTaskError writes the error of AddTask or AddJob, 429 if the new tasks exceed the pending tasks quota of the user
+func addTaskError(w http.ResponseWriter, err error) {
+	var quotaErr *database.QuotaError
+	if errors.As(err, &quotaErr) {
+		http.Error(w, "{ \"error\" : \""+quotaErr.Error()+"\" }", http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, "{ \"error\" : \"Invalid task info: "+err.Error()+"\" }", http.StatusBadRequest)
+}
+
+// addTaskGroup checks and adds the tasks as a new job in a single transaction,
+// the ID of the job is the groupID of the tasks, and writes the IDs in the response
+func addTaskGroup(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, tasks []globalstructs.Task, kind, username string, verbose, debug bool) {
+	groupID, err := utils.GenerateRandomID(30, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid ID generated: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	refs, err := getTaskRefs(db, tasks, ownerFilter(r), verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	response := globalstructs.TaskBatch{GroupID: groupID, IDs: make([]string, 0, len(tasks))}
+	for i := range tasks {
+		// Set ID, status and user and check the task
+		err = prepareTask(config, refs, &tasks[i], username, verbose, debug)
+		if err != nil {
+			http.Error(w, "{ \"error\" : \"Task "+strconv.Itoa(i)+": "+err.Error()+"\"}", http.StatusBadRequest)
+			return
+		}
+		tasks[i].GroupID = groupID
+		response.IDs = append(response.IDs, tasks[i].ID)
+	}
+
+	job := globalstructs.Job{ID: groupID, Kind: kind, Username: username}
+	err = db.AddJob(job, tasks, config.UserQuota(username).MaxPending, verbose, debug)
+	if err != nil {
+		addTaskError(w, err)
+		return
+	}
+
+	if verbose {
+		log.Println("API Add Tasks to DB", groupID, len(tasks))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid tasks encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// bodyErrorCode returns the status code of an error reading the body of a request
+func bodyErrorCode(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// decodeTasks reads a JSON array of tasks or one JSON task per line,
+// it stops at the first task over maxBatchTasks
+func decodeTasks(r *http.Request) ([]globalstructs.Task, error) {
+	reader := bufio.NewReader(r.Body)
+	// Skip the whitespace to know if the body is an array
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("empty body")
+		}
+		if b != ' ' && b != '\n' && b != '\r' && b != '\t' {
+			_ = reader.UnreadByte()
+			break
+		}
+	}
+
+	decoder := json.NewDecoder(reader)
+	array := false
+	if first, _ := reader.Peek(1); len(first) == 1 && first[0] == '[' {
+		// Read the tasks of the array one by one
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		array = true
+	}
+
+	// In JSON Lines each value is a task
+	var tasks []globalstructs.Task
+	for decoder.More() {
+		if len(tasks) == maxBatchTasks {
+			return nil, fmt.Errorf("more than %d tasks", maxBatchTasks)
+		}
+		var task globalstructs.Task
+		if err := decoder.Decode(&task); err != nil {
+			return nil, fmt.Errorf("task %d: %w", len(tasks), err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return tasks, nil
+}
+
+// taskRefs workers and parent tasks used by new tasks, read at once for a batch
+type taskRefs struct {
+	workers map[string]bool
+	parents map[string]globalstructs.Task
+}
+
+// getTaskRefs reads the workers and the parents of the tasks, the parents must be of owner
+// if it is not empty
+func getTaskRefs(db database.Store, tasks []globalstructs.Task, owner string, verbose, debug bool) (taskRefs, error) {
+	refs := taskRefs{workers: make(map[string]bool)}
+	if slices.ContainsFunc(tasks, func(task globalstructs.Task) bool { return task.WorkerName != "" }) {
+		workers, err := db.GetWorkers(verbose, debug)
+		if err != nil {
+			return refs, err
+		}
+		for _, worker := range workers {
+			refs.workers[worker.Name] = true
+		}
+	}
+
+	var err error
+	refs.parents, err = utils.GetParents(db, tasks, owner, verbose, debug)
+	return refs, err
+}
+
+// prepareTask sets a random ID, the pending status and the username of a new task
+// and checks its fields
+func prepareTask(config *utils.ManagerConfig, refs taskRefs, task *globalstructs.Task, username string, verbose, debug bool) error {
+	var err error
+	// Set Random ID
+	task.ID, err = utils.GenerateRandomID(30, verbose, debug)
+	if err != nil {
+		return fmt.Errorf("Invalid ID generated: %s", err.Error())
+	}
+
+	// set status
+	task.Status = "pending"
+	task.Username = username
+	task.GroupID = ""
+	task.ArtifactFiles = nil
+
+	if err := checkTask(refs, task); err != nil {
+		return err
+	}
+	return utils.CheckQueue(config, task, username)
+}
+
+// checkCommandFilters checks the commandStatus and exitCode filters of GET /task
+func checkCommandFilters(r *http.Request) error {
+	query := r.URL.Query()
+	if status := query.Get("commandStatus"); status != "" && !slices.Contains(globalstructs.CommandStatuses, status) {
+		return fmt.Errorf("Invalid commandStatus: %s", status)
+	}
+	if exitCode := query.Get("exitCode"); exitCode != "" {
+		if _, err := strconv.Atoi(exitCode); err != nil {
+			return fmt.Errorf("Invalid exitCode: %s", exitCode)
+		}
+	}
+	return nil
+}
+
+// checkTask checks the fields of a task sent by a user
+func checkTask(refs taskRefs, task *globalstructs.Task) error {
+	// Check if worker from user exists
+	if task.WorkerName != "" && !refs.workers[task.WorkerName] {
+		return fmt.Errorf("Invalid WorkerName (not found): %s", task.WorkerName)
+	}
+
+	// Check the label selector of the task
+	if _, err := utils.ParseLabelSelector(task.Requires); err != nil {
+		return fmt.Errorf("Invalid requires: %s", err.Error())
+	}
+
+	// Check the glob paths of the artifacts
+	for _, pattern := range task.Artifacts {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("Invalid artifacts: bad pattern %q", pattern)
+		}
+	}
+
+	if task.Limits.MemoryMB < 0 || task.Limits.CPUSeconds < 0 || task.Limits.OutputBytes < 0 || task.Limits.OpenFiles < 0 {
+		return fmt.Errorf("Invalid limits: negative value")
+	}
+
+	// Check the onFailure, runIf and placeholders of the commands
+	for num, command := range task.Commands {
+		switch command.OnFailure {
+		case "", globalstructs.OnFailureAbort, globalstructs.OnFailureContinue, globalstructs.OnFailureSkipRest:
+		default:
+			return fmt.Errorf("Invalid onFailure of command %d: %s", num, command.OnFailure)
+		}
+		if command.RunIf != "" {
+			if _, err := globalstructs.ParseCondition(command.RunIf, num); err != nil {
+				return fmt.Errorf("Invalid runIf of command %d: %s", num, err.Error())
+			}
+		}
+		if err := globalstructs.CheckResultPlaceholders(command.Args, num); err != nil {
+			return fmt.Errorf("Invalid args of command %d: %s", num, err.Error())
+		}
+		if err := globalstructs.CheckResultPlaceholders(command.Stdin, num); err != nil {
+			return fmt.Errorf("Invalid stdin of command %d: %s", num, err.Error())
+		}
+	}
+
+	// Check the parents of the task
+	if err := utils.CheckParents(task, refs.parents); err != nil {
+		return fmt.Errorf("Invalid dependsOn: %s", err.Error())
+	}
+	return nil
+}
+
 // HandleTaskDelete Delete a tasks
-// @description Delete a tasks
+// @description Delete a task, a running task is stopped and its worker sends it back as cancelled
 // @summary Delete a tasks
 // @Tags task
 // @accept application/json
@@ -174,7 +503,7 @@ func HandleTaskPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose,
 // @Failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /task/{ID} [delete]
-func HandleTaskDelete(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex) {
+func HandleTaskDelete(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
 	_, ok := r.Context().Value(utils.UsernameKey).(string)
 	if !ok {
 		http.Error(w, "{ \"error\" : \"Username not found\" }", http.StatusUnauthorized)
@@ -184,40 +513,21 @@ func HandleTaskDelete(w http.ResponseWriter, r *http.Request, config *utils.Mana
 	vars := mux.Vars(r)
 	id := vars["ID"]
 
-	task, err := database.GetTask(db, id, verbose, debug)
+	task, err := db.GetTask(id, verbose, debug)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
 		return
 	}
-
-	worker, err := database.GetWorker(db, task.WorkerName, verbose, debug)
-	if err == nil {
-		// Has a worker set, check if its running
-		if task.Status == "running" {
-			// If its runing send stop signal to worker
-			err = utils.SendDeleteTask(db, config, &worker, &task, verbose, debug, writeLock)
-			if err != nil {
-				http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
-				return
-			}
-		}
+	if !checkOwner(w, r, task.Username) {
+		return
 	}
 
-	// Delete task from DB
-	/*err = database.RmTask(db, id, verbose, debug, wg)
+	err = utils.DeleteTask(db, config, &task, verbose, debug, writeLock)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
 		return
-	}*/
-	// Set task as running
-	err = database.SetTaskStatus(db, id, "deleted", verbose, debug)
-	if err != nil {
-		log.Println("Utils Error SetTaskStatus in request:", err)
 	}
 
-	// Return task with deleted status
-	task.Status = "deleted"
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	// Use json.NewEncoder for safe encoding
@@ -228,7 +538,7 @@ func HandleTaskDelete(w http.ResponseWriter, r *http.Request, config *utils.Mana
 }
 
 // HandleTaskStatus Get status of a task
-// @description Get status of a task
+// @description Get status of a task, with the history of its attempts
 // @summary Get status of a task
 // @Tags task
 // @accept application/json
@@ -239,28 +549,336 @@ func HandleTaskDelete(w http.ResponseWriter, r *http.Request, config *utils.Mana
 // @Failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /task/{ID} [get]
-func HandleTaskStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
-	handleEntityStatus(w, r, db, verbose, debug, database.GetTask, "ID")
+func HandleTaskStatus(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if !checkTaskOwner(w, r, db, mux.Vars(r)["ID"], verbose, debug) {
+		return
+	}
+	handleEntityStatus(w, r, verbose, debug, db.GetTaskWithAttempts, "ID")
+}
+
+// HandleTaskGraph Get the dependency graph of a task
+// @description Get the dependency graph of a task, with every task connected to it through dependsOn
+// @summary Get the dependency graph of a task
+// @Tags task
+// @accept application/json
+// @produce application/json
+// @param ID path string true "task ID"
+// @success 200 {object} utils.TaskGraph
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/{ID}/graph [get]
+func HandleTaskGraph(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if !checkTaskOwner(w, r, db, mux.Vars(r)["ID"], verbose, debug) {
+		return
+	}
+	owner := ownerFilter(r)
+	handleEntityStatus(w, r, verbose, debug, func(id string, verbose, debug bool) (utils.TaskGraph, error) {
+		return utils.GetTaskGraph(db, id, owner, verbose, debug)
+	}, "ID")
+}
+
+// HandleTaskOutput Get the output of a command of a task
+// @description Get the output of the command n (starting at 0) of a task, from the result store if it was too big
+// @description to be saved in the database. Use attempt to get the output of a previous attempt.
+// @summary Get the output of a command
+// @Tags task
+// @produce application/octet-stream
+// @param ID path string true "task ID"
+// @param n path int true "command number"
+// @param attempt query int false "attempt number"
+// @success 200 {string} string "output of the command"
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @Failure 404 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/{ID}/output/{n} [get]
+func HandleTaskOutput(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	if !checkTaskOwner(w, r, db, vars["ID"], verbose, debug) {
+		return
+	}
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 0 {
+		http.Error(w, "{ \"error\" : \"Invalid command number\" }", http.StatusBadRequest)
+		return
+	}
+
+	task, err := db.GetTaskWithAttempts(vars["ID"], verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	commands := task.Commands
+	if value := r.URL.Query().Get("attempt"); value != "" {
+		attempt, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "{ \"error\" : \"Invalid attempt\" }", http.StatusBadRequest)
+			return
+		}
+		commands = nil
+		for _, a := range task.Attempts {
+			if a.Attempt == attempt {
+				commands = a.Commands
+			}
+		}
+		if commands == nil {
+			http.Error(w, "{ \"error\" : \"Attempt not found\" }", http.StatusNotFound)
+			return
+		}
+	}
+	if n >= len(commands) {
+		http.Error(w, "{ \"error\" : \"Command not found\" }", http.StatusNotFound)
+		return
+	}
+	command := commands[n]
+
+	if command.OutputKey == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(command.Output)))
+		_, _ = w.Write([]byte(command.Output))
+		return
+	}
+	sendResult(w, config, command.OutputKey, verbose, debug)
+}
+
+// HandleTaskArtifacts Get the artifacts of a task
+// @description Get the files collected by the worker with the artifacts of the task, of every attempt
+// @description or only of the attempt parameter
+// @summary Get the artifacts of a task
+// @Tags task
+// @produce application/json
+// @param ID path string true "task ID"
+// @param attempt query int false "attempt number"
+// @success 200 {array} globalstructs.Artifact
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/{ID}/artifacts [get]
+func HandleTaskArtifacts(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["ID"]
+	owner, err := db.GetTaskUsername(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	if !checkOwner(w, r, owner) {
+		return
+	}
+
+	attempt := queryInt(r, "attempt", 0)
+
+	artifacts, err := db.GetTaskArtifacts(id, attempt, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(artifacts); err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid artifacts encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
 }
 
-// generateRandomID generates a random ID of the specified length
-func generateRandomID(length int, verbose, debug bool) (string, error) {
-	// Calculate the number of bytes needed to achieve the desired length
-	numBytes := length / 2 // Since 1 byte = 2 hex characters
+// HandleTaskArtifact Download an artifact of a task
+// @description Download the artifact n of the current attempt of a task (retries+1), or of the attempt parameter
+// @summary Download an artifact of a task
+// @Tags task
+// @produce application/octet-stream
+// @param ID path string true "task ID"
+// @param n path int true "artifact number"
+// @param attempt query int false "attempt number"
+// @success 200 {string} string "content of the artifact"
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @Failure 404 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/{ID}/artifacts/{n} [get]
+func HandleTaskArtifact(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	if !checkTaskOwner(w, r, db, vars["ID"], verbose, debug) {
+		return
+	}
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 0 {
+		http.Error(w, "{ \"error\" : \"Invalid artifact number\" }", http.StatusBadRequest)
+		return
+	}
+	attempt := queryInt(r, "attempt", 0)
+	if attempt <= 0 {
+		// The current attempt of the task, not the last one with artifacts
+		retries, err := db.GetTaskRetries(vars["ID"], verbose, debug)
+		if err != nil {
+			http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+			return
+		}
+		attempt = retries + 1
+	}
+
+	artifacts, err := db.GetTaskArtifacts(vars["ID"], attempt, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	var artifact *globalstructs.Artifact
+	for i := range artifacts {
+		if artifacts[i].Num == n {
+			artifact = &artifacts[i]
+		}
+	}
+	if artifact == nil {
+		http.Error(w, "{ \"error\" : \"Artifact "+strconv.Itoa(n)+" not found in attempt "+strconv.Itoa(attempt)+"\" }", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(artifact.Path)))
+	sendResult(w, config, artifact.Key, verbose, debug)
+}
 
-	// Generate random bytes
-	randomBytes := make([]byte, numBytes)
-	_, err := rand.Read(randomBytes)
+// sendResult sends the content of the key in the result store
+func sendResult(w http.ResponseWriter, config *utils.ManagerConfig, key string, verbose, debug bool) {
+	result, size, err := config.Results.Open(key)
+	if errors.Is(err, resultstore.ErrNotFound) {
+		http.Error(w, "{ \"error\" : \"Not found in the result store\" }", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		return "", err
+		http.Error(w, "{ \"error\" : \"Error reading the result store: "+err.Error()+"\" }", http.StatusInternalServerError)
+		return
+	}
+	defer result.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if _, err := io.Copy(w, result); err != nil && (verbose || debug) {
+		log.Println("sendResult Error sending", key, err)
+	}
+}
+
+// HandleTaskStream Follow the output of a task
+// @description Follow the output of a task while it runs using Server-Sent Events.
+// @description Each "output" event has a globalstructs.TaskOutput, the "end" event is sent when the task finishes.
+// @description Use the from parameter or the Last-Event-ID header to resume after a seq.
+// @summary Follow the output of a task
+// @Tags task
+// @produce text/event-stream
+// @param ID path string true "task ID"
+// @param from query int false "Send only the chunks after this seq"
+// @success 200 {array} globalstructs.TaskOutput
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /task/{ID}/stream [get]
+func HandleTaskStream(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return
 	}
 
-	// Convert random bytes to hex string
-	randomID := hex.EncodeToString(randomBytes)
+	vars := mux.Vars(r)
+	id := vars["ID"]
+
+	owner, err := db.GetTaskUsername(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	if !checkOwner(w, r, owner) {
+		return
+	}
 
-	if verbose || debug {
-		log.Println("generateRandomID executed", randomID)
+	var lastSeq int64
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		from = r.Header.Get("Last-Event-ID")
 	}
+	if from != "" {
+		seq, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			http.Error(w, "{ \"error\" : \"Invalid from: "+err.Error()+"\" }", http.StatusBadRequest)
+			return
+		}
+		lastSeq = seq
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		// The stream can be longer than the server WriteTimeout
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && debug {
+			log.Println("API HandleTaskStream SetWriteDeadline:", err)
+		}
+
+		// Read the status before the chunks to not lose the last ones
+		_, status, err := db.GetTaskNameStatus(id, verbose, debug)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			rc.Flush()
+			return
+		}
+
+		outputs, err := db.GetTaskOutputs(id, lastSeq, streamBatchSize, verbose, debug)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			rc.Flush()
+			return
+		}
 
-	return randomID, nil
+		for _, output := range outputs {
+			jsonData, err := json.Marshal(output)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: output\ndata: %s\n\n", output.Seq, jsonData)
+			lastSeq = output.Seq
+		}
+
+		if len(outputs) == 0 && status != "pending" && status != "running" {
+			fmt.Fprintf(w, "event: end\ndata: {\"status\": %q}\n\n", status)
+			rc.Flush()
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			if debug {
+				log.Println("API HandleTaskStream Flush:", err)
+			}
+			return
+		}
+
+		if len(outputs) < streamBatchSize {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(streamPollInterval):
+			}
+		}
+	}
 }
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		names []string
+	}{
+		{"array", ` [{"name": "a"}, {"name": "b"}]`, []string{"a", "b"}},
+		{"empty array", `[]`, nil},
+		{"JSON Lines", "{\"name\": \"a\"}\n{\"name\": \"b\"}\n", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		tasks, err := decodeTasks(httptest.NewRequest("POST", "/task/batch", strings.NewReader(tt.body)))
+		if err != nil || len(tasks) != len(tt.names) {
+			t.Errorf("%s: %d tasks, %v, want %d", tt.name, len(tasks), err, len(tt.names))
+			continue
+		}
+		for i, task := range tasks {
+			if task.Name != tt.names[i] {
+				t.Errorf("%s: task %d named %q, want %q", tt.name, i, task.Name, tt.names[i])
+			}
+		}
+	}
+
+	for _, body := range []string{"", `[{"name": "a"}`, `[{"name": 1}]`} {
+		if _, err := decodeTasks(httptest.NewRequest("POST", "/task/batch", strings.NewReader(body))); err == nil {
+			t.Errorf("decodeTasks(%q) returned no error", body)
+		}
+	}
+
+	// the tasks after maxBatchTasks aren't decoded
+	body := "[" + strings.Repeat("{},", maxBatchTasks) + "{}, invalid"
+	if _, err := decodeTasks(httptest.NewRequest("POST", "/task/batch", strings.NewReader(body))); err == nil ||
+		!strings.Contains(err.Error(), "more than") {
+		t.Errorf("decodeTasks of too many tasks = %v, want more than %d tasks", err, maxBatchTasks)
+	}
+}
+
+func TestDecodeTasksMaxBytes(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/task/batch", strings.NewReader(`[{"name": "`+strings.Repeat("a", 100)+`"}]`))
+	r.Body = http.MaxBytesReader(w, r.Body, 50)
+	_, err := decodeTasks(r)
+	if code := bodyErrorCode(err); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("decodeTasks of a big body = %v, status %d, want %d", err, code, http.StatusRequestEntityTooLarge)
+	}
+}
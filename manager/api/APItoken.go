@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// checkAdmin writes an error and returns false if the request is not from an admin
+func checkAdmin(w http.ResponseWriter, r *http.Request, verbose, debug bool) bool {
+	ok, _ := getUsername(r, verbose, debug)
+	if !ok {
+		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
+		return false
+	}
+	if !isAdmin(r) {
+		http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// HandleTokenGet Get all the API tokens
+// @description Get all the API tokens added with the API, without the tokens, only for admins
+// @summary Get all the API tokens
+// @Tags token
+// @accept application/json
+// @produce application/json
+// @success 200 {array} globalstructs.Token
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /token [get]
+func HandleTokenGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if !checkAdmin(w, r, verbose, debug) {
+		return
+	}
+
+	tokens, err := db.GetTokens(verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid GetTokens: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(tokens)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid tokens encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// HandleTokenPost Add a new API token
+// @description Add an API token of a user or a worker, the token is only returned in this response, only for admins
+// @summary Add a new API token
+// @Tags token
+// @accept application/json
+// @produce application/json
+// @param token body globalstructs.TokenSwagger true "Token object to create"
+// @success 200 {object} globalstructs.Token
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /token [post]
+func HandleTokenPost(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if !checkAdmin(w, r, verbose, debug) {
+		return
+	}
+	_, username := getUsername(r, verbose, debug)
+
+	var request globalstructs.Token
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token body: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := checkToken(&request)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+
+	request.ID, err = utils.GenerateRandomID(30, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid ID generated: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+	value, err := utils.GenerateRandomID(64, false, false)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token generated: "+err.Error()+"\"}", http.StatusBadRequest)
+		return
+	}
+	request.Token = value
+	request.CreatedBy = username
+
+	err = db.AddToken(request, expiresAt, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token info: "+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	if verbose {
+		log.Println("API Add Token to DB", request.ID, request.Kind, request.Username)
+	}
+
+	token, err := db.GetToken(request.ID, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token info: "+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+	// The only time the token is returned, the database only has its hash
+	token.Token = value
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(token)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
+
+// checkToken checks the kind, role, scopes and expiresAt of a new API token, returns expiresAt
+func checkToken(token *globalstructs.Token) (*time.Time, error) {
+	if token.Username == "" {
+		return nil, fmt.Errorf("Invalid token: username is required")
+	}
+	switch token.Kind {
+	case "", globalstructs.TokenUser:
+		token.Kind = globalstructs.TokenUser
+		switch token.Role {
+		case "":
+			token.Role = utils.RoleSubmitter
+		case utils.RoleAdmin, utils.RoleSubmitter, utils.RoleReadOnly:
+		default:
+			return nil, fmt.Errorf("Invalid role: %s", token.Role)
+		}
+	case globalstructs.TokenWorker:
+		if token.Role != "" {
+			return nil, fmt.Errorf("Invalid role: the worker tokens don't have role")
+		}
+	default:
+		return nil, fmt.Errorf("Invalid kind: %s", token.Kind)
+	}
+
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	for _, scope := range token.Scopes {
+		if !slices.Contains(globalstructs.TokenScopes, scope) {
+			return nil, fmt.Errorf("Invalid scope: %s", scope)
+		}
+	}
+
+	if token.ExpiresAt == "" {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expiresAt: %s", err.Error())
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("Invalid expiresAt: it is in the past")
+	}
+	return &expiresAt, nil
+}
+
+// HandleTokenDelete Delete an API token
+// @description Delete an API token, the requests with it are rejected from now on, only for admins
+// @summary Delete an API token
+// @Tags token
+// @accept application/json
+// @produce application/json
+// @param ID path string true "token ID"
+// @success 200 {object} globalstructs.Token
+// @Failure 400 {object} globalstructs.Error
+// @Failure 403 {object} globalstructs.Error
+// @security ApiKeyAuth
+// @router /token/{ID} [delete]
+func HandleTokenDelete(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	if !checkAdmin(w, r, verbose, debug) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["ID"]
+
+	token, err := db.GetToken(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	err = db.RmToken(id, verbose, debug)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \""+err.Error()+"\" }", http.StatusBadRequest)
+		return
+	}
+
+	if verbose {
+		log.Println("API Delete Token", id, token.Kind, token.Username)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	// Use json.NewEncoder for safe encoding
+	err = json.NewEncoder(w).Encode(token)
+	if err != nil {
+		http.Error(w, "{ \"error\" : \"Invalid token encode body:"+err.Error()+"\"}", http.StatusBadRequest)
+	}
+}
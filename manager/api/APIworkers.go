@@ -1,7 +1,6 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -28,7 +27,7 @@ import (
 // @failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /worker [get]
-func HandleWorkerGet(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleWorkerGet(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
 	username, ok := r.Context().Value(utils.UsernameKey).(string)
 	if !ok {
 		log.Println("API username", username)
@@ -37,7 +36,7 @@ func HandleWorkerGet(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose
 	}
 
 	// get workers
-	workers, err := database.GetWorkers(db, verbose, debug)
+	workers, err := db.GetWorkers(verbose, debug)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \"Invalid callback body: "+err.Error()+"\"}", http.StatusBadRequest)
 
@@ -77,13 +76,18 @@ func HandleWorkerGet(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose
 // @failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /worker [post]
-func HandleWorkerPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleWorkerPost(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
 	_, okUser := r.Context().Value(utils.UsernameKey).(string)
 	_, okWorker := r.Context().Value(utils.WorkerKey).(string)
 	if !okUser && !okWorker {
 		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
 		return
 	}
+	// Only the admins manage the workers
+	if okUser && !isAdmin(r) {
+		http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
+		return
+	}
 
 	var worker globalstructs.Worker
 
@@ -102,13 +106,13 @@ func HandleWorkerPost(w http.ResponseWriter, r *http.Request, db *sql.DB, verbos
 	w.WriteHeader(http.StatusOK)
 }
 
-func addWorker(worker globalstructs.Worker, db *sql.DB, verbose, debug bool) error {
+func addWorker(worker globalstructs.Worker, db database.Store, verbose, debug bool) error {
 
 	if debug {
 		log.Println("API worker.Name", worker.Name)
 	}
 
-	err := database.AddWorker(db, &worker, verbose, debug)
+	err := db.AddWorker(&worker, verbose, debug)
 	if err != nil {
 		err = utils.HandleAddWorkerError(err, db, &worker, verbose, debug)
 		if err != nil {
@@ -120,7 +124,7 @@ func addWorker(worker globalstructs.Worker, db *sql.DB, verbose, debug bool) err
 }
 
 // HandleWorkerPostWebsocket HandleWorkerPostWebsocket
-func HandleWorkerPostWebsocket(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex) {
+func HandleWorkerPostWebsocket(w http.ResponseWriter, r *http.Request, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
 	_, okWorker := r.Context().Value(utils.WorkerKey).(string)
 	if !okWorker {
 		if verbose {
@@ -144,7 +148,7 @@ func HandleWorkerPostWebsocket(w http.ResponseWriter, r *http.Request, config *u
 	}
 
 	//go
-	websockets.GetWorkerMessage(conn, config, db, verbose, debug)
+	websockets.GetWorkerMessage(conn, config, db, verbose, debug, writeLock)
 
 }
 
@@ -160,18 +164,23 @@ func HandleWorkerPostWebsocket(w http.ResponseWriter, r *http.Request, config *u
 // @failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /worker/{NAME} [delete]
-func HandleWorkerDeleteName(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
+func HandleWorkerDeleteName(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
 	_, okUser := r.Context().Value(utils.UsernameKey).(string)
 	_, okWorker := r.Context().Value(utils.WorkerKey).(string)
 	if !okUser && !okWorker {
 		http.Error(w, "{ \"error\" : \"Unauthorized\" }", http.StatusUnauthorized)
 		return
 	}
+	// Only the admins manage the workers
+	if okUser && !isAdmin(r) {
+		http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
+		return
+	}
 
 	vars := mux.Vars(r)
 	name := vars["NAME"]
 
-	err := database.RmWorkerName(db, name, verbose, debug)
+	err := db.RmWorkerName(name, verbose, debug)
 	if err != nil {
 		http.Error(w, "{ \"error\" : \"RmWorkerName: "+err.Error()+"\"}", http.StatusBadRequest)
 
@@ -195,8 +204,8 @@ func HandleWorkerDeleteName(w http.ResponseWriter, r *http.Request, db *sql.DB,
 // @failure 403 {object} globalstructs.Error
 // @security ApiKeyAuth
 // @router /worker/{NAME} [get]
-func HandleWorkerStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, verbose, debug bool) {
-	handleEntityStatus(w, r, db, verbose, debug, database.GetWorker, "NAME")
+func HandleWorkerStatus(w http.ResponseWriter, r *http.Request, db database.Store, verbose, debug bool) {
+	handleEntityStatus(w, r, verbose, debug, db.GetWorker, "NAME")
 }
 
 // Other functions
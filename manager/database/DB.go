@@ -9,10 +9,8 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"strings"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	globalstructs "github.com/r4ulcl/nTask/globalstructs"
 )
 
@@ -39,91 +37,48 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-var sqlInit = `
-CREATE TABLE IF NOT EXISTS worker (
-    name VARCHAR(255) PRIMARY KEY,
-    DefaultThreads INT,
-    IddleThreads INT,
-    up BOOLEAN,
-    downCount INT,
-    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS task (
-    ID VARCHAR(255) PRIMARY KEY,
-    notes LONGTEXT,
-    commands LONGTEXT,
-    files LONGTEXT,
-    name TEXT,
-    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    executedAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01',
-    status VARCHAR(255),
-    duration INT DEFAULT 0,
-    workerName VARCHAR(255),
-    username VARCHAR(255),
-    priority INT DEFAULT 0,
-    timeout INT DEFAULT 0,
-    callbackURL TEXT,
-    callbackToken TEXT,
-    INDEX idx_status (status)
-);
-`
-
-// ConnectDB creates a new Manager instance and initializes the database connection.
-// It takes the username, password, host, port, and database name as input.
-// It returns a pointer to the sql.DB object and an error if the connection fails.
-func ConnectDB(username, password, host, port, database string, verbose, debug bool) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local&clientFoundRows=true",
-		username,
-		password,
-		host,
-		port,
-		database,
-	)
-	if debug {
-		log.Println("DB ConnectDB - DSN:", dsn)
-	}
+// DB is the SQL store of the manager, the connection pool and the backend of its database.
+// Its methods are the Store of the tasks, workers and the rest of the data of the manager
+type DB struct {
+	*sql.DB
+	backend Backend
+}
+
+// Tx is a transaction of a DB, with the backend that converts its queries
+type Tx struct {
+	*sql.Tx
+	backend Backend
+}
 
-	db, err := sql.Open("mysql", dsn)
+// ConnectDB creates a new Manager instance and opens the database connection, the schema is
+// created and updated by Migrate.
+// It takes the backend (mysql, postgres or sqlite), username, password, host, port, and database name as input,
+// for sqlite the database is the path of the file.
+// It returns the store of the backend and an error if the connection fails.
+func ConnectDB(driver, username, password, host, port, database string, verbose, debug bool) (*DB, error) {
+	backend, err := getBackend(driver)
 	if err != nil {
 		return nil, err
 	}
-	// pool sizing
-	db.SetMaxOpenConns(dbMaxOpenConns)
-	db.SetMaxIdleConns(dbMaxIdleConns)
-	db.SetConnMaxLifetime(dbConnMaxLifetime)
 
-	if err := db.Ping(); err != nil {
+	sqlDB, err := backend.Open(username, password, host, port, database, debug)
+	if err != nil {
 		return nil, err
 	}
+	// pool sizing
+	sqlDB.SetMaxOpenConns(dbMaxOpenConns)
+	sqlDB.SetMaxIdleConns(dbMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(dbConnMaxLifetime)
 
-	if err := initFromVar(db, verbose, debug); err != nil {
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, err
 	}
-	return db, nil
+	return &DB{DB: sqlDB, backend: backend}, nil
 }
 
-func initFromVar(db *sql.DB, verbose, debug bool) error {
-	stmts := strings.Split(sqlInit, ";")
-	if verbose || debug {
-		log.Println("initFromVar: applying schema")
-	}
-	for _, s := range stmts {
-		s = strings.TrimSpace(s)
-		if s == "" {
-			continue
-		}
-		if _, err := db.Exec(s); err != nil {
-			return fmt.Errorf("initFromVar executing %q: %w", s, err)
-		}
-	}
-	return nil
-}
-
-// execWithRetry wraps db.Exec to retry on MySQL deadlock (Error 1213).
-func execWithRetry(db *sql.DB, isInsert bool, query string, args ...interface{}) (sql.Result, error) {
+// execWithRetry wraps db.Exec to retry on deadlock.
+func execWithRetry(db *DB, isInsert bool, query string, args ...interface{}) (sql.Result, error) {
 
 	// pick the semaphore based on the isInsert flag
 	dbSemaphore := generalSemaphore
@@ -140,12 +95,12 @@ func execWithRetry(db *sql.DB, isInsert bool, query string, args ...interface{})
 		var res sql.Result
 		// Attach a short context so the query does not block forever if the connection freezes.
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		res, err = db.ExecContext(ctx, query, args...)
+		res, err = db.ExecContext(ctx, db.backend.Rebind(query), bindArgs(db.backend, args)...)
 		cancel()
 		if err == nil {
 			return res, nil
 		}
-		if merr, ok := err.(*mysql.MySQLError); ok && merr.Number == 1213 { // deadlock found
+		if db.backend.IsDeadlock(err) {
 			time.Sleep(backOff)
 			backOff *= 2
 			continue
@@ -155,6 +110,75 @@ func execWithRetry(db *sql.DB, isInsert bool, query string, args ...interface{})
 	return nil, fmt.Errorf("deadlock after %d retries for query %q: %w", maxRetries, query, err)
 }
 
+// txWithRetry runs fn inside a transaction, committing it if fn succeeds.
+// The whole transaction is retried on deadlock like execWithRetry.
+func txWithRetry(db *DB, fn func(tx *Tx) error) error {
+	insertSemaphore <- struct{}{}
+	defer func() { <-insertSemaphore }()
+
+	var err error
+	backOff := initialBackOff
+	for i := 0; i < maxRetries; i++ {
+		err = runTx(db, fn)
+		if err == nil {
+			return nil
+		}
+		if db.backend.IsDeadlock(err) {
+			time.Sleep(backOff)
+			backOff *= 2
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("deadlock after %d retries: %w", maxRetries, err)
+}
+
+func runTx(db *DB, fn func(tx *Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	sqlTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{Tx: sqlTx, backend: db.backend}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// dbQuery runs a query with the placeholders of the backend
+func dbQuery(db *DB, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Query(db.backend.Rebind(query), bindArgs(db.backend, args)...)
+}
+
+// dbQueryRow runs a query that returns one row with the placeholders of the backend
+func dbQueryRow(db *DB, query string, args ...interface{}) *sql.Row {
+	return db.QueryRow(db.backend.Rebind(query), bindArgs(db.backend, args)...)
+}
+
+// txExec runs a statement in a transaction with the placeholders of the backend
+func txExec(tx *Tx, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Exec(tx.backend.Rebind(query), bindArgs(tx.backend, args)...)
+}
+
+// txQuery runs a query in a transaction with the placeholders of the backend
+func txQuery(tx *Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Query(tx.backend.Rebind(query), bindArgs(tx.backend, args)...)
+}
+
+// txQueryRow runs a query that returns one row in a transaction with the placeholders of the backend
+func txQueryRow(tx *Tx, query string, args ...interface{}) *sql.Row {
+	return tx.QueryRow(tx.backend.Rebind(query), bindArgs(tx.backend, args)...)
+}
+
+// IsDuplicateKeyError returns true if the error is an insert of a primary key that already exists
+func (db *DB) IsDuplicateKeyError(err error) bool {
+	return err != nil && db.backend.IsDuplicateKey(err)
+}
+
 // serializeToJSON marshals a slice into a JSON string.
 func serializeToJSON(v any) (string, error) {
 	b, err := json.Marshal(v)
@@ -164,18 +188,39 @@ func serializeToJSON(v any) (string, error) {
 	return string(b), nil
 }
 
+// serializeCommands marshals the commands without their Output, it is built from
+// the stdout and stderr when they are read
+func serializeCommands(commands []globalstructs.Command) (string, error) {
+	if commands == nil {
+		return serializeToJSON(commands)
+	}
+	stored := make([]globalstructs.Command, len(commands))
+	for i, command := range commands {
+		// the Output of the tasks saved before it was built is kept
+		if command.Output == command.CombinedOutput() {
+			command.Output = ""
+		}
+		stored[i] = command
+	}
+	return serializeToJSON(stored)
+}
+
 // prepareTaskQuery prepare task insertion or update in the database.
-func prepareTaskQuery(task globalstructs.Task, verbose, debug bool) (commandJSON, filesJSON string, err error) {
-	commandJSON, err = serializeToJSON(task.Commands)
+func prepareTaskQuery(task globalstructs.Task, verbose, debug bool) (commandJSON, filesJSON, dependsOnJSON string, err error) {
+	commandJSON, err = serializeCommands(task.Commands)
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
 	}
 	filesJSON, err = serializeToJSON(task.Files)
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
+	}
+	dependsOnJSON, err = serializeToJSON(task.DependsOn)
+	if err != nil {
+		return "", "", "", err
 	}
 	if verbose || debug {
-		log.Printf("prepareTaskQuery: filesJSON=%s commandJSON=%s", filesJSON, commandJSON)
+		log.Printf("prepareTaskQuery: filesJSON=%s commandJSON=%s dependsOnJSON=%s", filesJSON, commandJSON, dependsOnJSON)
 	}
 	return
 }
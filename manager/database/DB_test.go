@@ -0,0 +1,647 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+// migratedTestDB returns an empty database with every migration applied
+func migratedTestDB(t *testing.T) *DB {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := db.Migrate(false, false, false); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func testTask(id string, priority int) globalstructs.Task {
+	return globalstructs.Task{
+		ID:       id,
+		Name:     "task " + id,
+		Status:   "pending",
+		Username: "user",
+		Priority: priority,
+		Queue:    "default",
+		Commands: []globalstructs.Command{{Module: "exec", Args: "echo " + id}},
+		Files:    []globalstructs.File{},
+	}
+}
+
+func mustAddTask(t *testing.T, db *DB, task globalstructs.Task) {
+	t.Helper()
+	if err := db.AddTask(task, 0, false, false); err != nil {
+		t.Fatalf("AddTask %s: %v", task.ID, err)
+	}
+}
+
+func taskIDs(tasks []globalstructs.Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func pendingIDs(t *testing.T, db *DB, limit int, skip PendingSkip) []string {
+	t.Helper()
+	tasks, err := db.GetTasksPending(limit, 0, skip, false, false)
+	if err != nil {
+		t.Fatalf("GetTasksPending: %v", err)
+	}
+	return taskIDs(tasks)
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	version, err := db.SchemaVersion(false, false)
+	if err != nil || version != 0 {
+		t.Fatalf("SchemaVersion of an empty database = %d, %v, want 0", version, err)
+	}
+
+	list, err := migrations(db.backend.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := db.Migrate(false, false, false)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) != len(list) {
+		t.Fatalf("Migrate applied %d migrations, want %d", len(applied), len(list))
+	}
+	if version, err = db.SchemaVersion(false, false); err != nil || version != len(list) {
+		t.Fatalf("SchemaVersion = %d, %v, want %d", version, err, len(list))
+	}
+
+	// Applying them again does nothing
+	if applied, err = db.Migrate(false, false, false); err != nil || len(applied) != 0 {
+		t.Fatalf("second Migrate applied %d migrations, %v", len(applied), err)
+	}
+
+	// A migration applied by another manager meanwhile is skipped
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := applyMigration(context.Background(), conn, db.backend, list[len(list)-1])
+	conn.Close()
+	if err != nil || ok {
+		t.Errorf("applyMigration of an applied migration = %v, %v, want skipped", ok, err)
+	}
+
+	// Only a missing schema_version table is version 0
+	db.Close()
+	if version, err = db.SchemaVersion(false, false); err == nil {
+		t.Errorf("SchemaVersion of a closed database = %d, want an error", version)
+	}
+}
+
+func TestGetTasksPending(t *testing.T) {
+	db := migratedTestDB(t)
+
+	low := testTask("low", 1)
+	high := testTask("high", 10)
+	high.Queue = "scans"
+	limited := testTask("limited", 5)
+	limited.RateKey = "example.com"
+	for _, task := range []globalstructs.Task{low, high, limited} {
+		mustAddTask(t, db, task)
+	}
+	running := testTask("running", 20)
+	running.Status = "running"
+	mustAddTask(t, db, running)
+
+	if got := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(got, []string{"high", "limited", "low"}) {
+		t.Errorf("pending = %v, want by priority", got)
+	}
+	if got := pendingIDs(t, db, 2, PendingSkip{}); !slices.Equal(got, []string{"high", "limited"}) {
+		t.Errorf("pending with limit 2 = %v", got)
+	}
+	skip := PendingSkip{Queues: []string{"scans"}, RateKeys: []string{"example.com"}}
+	if got := pendingIDs(t, db, 10, skip); !slices.Equal(got, []string{"low"}) {
+		t.Errorf("pending without full queues and rate keys = %v, want [low]", got)
+	}
+
+	if got := pendingIDs(t, db, 10, PendingSkip{IdleWorkers: []string{"worker1"}}); !slices.Equal(got, []string{"high", "limited", "low"}) {
+		t.Errorf("pending for worker1 = %v", got)
+	}
+	pinned := testTask("pinned", 30)
+	pinned.WorkerName = "worker2"
+	mustAddTask(t, db, pinned)
+	if got := pendingIDs(t, db, 10, PendingSkip{IdleWorkers: []string{"worker1"}}); slices.Contains(got, "pinned") {
+		t.Errorf("pending for worker1 = %v, want without the task of worker2", got)
+	}
+	if got := pendingIDs(t, db, 1, PendingSkip{IdleWorkers: []string{"worker2"}}); !slices.Equal(got, []string{"pinned"}) {
+		t.Errorf("pending for worker2 = %v, want [pinned]", got)
+	}
+	if got, err := db.GetTasksPending(2, 2, PendingSkip{}, false, false); err != nil || !slices.Equal(taskIDs(got), []string{"limited", "low"}) {
+		t.Errorf("pending from offset 2 = %v, %v, want [limited low]", taskIDs(got), err)
+	}
+
+	for _, task := range []globalstructs.Task{testTask("other1", 50), testTask("other2", 0)} {
+		task.Username = "other"
+		mustAddTask(t, db, task)
+	}
+	tests := []struct {
+		limit     int
+		offsets   map[string]int
+		skipUsers []string
+		want      []string
+	}{
+		{2, nil, nil, []string{"other1", "other2", "pinned", "high"}},
+		{2, map[string]int{"user": 2}, nil, []string{"other1", "other2", "limited", "low"}},
+		{10, map[string]int{"user": 3, "other": 0}, []string{"other"}, []string{"low"}},
+	}
+	for _, tt := range tests {
+		tasks, err := db.GetTasksPendingByUser(tt.limit, tt.offsets, tt.skipUsers, PendingSkip{}, false, false)
+		if got := taskIDs(tasks); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("GetTasksPendingByUser(%d, %v, %v) = %v, %v, want %v", tt.limit, tt.offsets, tt.skipUsers, got, err, tt.want)
+		}
+	}
+}
+
+func TestAddTaskDependencies(t *testing.T) {
+	db := migratedTestDB(t)
+
+	mustAddTask(t, db, testTask("parent", 0))
+	child := testTask("child", 100)
+	child.DependsOn = []string{"parent"}
+	mustAddTask(t, db, child)
+
+	if got := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(got, []string{"parent"}) {
+		t.Fatalf("pending with parent pending = %v, want [parent]", got)
+	}
+	deps, err := db.GetTaskDependencies("child", false, false)
+	if err != nil || !slices.Equal(deps, []string{"parent"}) {
+		t.Fatalf("GetTaskDependencies = %v, %v", deps, err)
+	}
+
+	if err := db.SetTaskStatus("parent", "done", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(got, []string{"child"}) {
+		t.Errorf("pending with parent done = %v, want [child]", got)
+	}
+
+	// A parent trimmed from the history was done
+	if err := db.RmTask("parent", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(got, []string{"child"}) {
+		t.Errorf("pending with parent deleted = %v, want [child]", got)
+	}
+}
+
+func TestAddTaskFailedParent(t *testing.T) {
+	db := migratedTestDB(t)
+
+	mustAddTask(t, db, testTask("parent", 0))
+	if err := db.SetTaskStatus("parent", "failed", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent failed after the API checked it
+	child := testTask("child", 0)
+	child.DependsOn = []string{"parent"}
+	mustAddTask(t, db, child)
+	if task, err := db.GetTask("child", false, false); err != nil || task.Status != "skipped" {
+		t.Errorf("child of a failed parent: status %s, %v, want skipped", task.Status, err)
+	}
+
+	// Every task of a job with a failed parent is skipped
+	job := globalstructs.Job{ID: "job", Kind: "batch", Username: "user"}
+	first, second := testTask("first", 0), testTask("second", 0)
+	first.DependsOn = []string{"parent"}
+	second.DependsOn = []string{"parent"}
+	if err := db.AddJob(job, []globalstructs.Task{first, second}, 0, false, false); err != nil {
+		t.Fatalf("AddJob: %v", err)
+	}
+	for _, id := range []string{"first", "second"} {
+		if task, err := db.GetTask(id, false, false); err != nil || task.Status != "skipped" {
+			t.Errorf("%s: status %s, %v, want skipped", id, task.Status, err)
+		}
+	}
+
+	// A task whose dependencies can't be added isn't added
+	broken := testTask("broken", 0)
+	broken.DependsOn = []string{"parent", "parent"}
+	if err := db.AddTask(broken, 0, false, false); err == nil {
+		t.Fatal("AddTask with a duplicated dependency returned no error")
+	}
+	if _, err := db.GetTask("broken", false, false); err == nil {
+		t.Error("task broken was added without its dependencies")
+	}
+}
+
+func TestRetryTask(t *testing.T) {
+	db := migratedTestDB(t)
+
+	mustAddTask(t, db, testTask("task", 0))
+	if err := db.SetTaskStatus("task", "running", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetTaskExecutedAtNow("task", false, false); err != nil {
+		t.Fatal(err)
+	}
+	// CURRENT_TIMESTAMP and the Go times are compared in the same time zone
+	started, err := db.CountTasksStartedByUser(time.Now().Add(-time.Minute), false, false)
+	if err != nil || started["user"] != 1 {
+		t.Errorf("CountTasksStartedByUser = %v, %v, want 1 task of user", started, err)
+	}
+	if started, err = db.CountTasksStartedByUser(time.Now().Add(time.Minute), false, false); err != nil || len(started) != 0 {
+		t.Errorf("CountTasksStartedByUser in a minute = %v, %v, want none", started, err)
+	}
+
+	result := testTask("task", 0)
+	result.Status = "running"
+	result.WorkerName = "worker1"
+	if err := db.UpdateTask(result, false, false); err != nil {
+		t.Fatal(err)
+	}
+	result.Status = "failed"
+	result.Duration = 1.5
+	result.ArtifactFiles = []globalstructs.Artifact{{Path: "out.txt", Size: 3}}
+	if saved, err := db.SaveTaskResult(result, "worker2", false, false); err != nil || saved {
+		t.Errorf("SaveTaskResult of another worker = %v, %v, want not saved", saved, err)
+	}
+	if saved, err := db.SaveTaskResult(result, "worker1", false, false); err != nil || !saved {
+		t.Fatalf("SaveTaskResult = %v, %v, want saved", saved, err)
+	}
+	if saved, err := db.SaveTaskResult(result, "worker1", false, false); err != nil || saved {
+		t.Errorf("SaveTaskResult sent again = %v, %v, want not saved", saved, err)
+	}
+	if artifacts, err := db.GetTaskArtifacts("task", 1, false, false); err != nil || len(artifacts) != 1 {
+		t.Errorf("artifacts of attempt 1 = %+v, %v, want 1", artifacts, err)
+	}
+
+	if err := db.RetryTask("task", 3600, false, false); err != nil {
+		t.Fatalf("RetryTask: %v", err)
+	}
+	if got := pendingIDs(t, db, 10, PendingSkip{}); len(got) != 0 {
+		t.Errorf("pending during the backoff = %v, want none", got)
+	}
+
+	task, err := db.GetTaskWithAttempts("task", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != "pending" || task.Retries != 1 {
+		t.Errorf("task after RetryTask: status %s retries %d, want pending 1", task.Status, task.Retries)
+	}
+	if retries, err := db.GetTaskRetries("task", false, false); err != nil || retries != 1 {
+		t.Errorf("GetTaskRetries = %d, %v, want 1", retries, err)
+	}
+	if len(task.Attempts) != 1 || task.Attempts[0].Attempt != 1 || task.Attempts[0].WorkerName != "worker1" ||
+		task.Attempts[0].Status != "failed" {
+		t.Errorf("attempts = %+v, want the failed attempt 1 of worker1", task.Attempts)
+	}
+
+	if err := db.RetryTask("task", 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(got, []string{"task"}) {
+		t.Errorf("pending after the backoff = %v, want [task]", got)
+	}
+
+	if err := db.RetryTask("missing", 0, false, false); err == nil {
+		t.Error("RetryTask of a missing task returned no error")
+	}
+}
+
+func TestRetryTaskPinnedWorker(t *testing.T) {
+	db := migratedTestDB(t)
+
+	pinned := testTask("pinned", 0)
+	pinned.WorkerName = "worker1"
+	mustAddTask(t, db, pinned)
+	mustAddTask(t, db, testTask("free", 0))
+
+	for _, id := range []string{"pinned", "free"} {
+		task, err := db.GetTask(id, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.Status = "running"
+		task.WorkerName = "worker1"
+		if err := db.UpdateTask(task, false, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RetryTask(id, 0, false, false); err != nil {
+			t.Fatalf("RetryTask %s: %v", id, err)
+		}
+	}
+
+	for id, want := range map[string]string{"pinned": "worker1", "free": ""} {
+		task, err := db.GetTask(id, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.WorkerName != want {
+			t.Errorf("WorkerName of %s after RetryTask = %q, want %q", id, task.WorkerName, want)
+		}
+	}
+}
+
+func TestAddJob(t *testing.T) {
+	db := migratedTestDB(t)
+
+	job := globalstructs.Job{ID: "job", Kind: "batch", Username: "user"}
+	var tasks []globalstructs.Task
+	for _, id := range []string{"a", "b", "c"} {
+		task := testTask(id, 0)
+		task.GroupID = job.ID
+		tasks = append(tasks, task)
+	}
+	tasks[2].DependsOn = []string{"a", "b"}
+	if err := db.AddJob(job, tasks, 0, false, false); err != nil {
+		t.Fatalf("AddJob: %v", err)
+	}
+
+	got, err := db.GetJob(job.ID, false, false)
+	if err != nil || got.Total != 3 {
+		t.Fatalf("GetJob = %+v, %v, want 3 tasks", got, err)
+	}
+	if ids := pendingIDs(t, db, 10, PendingSkip{}); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Errorf("pending = %v, want [a b]", ids)
+	}
+
+	// The whole job is rolled back if a task can't be added
+	dup := globalstructs.Job{ID: "dup", Kind: "batch", Username: "user"}
+	if err := db.AddJob(dup, []globalstructs.Task{testTask("d", 0), testTask("a", 0)}, 0, false, false); err == nil {
+		t.Fatal("AddJob with a duplicated task returned no error")
+	}
+	if _, err := db.GetTask("d", false, false); err == nil {
+		t.Error("task d of the failed job was added")
+	}
+}
+
+func TestGetTasksFilters(t *testing.T) {
+	db := migratedTestDB(t)
+
+	mustAddTask(t, db, testTask("one", 0))
+	other := testTask("two", 0)
+	other.Username = "other"
+	mustAddTask(t, db, other)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	r := httptest.NewRequest("GET", "/task?createdAt="+today+"%25&status=pending", nil)
+	tasks, err := db.GetTasks(r, "", false, false)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("GetTasks by createdAt = %v, %v, want 2 tasks", taskIDs(tasks), err)
+	}
+	if tasks, err = db.GetTasks(r, "other", false, false); err != nil || !slices.Equal(taskIDs(tasks), []string{"two"}) {
+		t.Errorf("GetTasks of other = %v, %v, want [two]", taskIDs(tasks), err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	db := migratedTestDB(t)
+
+	expired := time.Now().Add(-time.Hour)
+	tokens := []struct {
+		token     globalstructs.Token
+		expiresAt *time.Time
+	}{
+		{globalstructs.Token{ID: "valid", Token: "secret1", Kind: globalstructs.TokenUser, Username: "user",
+			Role: "submitter", Scopes: []string{}}, nil},
+		{globalstructs.Token{ID: "expired", Token: "secret2", Kind: globalstructs.TokenUser, Username: "user",
+			Role: "submitter", Scopes: []string{}}, &expired},
+	}
+	for _, tt := range tokens {
+		if err := db.AddToken(tt.token, tt.expiresAt, false, false); err != nil {
+			t.Fatalf("AddToken %s: %v", tt.token.ID, err)
+		}
+	}
+
+	token, err := db.GetTokenByValue("secret1", time.Now(), false, false)
+	if err != nil || token.ID != "valid" {
+		t.Errorf("GetTokenByValue = %+v, %v, want the valid token", token, err)
+	}
+	if _, err = db.GetTokenByValue("secret2", time.Now(), false, false); err == nil {
+		t.Error("GetTokenByValue returned the expired token")
+	}
+	if err = db.SetTokenLastUsed("valid", time.Now(), false, false); err != nil {
+		t.Errorf("SetTokenLastUsed: %v", err)
+	}
+}
+
+func TestAddTaskOutput(t *testing.T) {
+	db := migratedTestDB(t)
+
+	task := testTask("task", 0)
+	task.Status = "running"
+	task.WorkerName = "worker1"
+	mustAddTask(t, db, task)
+	mustAddTask(t, db, testTask("pending", 0))
+
+	output := globalstructs.TaskOutput{ID: "task", Stream: "stdout", Data: "ñ€"}
+	if err := db.AddTaskOutput("worker1", output, false, false); err != nil {
+		t.Fatalf("AddTaskOutput: %v", err)
+	}
+	// only the worker running the task sends its output
+	if err := db.AddTaskOutput("worker2", output, false, false); err == nil {
+		t.Error("AddTaskOutput of another worker returned no error")
+	}
+	output.ID = "pending"
+	if err := db.AddTaskOutput("worker1", output, false, false); err == nil {
+		t.Error("AddTaskOutput of a pending task returned no error")
+	}
+
+	outputs, err := db.GetTaskOutputs("task", 0, 10, false, false)
+	if err != nil || len(outputs) != 1 || outputs[0].Data != "ñ€" {
+		t.Errorf("GetTaskOutputs = %+v, %v, want the chunk of worker1", outputs, err)
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	db := migratedTestDB(t)
+
+	task := testTask("task", 0)
+	task.Commands = []globalstructs.Command{{Module: "test", Stdout: "out", Stderr: "err"}, {Module: "test", Stderr: "err"}}
+	mustAddTask(t, db, task)
+
+	// the output is built from the stdout and stderr, it isn't stored when the task read is saved again
+	task.Commands[0].Output = "out\nerr"
+	if err := db.UpdateTask(task, false, false); err != nil {
+		t.Fatal(err)
+	}
+	var commands string
+	if err := db.QueryRow("SELECT commands FROM task WHERE ID = 'task'").Scan(&commands); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(commands, "out\\nerr") {
+		t.Errorf("commands saved with the output: %s", commands)
+	}
+	got, err := db.GetTask("task", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"out\nerr", "err"} {
+		if got.Commands[i].Output != want {
+			t.Errorf("command %d output %q, want %q", i, got.Commands[i].Output, want)
+		}
+	}
+}
+
+func TestGetTasksCommandFilters(t *testing.T) {
+	db := migratedTestDB(t)
+
+	one, failed := 1, -1
+	for _, task := range []globalstructs.Task{testTask("done", 0), testTask("failed", 0), testTask("pending", 0)} {
+		mustAddTask(t, db, task)
+	}
+	done := testTask("done", 0)
+	done.Status = "done"
+	done.Commands = []globalstructs.Command{{Module: "exec", Status: "done", ExitCode: &one}}
+	// the status isn't followed by the exit code in the JSON of a command without one
+	failedTask := testTask("failed", 0)
+	failedTask.Status = "failed"
+	failedTask.Commands = []globalstructs.Command{
+		{Module: "exec", Status: "skipped"},
+		{Module: "exec", Status: "failed", ExitCode: &failed},
+	}
+	for _, task := range []globalstructs.Task{done, failedTask} {
+		if err := db.UpdateTask(task, false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"commandStatus=done", []string{"done"}},
+		{"commandStatus=skipped", []string{"failed"}},
+		{"exitCode=%2B1", []string{"done"}},
+		{"exitCode=-1", []string{"failed"}},
+		{"commandStatus=failed&exitCode=-1", []string{"failed"}},
+		{"commandStatus=failed&exitCode=1", nil},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/task?"+tt.query, nil)
+		tasks, err := db.GetTasks(r, "", false, false)
+		if got := taskIDs(tasks); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("GetTasks(%s) = %v, %v, want %v", tt.query, got, err, tt.want)
+		}
+	}
+
+	// the manager fills task_command with the commands of the tasks saved before migration 10
+	if _, err := db.Exec("DELETE FROM task_command"); err != nil {
+		t.Fatal(err)
+	}
+	batches := 0
+	for done := false; !done; batches++ {
+		var err error
+		if done, err = db.BackfillTaskCommands(1, false, false); err != nil {
+			t.Fatalf("BackfillTaskCommands: %v", err)
+		}
+	}
+	if batches != 4 {
+		t.Errorf("BackfillTaskCommands of 3 tasks in batches of 1 = %d batches, want 4", batches)
+	}
+	if done, err := db.BackfillTaskCommands(1, false, false); err != nil || !done {
+		t.Errorf("BackfillTaskCommands after it finished = %v, %v, want done", done, err)
+	}
+	r := httptest.NewRequest("GET", "/task?commandStatus=failed&exitCode=-1", nil)
+	if tasks, err := db.GetTasks(r, "", false, false); err != nil || !slices.Equal(taskIDs(tasks), []string{"failed"}) {
+		t.Errorf("GetTasks after the backfill = %v, %v, want [failed]", taskIDs(tasks), err)
+	}
+}
+
+func TestGetTasksStatus(t *testing.T) {
+	db := migratedTestDB(t)
+
+	var ids []string
+	for i := 0; i < addTasksChunk+1; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	mustAddTask(t, db, testTask(ids[0], 0))
+	mustAddTask(t, db, testTask(ids[addTasksChunk], 0))
+
+	tasks, err := db.GetTasksStatus(ids, false, false)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("GetTasksStatus = %v, %v, want 2 tasks", tasks, err)
+	}
+	if task := tasks[ids[addTasksChunk]]; task.Status != "pending" || task.Username != "user" {
+		t.Errorf("task of the second chunk = %+v, want pending of user", task)
+	}
+}
+
+func TestAddTaskQuota(t *testing.T) {
+	db := migratedTestDB(t)
+
+	// the tasks added at the same time count the ones of the others
+	const maxPending = 3
+	errs := make(chan error, 2*maxPending)
+	for i := 0; i < 2*maxPending; i++ {
+		go func() {
+			errs <- db.AddTask(testTask(strconv.Itoa(i), 0), maxPending, false, false)
+		}()
+	}
+	added := 0
+	for i := 0; i < 2*maxPending; i++ {
+		var quotaErr *QuotaError
+		if err := <-errs; err == nil {
+			added++
+		} else if !errors.As(err, &quotaErr) {
+			t.Errorf("AddTask: %v, want a QuotaError", err)
+		}
+	}
+	if added != maxPending {
+		t.Errorf("added %d tasks, want %d", added, maxPending)
+	}
+
+	other := testTask("other", 0)
+	other.Username = "other"
+	if err := db.AddTask(other, maxPending, false, false); err != nil {
+		t.Errorf("AddTask of other user: %v", err)
+	}
+	job := globalstructs.Job{ID: "job", Kind: "batch", Username: "other"}
+	tasks := []globalstructs.Task{testTask("a", 0), testTask("b", 0), testTask("c", 0)}
+	for i := range tasks {
+		tasks[i].Username, tasks[i].GroupID = "other", "job"
+	}
+	var quotaErr *QuotaError
+	if err := db.AddJob(job, tasks, maxPending, false, false); !errors.As(err, &quotaErr) || quotaErr.Pending != 1 {
+		t.Errorf("AddJob over the quota = %v, want 1 of %d pending tasks", err, maxPending)
+	}
+}
+
+func TestDeleteMaxEntriesHistory(t *testing.T) {
+	db := migratedTestDB(t)
+	for i := 0; i < 4; i++ {
+		id := "done" + strconv.Itoa(i)
+		mustAddTask(t, db, testTask(id, 0))
+		if err := db.SetTaskStatus(id, "done", false, false); err != nil {
+			t.Fatal(err)
+		}
+		// createdAt has a precision of seconds in MySQL
+		if _, err := execWithRetry(db, false, "UPDATE task SET createdAt = ? WHERE ID = ?", time.Now().Add(time.Duration(i-10)*time.Minute), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustAddTask(t, db, testTask("pending", 0))
+
+	ids, err := db.DeleteMaxEntriesHistory(2, "task", false, false)
+	if err != nil || !slices.Equal(ids, []string{"done0", "done1"}) {
+		t.Errorf("DeleteMaxEntriesHistory = %v, %v, want the 2 oldest done tasks", ids, err)
+	}
+	for _, id := range []string{"done2", "done3", "pending"} {
+		if _, err := db.GetTask(id, false, false); err != nil {
+			t.Errorf("GetTask %s after DeleteMaxEntriesHistory: %v", id, err)
+		}
+	}
+	if ids, err = db.DeleteMaxEntriesHistory(2, "task", false, false); err != nil || len(ids) != 0 {
+		t.Errorf("DeleteMaxEntriesHistory again = %v, %v, want none", ids, err)
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+// AddJob adds a job and its tasks to the database in a single transaction,
+// the groupID of the tasks must be the ID of the job.
+func (db *DB) AddJob(job globalstructs.Job, tasks []globalstructs.Task, maxPending int, verbose, debug bool) error {
+	const q = `INSERT INTO job (ID, kind, username, total) VALUES (?, ?, ?, ?)`
+	err := txWithRetry(db, func(tx *Tx) error {
+		if err := checkQuotaTx(tx, job.Username, len(tasks), maxPending); err != nil {
+			return err
+		}
+		if _, err := txExec(tx, q, job.ID, job.Kind, job.Username, len(tasks)); err != nil {
+			return err
+		}
+		return addTasksTx(tx, tasks, verbose, debug)
+	})
+	if err != nil {
+		return fmt.Errorf("AddJob: %w", err)
+	}
+	if debug {
+		log.Println("AddJob", job.ID, "added", len(tasks), "tasks")
+	}
+	return nil
+}
+
+// GetJobs returns all the jobs without their status, only the ones of owner if it is not empty
+func (db *DB) GetJobs(owner string, page, limit int, verbose, debug bool) ([]globalstructs.Job, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultSelectLimit
+	}
+	q := `SELECT ID, kind, username, createdAt, total FROM job`
+	var args []interface{}
+	if owner != "" {
+		q += ` WHERE username = ?`
+		args = append(args, owner)
+	}
+	q += ` ORDER BY createdAt DESC LIMIT ? OFFSET ?`
+	rows, err := dbQuery(db, q, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []globalstructs.Job{}
+	for rows.Next() {
+		var job globalstructs.Job
+		if err = rows.Scan(&job.ID, &job.Kind, &job.Username, &job.CreatedAt, &job.Total); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJob returns a job with the number of tasks by status
+func (db *DB) GetJob(id string, verbose, debug bool) (globalstructs.Job, error) {
+	var job globalstructs.Job
+	const q = `SELECT ID, kind, username, createdAt, total FROM job WHERE ID = ?`
+	err := dbQueryRow(db, q, id).Scan(&job.ID, &job.Kind, &job.Username, &job.CreatedAt, &job.Total)
+	if err != nil {
+		return job, err
+	}
+
+	rows, err := dbQuery(db, `SELECT status, COUNT(*) FROM task WHERE groupID = ? GROUP BY status`, id)
+	if err != nil {
+		return job, err
+	}
+	defer rows.Close()
+
+	job.Status = map[string]int{}
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+		if err = rows.Scan(&status, &count); err != nil {
+			return job, err
+		}
+		job.Status[status] = count
+	}
+	if debug {
+		log.Println("GetJob", id, job.Status)
+	}
+	return job, rows.Err()
+}
+
+// GetJobTasks returns a page of the tasks of a job, the tasks with a status
+// in statuses if any
+func (db *DB) GetJobTasks(id string, statuses []string, page, limit int, verbose, debug bool) ([]globalstructs.Task, error) {
+	q := "SELECT " + taskSelectCols + " FROM task WHERE groupID = ?"
+	args := []interface{}{id}
+	if len(statuses) > 0 {
+		q += " AND status IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")"
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+	}
+	orderBy, limit, offset := buildOrderByAndLimit(page, limit)
+	q += orderBy + " LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+	return getTasksSQL(q, args, db, verbose, debug)
+}
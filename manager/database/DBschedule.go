@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+const scheduleSelectCols = `ID, name, task, cron, runAt, nextRunAt, lastRunAt, lastTaskID, enabled, username, createdAt`
+
+// AddSchedule inserts a new schedule, nextRunAt is the first time it runs
+func (db *DB) AddSchedule(schedule globalstructs.Schedule, runAt, nextRunAt *time.Time, verbose, debug bool) error {
+	const q = `INSERT INTO schedule (ID, name, task, cron, runAt, nextRunAt, lastTaskID, enabled, username)
+               VALUES (?, ?, ?, ?, ?, ?, '', ?, ?)`
+	taskJSON, err := serializeToJSON(schedule.Task)
+	if err != nil {
+		return err
+	}
+	if _, err := execWithRetry(db, true, q, schedule.ID, schedule.Name, taskJSON, schedule.Cron,
+		runAt, nextRunAt, schedule.Enabled, schedule.Username); err != nil {
+		return fmt.Errorf("AddSchedule: %w", err)
+	}
+	return nil
+}
+
+// RmSchedule deletes a schedule, the tasks already added are kept
+func (db *DB) RmSchedule(id string, verbose, debug bool) error {
+	res, err := execWithRetry(db, false, "DELETE FROM schedule WHERE ID = ?", id)
+	if err != nil {
+		return fmt.Errorf("RmSchedule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("RmSchedule: schedule %s not found", id)
+	}
+	return nil
+}
+
+// GetSchedules returns every schedule, only the ones of owner if it is not empty
+func (db *DB) GetSchedules(owner string, verbose, debug bool) ([]globalstructs.Schedule, error) {
+	if owner != "" {
+		q := "SELECT " + scheduleSelectCols + " FROM schedule WHERE username = ? ORDER BY createdAt ASC"
+		return getSchedulesSQL(q, []interface{}{owner}, db, verbose, debug)
+	}
+	q := "SELECT " + scheduleSelectCols + " FROM schedule ORDER BY createdAt ASC"
+	return getSchedulesSQL(q, nil, db, verbose, debug)
+}
+
+// GetSchedule fetches a single schedule by ID
+func (db *DB) GetSchedule(id string, verbose, debug bool) (globalstructs.Schedule, error) {
+	q := "SELECT " + scheduleSelectCols + " FROM schedule WHERE ID = ?"
+	schedules, err := getSchedulesSQL(q, []interface{}{id}, db, verbose, debug)
+	if err != nil {
+		return globalstructs.Schedule{}, err
+	}
+	if len(schedules) == 0 {
+		return globalstructs.Schedule{}, sql.ErrNoRows
+	}
+	return schedules[0], nil
+}
+
+// GetSchedulesDue returns the enabled schedules with nextRunAt before now
+func (db *DB) GetSchedulesDue(now time.Time, verbose, debug bool) ([]globalstructs.Schedule, error) {
+	q := "SELECT " + scheduleSelectCols + " FROM schedule WHERE enabled = TRUE AND nextRunAt <= ? ORDER BY nextRunAt ASC"
+	return getSchedulesSQL(q, []interface{}{now}, db, verbose, debug)
+}
+
+// SetScheduleRun saves the last execution of a schedule and the next one,
+// a nil nextRunAt disables the schedule
+func (db *DB) SetScheduleRun(id, taskID string, lastRunAt time.Time, nextRunAt *time.Time, verbose, debug bool) error {
+	const q = `UPDATE schedule SET lastRunAt = ?, lastTaskID = ?, nextRunAt = ?, enabled = ? WHERE ID = ?`
+	res, err := execWithRetry(db, false, q, lastRunAt, taskID, nextRunAt, nextRunAt != nil, id)
+	if err != nil {
+		return fmt.Errorf("SetScheduleRun: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("SetScheduleRun: schedule %s not found", id)
+	}
+	return nil
+}
+
+func getSchedulesSQL(sqlQuery string, args []interface{}, db *DB, verbose, debug bool) ([]globalstructs.Schedule, error) {
+	rows, err := dbQuery(db, sqlQuery, args...)
+	if err != nil {
+		if debug {
+			log.Println("getSchedulesSQL query error:", err)
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []globalstructs.Schedule{}
+	for rows.Next() {
+		var (
+			s                       globalstructs.Schedule
+			taskStr                 string
+			runAt, nextRun, lastRun sql.NullString
+		)
+		if err = rows.Scan(&s.ID, &s.Name, &taskStr, &s.Cron, &runAt, &nextRun, &lastRun,
+			&s.LastTaskID, &s.Enabled, &s.Username, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(taskStr), &s.Task); err != nil {
+			return nil, fmt.Errorf("parse task: %w", err)
+		}
+		s.RunAt, s.NextRunAt, s.LastRunAt = runAt.String, nextRun.String, lastRun.String
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
@@ -7,57 +7,238 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	globalstructs "github.com/r4ulcl/nTask/globalstructs"
 )
 
-// AddTask adds a task to the database.
-func AddTask(db *sql.DB, task globalstructs.Task, verbose, debug bool) error {
-	const q = `INSERT INTO task
-        (ID, notes, commands, files, name, status, duration, WorkerName, username, priority, timeout, callbackURL, callbackToken)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+const (
+	taskInsertCols = `(ID, notes, commands, files, name, status, duration, WorkerName, username, priority, timeout, callbackURL, callbackToken, dependsOn,
+        maxRetries, retryBackoffSeconds, requires, groupID, cancelGraceSeconds, artifacts, resourceLimits, queue, rateKey, workerPinned)`
+	taskInsertRow = `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	// addTasksChunk rows inserted by each statement of AddTasks
+	addTasksChunk = 500
+)
+
+// QuotaError is returned when the new tasks of a user exceed its max pending tasks
+type QuotaError struct {
+	Pending    int
+	MaxPending int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("Quota exceeded: %d of %d pending tasks", e.Pending, e.MaxPending)
+}
 
-	cmdJSON, fileJSON, err := prepareTaskQuery(task, verbose, debug)
+// AddTask adds a task and its dependencies to the database in a single transaction,
+// the task is added as skipped if one of its parents will never be done. It returns a
+// QuotaError if the user of the task has maxPending pending tasks, 0 is no limit
+func (db *DB) AddTask(task globalstructs.Task, maxPending int, verbose, debug bool) error {
+	err := txWithRetry(db, func(tx *Tx) error {
+		if err := checkQuotaTx(tx, task.Username, 1, maxPending); err != nil {
+			return err
+		}
+		return addTasksTx(tx, []globalstructs.Task{task}, verbose, debug)
+	})
 	if err != nil {
+		return fmt.Errorf("AddTask: %w", err)
+	}
+	return nil
+}
+
+// checkQuotaTx returns a QuotaError if n new tasks exceed the maxPending tasks of the user,
+// the other transactions of the user wait until this one ends to count its tasks
+func checkQuotaTx(tx *Tx, username string, n, maxPending int) error {
+	if maxPending <= 0 {
+		return nil
+	}
+	if _, err := txExec(tx, tx.backend.LockUser(), username); err != nil {
 		return err
 	}
-	if _, err = execWithRetry(db, true, q,
-		task.ID, task.Notes, cmdJSON, fileJSON, task.Name, task.Status,
-		task.Duration, task.WorkerName, task.Username, task.Priority,
-		task.Timeout, task.CallbackURL, task.CallbackToken); err != nil {
-		return fmt.Errorf("AddTask: %w", err)
+	var pending int
+	row := txQueryRow(tx, "SELECT COUNT(*) FROM task WHERE status = 'pending' AND username = ?", username)
+	if err := row.Scan(&pending); err != nil {
+		return err
+	}
+	if pending+n > maxPending {
+		return &QuotaError{Pending: pending, MaxPending: maxPending}
+	}
+	return nil
+}
+
+// addTasksTx inserts the tasks and their dependencies with multi-row statements,
+// the tasks with a parent that will never be done are inserted as skipped
+func addTasksTx(tx *Tx, tasks []globalstructs.Task, verbose, debug bool) error {
+	tasks = slices.Clone(tasks)
+	if err := skipFailedParentsTx(tx, tasks, debug); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(tasks); start += addTasksChunk {
+		end := min(start+addTasksChunk, len(tasks))
+
+		rows := make([]string, 0, end-start)
+		args := []interface{}{}
+		depRows := []string{}
+		depArgs := []interface{}{}
+		for _, task := range tasks[start:end] {
+			taskArgs, err := taskInsertArgs(task, verbose, debug)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, taskInsertRow)
+			args = append(args, taskArgs...)
+			for _, parent := range task.DependsOn {
+				depRows = append(depRows, "(?, ?)")
+				depArgs = append(depArgs, task.ID, parent)
+			}
+		}
+
+		q := "INSERT INTO task " + taskInsertCols + " VALUES " + strings.Join(rows, ", ")
+		if _, err := txExec(tx, q, args...); err != nil {
+			return err
+		}
+		if len(depRows) > 0 {
+			q = "INSERT INTO task_dependency (taskID, dependsOn) VALUES " + strings.Join(depRows, ", ")
+			if _, err := txExec(tx, q, depArgs...); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// skipFailedParentsTx sets as skipped the pending tasks with a parent that will never be done.
+// The parents are locked until the transaction ends, a parent that fails meanwhile skips
+// its dependents after the task_dependency rows of the tasks are committed. The parents are
+// tasks already saved, the IDs of the tasks added together are set by the manager
+func skipFailedParentsTx(tx *Tx, tasks []globalstructs.Task, debug bool) error {
+	var parents []string
+	for _, task := range tasks {
+		for _, parent := range task.DependsOn {
+			if !slices.Contains(parents, parent) {
+				parents = append(parents, parent)
+			}
+		}
+	}
+	// the same lock order in every transaction
+	sort.Strings(parents)
+
+	status := make(map[string]string, len(parents))
+	for start := 0; start < len(parents); start += addTasksChunk {
+		in, args := inCond("ID", parents[start:min(start+addTasksChunk, len(parents))])
+		if _, err := txExec(tx, "UPDATE task SET updatedAt = updatedAt WHERE "+in, args...); err != nil {
+			return err
+		}
+		rows, err := txQuery(tx, "SELECT ID, status FROM task WHERE "+in, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id, parentStatus string
+			if err = rows.Scan(&id, &parentStatus); err != nil {
+				rows.Close()
+				return err
+			}
+			status[id] = parentStatus
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for i := range tasks {
+		if tasks[i].Status != "pending" {
+			continue
+		}
+		for _, parent := range tasks[i].DependsOn {
+			if IsFailedParentStatus(status[parent]) {
+				tasks[i].Status = "skipped"
+				if debug {
+					log.Println("skipFailedParentsTx", tasks[i].ID, "skipped, parent", parent, status[parent])
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// failedParentStatus status of a parent that will never reach done
+var failedParentStatus = map[string]bool{
+	"failed":    true,
+	"deleted":   true,
+	"skipped":   true,
+	"cancelled": true,
+}
+
+// IsFailedParentStatus returns true if a task with this status blocks its dependents forever
+func IsFailedParentStatus(status string) bool {
+	return failedParentStatus[status]
+}
+
+// taskInsertArgs returns the values of taskInsertRow for a task.
+func taskInsertArgs(task globalstructs.Task, verbose, debug bool) ([]interface{}, error) {
+	cmdJSON, fileJSON, dependsOnJSON, err := prepareTaskQuery(task, verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+	artifactsJSON, err := serializeToJSON(task.Artifacts)
+	if err != nil {
+		return nil, err
+	}
+	limitsJSON, err := serializeToJSON(task.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		task.ID, task.Notes, cmdJSON, fileJSON, task.Name, task.Status,
+		task.Duration, task.WorkerName, task.Username, task.Priority,
+		task.Timeout, task.CallbackURL, task.CallbackToken, dependsOnJSON,
+		task.MaxRetries, task.RetryBackoffSeconds, task.Requires, task.GroupID,
+		task.CancelGraceSeconds, artifactsJSON, limitsJSON, task.Queue, task.RateKey,
+		// the WorkerName of a new task that isn't running was set by the user
+		task.WorkerName != "" && task.Status != "running",
+	}, nil
+}
+
 // UpdateTask updates all fields of a task in the database.
-func UpdateTask(db *sql.DB, task globalstructs.Task, verbose, debug bool) error {
+func (db *DB) UpdateTask(task globalstructs.Task, verbose, debug bool) error {
 	if debug {
 		log.Println("UpdateTask1:", task)
 	}
 
 	const q = `UPDATE task SET
             notes=?, commands=?, files=?, name=?, status=?, duration=?,
-            WorkerName=?, priority=?, timeout=?, callbackURL=?, callbackToken=?, updatedAt = NOW()
+            WorkerName=?, priority=?, timeout=?, callbackURL=?, callbackToken=?, updatedAt = CURRENT_TIMESTAMP
         WHERE ID=?`
 
-	cmdJSON, fileJSON, err := prepareTaskQuery(task, verbose, debug)
+	cmdJSON, fileJSON, _, err := prepareTaskQuery(task, verbose, debug)
 	if err != nil {
 		return err
 	}
 
-	res, err := execWithRetry(db, false, q,
-		task.Notes, cmdJSON, fileJSON, task.Name, task.Status, task.Duration,
-		task.WorkerName, task.Priority, task.Timeout, task.CallbackURL,
-		task.CallbackToken, task.ID,
-	)
+	err = txWithRetry(db, func(tx *Tx) error {
+		res, err := txExec(tx, q,
+			task.Notes, cmdJSON, fileJSON, task.Name, task.Status, task.Duration,
+			task.WorkerName, task.Priority, task.Timeout, task.CallbackURL,
+			task.CallbackToken, task.ID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("no task with ID %s found (possible race)", task.ID)
+		}
+		return setTaskCommandsTx(tx, task)
+	})
 	if err != nil {
-		return fmt.Errorf("UpdateTask error: %w", err)
-	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return fmt.Errorf("UpdateTask: no task with ID %s found (possible race)", task.ID)
+		return fmt.Errorf("UpdateTask: %w", err)
 	}
 
 	if debug {
@@ -66,10 +247,98 @@ func UpdateTask(db *sql.DB, task globalstructs.Task, verbose, debug bool) error
 	return nil
 }
 
+// setTaskCommandsTx saves the status and exit code of the commands of the task that ran,
+// the task_command rows are used to filter the tasks by them
+func setTaskCommandsTx(tx *Tx, task globalstructs.Task) error {
+	if _, err := txExec(tx, "DELETE FROM task_command WHERE taskID = ?", task.ID); err != nil {
+		return err
+	}
+	for i, command := range task.Commands {
+		if command.Status == "" {
+			continue
+		}
+		const q = `INSERT INTO task_command (taskID, num, status, exitCode) VALUES (?, ?, ?, ?)`
+		if _, err := txExec(tx, q, task.ID, i, command.Status, command.ExitCode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillTaskCommands fills task_command with the commands of the next batchSize tasks older
+// than migration 10 that have no rows in it, returns true when every task has been filled
+func (db *DB) BackfillTaskCommands(batchSize int, verbose, debug bool) (bool, error) {
+	done := false
+	filled := 0
+	err := txWithRetry(db, func(tx *Tx) error {
+		filled = 0
+		var lastID string
+		if err := txQueryRow(tx, "SELECT lastID, done FROM task_command_backfill").Scan(&lastID, &done); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		rows, err := txQuery(tx, "SELECT ID, commands FROM task WHERE ID > ? ORDER BY ID ASC LIMIT ?", lastID, batchSize)
+		if err != nil {
+			return err
+		}
+		var tasks []globalstructs.Task
+		read := 0
+		for rows.Next() {
+			var (
+				task        globalstructs.Task
+				commandsStr string
+			)
+			if err := rows.Scan(&task.ID, &commandsStr); err != nil {
+				rows.Close()
+				return err
+			}
+			// Tasks with invalid commands have nothing to filter by
+			if json.Unmarshal([]byte(commandsStr), &task.Commands) == nil {
+				tasks = append(tasks, task)
+			}
+			lastID = task.ID
+			read++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			// The tasks updated after migration 10 already have their rows
+			var n int
+			if err := txQueryRow(tx, "SELECT COUNT(*) FROM task_command WHERE taskID = ?", task.ID).Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+			if err := setTaskCommandsTx(tx, task); err != nil {
+				return err
+			}
+			filled++
+		}
+
+		done = read < batchSize
+		_, err = txExec(tx, "UPDATE task_command_backfill SET lastID = ?, done = ?", lastID, done)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("BackfillTaskCommands: %w", err)
+	}
+	if debug && filled > 0 {
+		log.Println("BackfillTaskCommands filled", filled, "tasks")
+	}
+	return done, nil
+}
+
 // RmTask deletes a task from the database.
-func RmTask(db *sql.DB, id string, verbose, debug bool) error {
+func (db *DB) RmTask(id string, verbose, debug bool) error {
 	const q = `DELETE FROM task WHERE ID = ?`
-	res, err := execWithRetry(db, false, q, false, id)
+	res, err := execWithRetry(db, false, q, id)
 	if err != nil {
 		return err
 	}
@@ -80,7 +349,7 @@ func RmTask(db *sql.DB, id string, verbose, debug bool) error {
 }
 
 // buildFiltersWithParams constructs SQL filters using query parameters safely.
-func buildFiltersWithParams(query url.Values) (string, []interface{}) {
+func buildFiltersWithParams(backend Backend, query url.Values) (string, []interface{}) {
 	var (
 		filters []string
 		args    []interface{}
@@ -96,9 +365,9 @@ func buildFiltersWithParams(query url.Values) (string, []interface{}) {
 	add("commands", "commands LIKE ?")
 	add("files", "files LIKE ?")
 	add("name", "name LIKE ?")
-	add("createdAt", "createdAt LIKE ?")
-	add("updatedAt", "updatedAt LIKE ?")
-	add("executedAt", "executedAt LIKE ?")
+	add("createdAt", backend.Text("createdAt")+" LIKE ?")
+	add("updatedAt", backend.Text("updatedAt")+" LIKE ?")
+	add("executedAt", backend.Text("executedAt")+" LIKE ?")
 	add("status", "status = ?")
 	add("duration", "duration = ?")
 	add("workerName", "workerName LIKE ?")
@@ -107,9 +376,40 @@ func buildFiltersWithParams(query url.Values) (string, []interface{}) {
 	add("timeout", "timeout = ?")
 	add("callbackURL", "callbackURL = ?")
 	add("callbackToken", "callbackToken = ?")
+	add("retries", "retries = ?")
+	add("requires", "requires LIKE ?")
+	add("groupID", "groupID = ?")
+	add("cancelGraceSeconds", "cancelGraceSeconds = ?")
+	add("queue", "queue = ?")
+	add("rateKey", "rateKey = ?")
+	if cond, condArgs := commandFilter(query.Get("commandStatus"), query.Get("exitCode")); cond != "" {
+		filters = append(filters, cond)
+		args = append(args, condArgs...)
+	}
 	return strings.Join(filters, " AND "), args
 }
 
+// commandFilter returns the condition of the tasks with a command with that status and
+// exit code, both are checked by the API
+func commandFilter(status, exitCode string) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, status)
+	}
+	if code, err := strconv.Atoi(exitCode); err == nil {
+		conds = append(conds, "exitCode = ?")
+		args = append(args, code)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "ID IN (SELECT taskID FROM task_command WHERE " + strings.Join(conds, " AND ") + ")", args
+}
+
 func buildOrderByAndLimit(page, limit int) (string, int, int) {
 	if page < 1 {
 		page = 1
@@ -121,13 +421,21 @@ func buildOrderByAndLimit(page, limit int) (string, int, int) {
 	return " ORDER BY priority DESC, createdAt ASC", limit, offset
 }
 
-// GetTasks retrieves tasks from the database using URL parameters as filters.
-func GetTasks(r *http.Request, db *sql.DB, verbose, debug bool) ([]globalstructs.Task, error) {
+// GetTasks retrieves tasks from the database using URL parameters as filters,
+// only the tasks of owner if it is not empty.
+func (db *DB) GetTasks(r *http.Request, owner string, verbose, debug bool) ([]globalstructs.Task, error) {
 	queryParams := r.URL.Query()
-	filters, args := buildFiltersWithParams(queryParams)
+	filters, args := buildFiltersWithParams(db.backend, queryParams)
+	if owner != "" {
+		if filters != "" {
+			filters += " AND "
+		}
+		filters += "username = ?"
+		args = append(args, owner)
+	}
 	orderBy, limit, offset := buildOrderByAndLimit(getInt(queryParams, "page", 1), getInt(queryParams, "limit", defaultSelectLimit))
 
-	sqlStr := "SELECT ID, notes, commands, files, name, createdAt, updatedAt, executedAt, status, duration, WorkerName, username, priority, timeout, callbackURL, callbackToken FROM task WHERE 1=1"
+	sqlStr := "SELECT " + taskSelectCols + " FROM task WHERE 1=1"
 	if filters != "" {
 		sqlStr += " AND " + filters
 	}
@@ -168,19 +476,152 @@ func getLimit(queryParams url.Values) int {
 	return limit
 }
 
-// GetTasksPending Get Tasks  with status = Pending
-func GetTasksPending(limit int, db *sql.DB, verbose, debug bool) ([]globalstructs.Task, error) {
+// PendingSkip tasks left out by GetTasksPending
+type PendingSkip struct {
+	Queues      []string // queues that can't run more tasks
+	RateKeys    []string // rate keys that can't start more tasks
+	IdleWorkers []string // workers with free threads, the tasks sent to another worker are left out
+}
+
+// cond returns the conditions to leave out the tasks and their arguments
+func (skip PendingSkip) cond() (string, []interface{}) {
+	queueCond, args := notInCond("queue", skip.Queues)
+	rateCond, rateArgs := notInCond("rateKey", skip.RateKeys)
+	cond := queueCond + rateCond
+	args = append(args, rateArgs...)
+	if len(skip.IdleWorkers) > 0 {
+		workerCond, workerArgs := inCond("workerName", skip.IdleWorkers)
+		cond += " AND (workerName = '' OR workerName IS NULL OR " + workerCond + ")"
+		args = append(args, workerArgs...)
+	}
+	return cond, args
+}
+
+// pendingOrder order of the tasks of GetTasksPending, the ID makes the pages stable
+const pendingOrder = " ORDER BY priority DESC, createdAt ASC, ID ASC LIMIT ? OFFSET ?"
+
+// GetTasksPending Get Tasks  with status = Pending whose parents are all done,
+// without the tasks of skip, skipping the first offset tasks
+func (db *DB) GetTasksPending(limit, offset int, skip PendingSkip, verbose, debug bool) ([]globalstructs.Task, error) {
 	if limit <= 0 {
 		limit = 1
 	}
-	const q = `SELECT ID, notes, commands, files, name, createdAt, updatedAt, executedAt, status, duration, WorkerName, username, priority, timeout, callbackURL, callbackToken
-               FROM task WHERE status = 'pending' ORDER BY priority DESC, createdAt ASC LIMIT ?`
-	return getTasksSQL(q, []interface{}{limit}, db, verbose, debug)
+	cond, args := skip.cond()
+	q := "SELECT " + taskSelectCols + " FROM task WHERE " + taskReadyCond + cond + pendingOrder
+	return getTasksSQL(q, append(append([]interface{}{time.Now()}, args...), limit, offset), db, verbose, debug)
+}
+
+// GetTasksPendingByUser like GetTasksPending with up to limit tasks of each user in a single query,
+// skipping the first offsets[username] tasks of each user and the tasks of skipUsers.
+// The tasks of a user keep the order of GetTasksPending
+func (db *DB) GetTasksPendingByUser(limit int, offsets map[string]int, skipUsers []string, skip PendingSkip, verbose, debug bool) ([]globalstructs.Task, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+	cond, args := skip.cond()
+	userCond, userArgs := notInCond("username", skipUsers)
+	args = append(append([]interface{}{time.Now()}, args...), userArgs...)
+
+	// Row of each task among the ready tasks of its user, minus the offset of the user
+	offset := "0"
+	if len(offsets) > 0 {
+		users := make([]string, 0, len(offsets))
+		for username := range offsets {
+			users = append(users, username)
+		}
+		sort.Strings(users)
+		offset = "CASE username" + strings.Repeat(" WHEN ? THEN ?", len(users)) + " ELSE 0 END"
+		for _, username := range users {
+			args = append(args, username, offsets[username])
+		}
+	}
+
+	q := "SELECT " + taskSelectCols + " FROM (SELECT " + taskSelectCols + `,
+            ROW_NUMBER() OVER (PARTITION BY username ORDER BY priority DESC, createdAt ASC, ID ASC) AS userRow
+            FROM task WHERE ` + taskReadyCond + cond + userCond + `) pending
+        WHERE userRow - ` + offset + ` BETWEEN 1 AND ?
+        ORDER BY username, userRow`
+	return getTasksSQL(q, append(args, limit), db, verbose, debug)
+}
+
+// notInCond returns the condition " AND column NOT IN (?, ...)" and its arguments, empty without values
+func notInCond(column string, values []string) (string, []interface{}) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return " AND " + column + " NOT IN (?" + strings.Repeat(", ?", len(values)-1) + ")", args
+}
+
+// inCond returns the condition "column IN (?, ...)" and its arguments, values can't be empty
+func inCond(column string, values []string) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return column + " IN (?" + strings.Repeat(", ?", len(values)-1) + ")", args
+}
+
+// CountTasksByUser returns the number of tasks of each user with a status
+func (db *DB) CountTasksByUser(status string, verbose, debug bool) (map[string]int, error) {
+	return countBy(db, "SELECT username, COUNT(*) FROM task WHERE status = ? GROUP BY username", status)
+}
+
+// CountTasksByQueue returns the number of tasks of each queue with a status
+func (db *DB) CountTasksByQueue(status string, verbose, debug bool) (map[string]int, error) {
+	return countBy(db, "SELECT queue, COUNT(*) FROM task WHERE status = ? GROUP BY queue", status)
+}
+
+// CountTasksByRateKey returns the number of tasks of each rate key with a status, without the tasks without rate key
+func (db *DB) CountTasksByRateKey(status string, verbose, debug bool) (map[string]int, error) {
+	return countBy(db, "SELECT rateKey, COUNT(*) FROM task WHERE status = ? AND rateKey <> '' GROUP BY rateKey", status)
+}
+
+// CountTasksStartedByUser returns the number of tasks of each user executed after since,
+// including the running ones
+func (db *DB) CountTasksStartedByUser(since time.Time, verbose, debug bool) (map[string]int, error) {
+	return countBy(db, "SELECT username, COUNT(*) FROM task WHERE executedAt >= ? GROUP BY username", since)
 }
 
+func countBy(db *DB, sqlQuery string, args ...interface{}) (map[string]int, error) {
+	rows, err := dbQuery(db, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var (
+			key   string
+			count int
+		)
+		if err = rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+	return counts, rows.Err()
+}
+
+// taskReadyCond pending tasks that can run now, with the time as argument.
+// A parent that no longer exists was trimmed from the history, so it was done
+const taskReadyCond = `status = 'pending'
+               AND retryAt <= ?
+               AND NOT EXISTS (
+                   SELECT 1 FROM task_dependency d JOIN task p ON p.ID = d.dependsOn
+                   WHERE d.taskID = task.ID AND p.status <> 'done')`
+
+// taskSelectCols columns read by getTasksSQL, in scan order
+const taskSelectCols = `ID, notes, commands, files, name, createdAt, updatedAt, executedAt, status, duration, WorkerName,
+                      username, priority, timeout, callbackURL, callbackToken, dependsOn, maxRetries, retryBackoffSeconds, retries, requires, groupID, cancelGraceSeconds, artifacts, resourceLimits, queue, rateKey, cancelRequested`
+
 // getTasksSQL executes a parameterized SQL query to fetch tasks.
-func getTasksSQL(sqlQuery string, args []interface{}, db *sql.DB, verbose, debug bool) ([]globalstructs.Task, error) {
-	rows, err := db.Query(sqlQuery, args...)
+func getTasksSQL(sqlQuery string, args []interface{}, db *DB, verbose, debug bool) ([]globalstructs.Task, error) {
+	rows, err := dbQuery(db, sqlQuery, args...)
 	if err != nil {
 		if debug {
 			log.Println("getTasksSQL query error:", err)
@@ -192,21 +633,48 @@ func getTasksSQL(sqlQuery string, args []interface{}, db *sql.DB, verbose, debug
 	var tasks []globalstructs.Task
 	for rows.Next() {
 		var (
-			t           globalstructs.Task
-			commandsStr string
-			filesStr    string
+			t            globalstructs.Task
+			commandsStr  string
+			filesStr     string
+			dependsOnStr sql.NullString
+			requires     sql.NullString
+			groupID      sql.NullString
+			cancelGrace  sql.NullInt64
+			artifacts    sql.NullString
+			limits       sql.NullString
 		)
 		if err = rows.Scan(&t.ID, &t.Notes, &commandsStr, &filesStr, &t.Name,
 			&t.CreatedAt, &t.UpdatedAt, &t.ExecutedAt, &t.Status, &t.Duration,
-			&t.WorkerName, &t.Username, &t.Priority, &t.Timeout, &t.CallbackURL, &t.CallbackToken); err != nil {
+			&t.WorkerName, &t.Username, &t.Priority, &t.Timeout, &t.CallbackURL, &t.CallbackToken,
+			&dependsOnStr, &t.MaxRetries, &t.RetryBackoffSeconds, &t.Retries, &requires, &groupID, &cancelGrace, &artifacts, &limits, &t.Queue, &t.RateKey, &t.CancelRequested); err != nil {
 			return nil, err
 		}
+		t.Requires = requires.String
+		t.GroupID = groupID.String
+		t.CancelGraceSeconds = int(cancelGrace.Int64)
 		if err = json.Unmarshal([]byte(commandsStr), &t.Commands); err != nil {
 			return nil, fmt.Errorf("parse commands: %w", err)
 		}
+		globalstructs.SetOutputs(t.Commands)
 		if err = json.Unmarshal([]byte(filesStr), &t.Files); err != nil {
 			return nil, fmt.Errorf("parse files: %w", err)
 		}
+		// tasks created before dependencies existed have a NULL dependsOn
+		if dependsOnStr.Valid && dependsOnStr.String != "" {
+			if err = json.Unmarshal([]byte(dependsOnStr.String), &t.DependsOn); err != nil {
+				return nil, fmt.Errorf("parse dependsOn: %w", err)
+			}
+		}
+		if artifacts.Valid && artifacts.String != "" {
+			if err = json.Unmarshal([]byte(artifacts.String), &t.Artifacts); err != nil {
+				return nil, fmt.Errorf("parse artifacts: %w", err)
+			}
+		}
+		if limits.Valid && limits.String != "" {
+			if err = json.Unmarshal([]byte(limits.String), &t.Limits); err != nil {
+				return nil, fmt.Errorf("parse limits: %w", err)
+			}
+		}
 		tasks = append(tasks, t)
 	}
 	if err = rows.Err(); err != nil {
@@ -216,31 +684,269 @@ func getTasksSQL(sqlQuery string, args []interface{}, db *sql.DB, verbose, debug
 }
 
 // GetTask gets task filtered by id
-func GetTask(db *sql.DB, id string, verbose, debug bool) (globalstructs.Task, error) {
-	const q = `SELECT ID, notes, createdAt, updatedAt, executedAt, commands, files, name, status, duration, WorkerName,
-                      username, priority, timeout, callbackURL, callbackToken
-               FROM task WHERE ID = ?`
-	var (
-		t           globalstructs.Task
-		commandsStr string
-		filesStr    string
-	)
-	err := db.QueryRow(q, id).Scan(&t.ID, &t.Notes, &t.CreatedAt, &t.UpdatedAt, &t.ExecutedAt, &commandsStr, &filesStr,
-		&t.Name, &t.Status, &t.Duration, &t.WorkerName, &t.Username, &t.Priority, &t.Timeout, &t.CallbackURL, &t.CallbackToken)
+func (db *DB) GetTask(id string, verbose, debug bool) (globalstructs.Task, error) {
+	q := "SELECT " + taskSelectCols + " FROM task WHERE ID = ?"
+	tasks, err := getTasksSQL(q, []interface{}{id}, db, verbose, debug)
+	if err != nil {
+		return globalstructs.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return globalstructs.Task{}, sql.ErrNoRows
+	}
+	return tasks[0], nil
+}
+
+// GetTaskWithAttempts gets task filtered by id with the history of its attempts
+func (db *DB) GetTaskWithAttempts(id string, verbose, debug bool) (globalstructs.Task, error) {
+	task, err := db.GetTask(id, verbose, debug)
+	if err != nil {
+		return task, err
+	}
+	task.Attempts, err = db.GetTaskAttempts(id, verbose, debug)
+	return task, err
+}
+
+// SaveTaskResult saves the result of the task sent by workerName with its attempt and artifacts in a
+// transaction, only if the task is still running on that worker in the same attempt. Returns false
+// if it isn't: a worker that reconnected can send the result of a task that was set as pending and
+// sent again meanwhile
+func (db *DB) SaveTaskResult(result globalstructs.Task, workerName string, verbose, debug bool) (bool, error) {
+	const q = `UPDATE task SET
+            notes=?, commands=?, files=?, name=?, status=?, duration=?, updatedAt = CURRENT_TIMESTAMP
+        WHERE ID=? AND status='running' AND WorkerName=? AND retries=?`
+
+	cmdJSON, fileJSON, _, err := prepareTaskQuery(result, verbose, debug)
+	if err != nil {
+		return false, err
+	}
+
+	saved := false
+	err = txWithRetry(db, func(tx *Tx) error {
+		saved = false
+		var executedAt time.Time
+		row := txQueryRow(tx, "SELECT executedAt FROM task WHERE ID = ?", result.ID)
+		if err := row.Scan(&executedAt); err != nil {
+			return err
+		}
+		res, err := txExec(tx, q,
+			result.Notes, cmdJSON, fileJSON, result.Name, result.Status, result.Duration,
+			result.ID, workerName, result.Retries,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		// Keep the outputs of this execution in the attempt history
+		const attempt = `INSERT INTO task_attempt (taskID, attempt, workerName, status, commands, duration, executedAt)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`
+		if _, err := txExec(tx, attempt, result.ID, result.Retries+1, workerName, result.Status, cmdJSON,
+			result.Duration, executedAt); err != nil {
+			return err
+		}
+		if err := addTaskArtifactsTx(tx, result.ID, result.Retries, result.ArtifactFiles); err != nil {
+			return err
+		}
+		if err := setTaskCommandsTx(tx, result); err != nil {
+			return err
+		}
+		saved = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("SaveTaskResult: %w", err)
+	}
+	if debug {
+		log.Println("SaveTaskResult", result.ID, workerName, result.Retries, saved)
+	}
+	return saved, nil
+}
+
+// GetTaskAttempts returns the attempt history of a task, oldest first
+func (db *DB) GetTaskAttempts(id string, verbose, debug bool) ([]globalstructs.TaskAttempt, error) {
+	const q = `SELECT attempt, workerName, status, commands, duration, executedAt, finishedAt
+               FROM task_attempt WHERE taskID = ? ORDER BY attempt ASC`
+	rows, err := dbQuery(db, q, id)
+	if err != nil {
+		if debug {
+			log.Println("GetTaskAttempts query error:", err)
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []globalstructs.TaskAttempt
+	for rows.Next() {
+		var (
+			a           globalstructs.TaskAttempt
+			commandsStr string
+		)
+		if err = rows.Scan(&a.Attempt, &a.WorkerName, &a.Status, &commandsStr, &a.Duration, &a.ExecutedAt, &a.FinishedAt); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(commandsStr), &a.Commands); err != nil {
+			return nil, fmt.Errorf("parse commands: %w", err)
+		}
+		globalstructs.SetOutputs(a.Commands)
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// unpinWorker keeps the WorkerName of the tasks pinned to a worker by the user and
+// removes the worker that ran the rest, so any worker can run them again
+const unpinWorker = "WorkerName = CASE WHEN workerPinned THEN WorkerName ELSE '' END"
+
+// RetryTask sets the task as pending again after backoffSeconds and increments its retries,
+// the worker of the failed attempt is removed so any worker can run the retry unless the
+// user pinned the task to it
+func (db *DB) RetryTask(id string, backoffSeconds int, verbose, debug bool) error {
+	const q = `UPDATE task SET status = 'pending', retries = retries + 1, ` + unpinWorker + `,
+               retryAt = ?, updatedAt = CURRENT_TIMESTAMP WHERE ID = ?`
+	retryAt := time.Now().Add(time.Duration(backoffSeconds) * time.Second)
+	res, err := execWithRetry(db, false, q, retryAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("RetryTask: task %s not found", id)
+	}
+	if debug {
+		log.Println("RetryTask", id, "in", backoffSeconds, "seconds")
+	}
+	return nil
+}
+
+// GetTaskDependencies returns the IDs of the tasks the task depends on
+func (db *DB) GetTaskDependencies(id string, verbose, debug bool) ([]string, error) {
+	return getTaskIDsSQL("SELECT dependsOn FROM task_dependency WHERE taskID = ?", id, db, debug)
+}
+
+// GetTaskDependents returns the IDs of the tasks that depend on the task
+func (db *DB) GetTaskDependents(id string, verbose, debug bool) ([]string, error) {
+	return getTaskIDsSQL("SELECT taskID FROM task_dependency WHERE dependsOn = ?", id, db, debug)
+}
+
+// TaskDependency dependency of a task, TaskID depends on DependsOn
+type TaskDependency struct {
+	TaskID    string
+	DependsOn string
+}
+
+// GetTasksDependencies returns the dependencies of the tasks with those IDs and the ones on them
+func (db *DB) GetTasksDependencies(ids []string, verbose, debug bool) ([]TaskDependency, error) {
+	var dependencies []TaskDependency
+	for start := 0; start < len(ids); start += addTasksChunk {
+		chunk := ids[start:min(start+addTasksChunk, len(ids))]
+		taskCond, args := inCond("taskID", chunk)
+		dependsOnCond, dependsOnArgs := inCond("dependsOn", chunk)
+		rows, err := dbQuery(db, "SELECT taskID, dependsOn FROM task_dependency WHERE "+taskCond+" OR "+dependsOnCond,
+			append(args, dependsOnArgs...)...)
+		if err != nil {
+			if debug {
+				log.Println("GetTasksDependencies query error:", err)
+			}
+			return nil, err
+		}
+		for rows.Next() {
+			var dependency TaskDependency
+			if err = rows.Scan(&dependency.TaskID, &dependency.DependsOn); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			dependencies = append(dependencies, dependency)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dependencies, nil
+}
+
+func getTaskIDsSQL(sqlQuery, id string, db *DB, debug bool) ([]string, error) {
+	rows, err := dbQuery(db, sqlQuery, id)
 	if err != nil {
-		return t, err
+		if debug {
+			log.Println("getTaskIDsSQL query error:", err)
+		}
+		return nil, err
 	}
-	if err = json.Unmarshal([]byte(commandsStr), &t.Commands); err != nil {
-		return t, fmt.Errorf("parse commands: %w", err)
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var taskID string
+		if err = rows.Scan(&taskID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, taskID)
 	}
-	if err = json.Unmarshal([]byte(filesStr), &t.Files); err != nil {
-		return t, fmt.Errorf("parse files: %w", err)
+	return ids, rows.Err()
+}
+
+// GetTaskNameStatus returns only the name and status of a task
+func (db *DB) GetTaskNameStatus(id string, verbose, debug bool) (string, string, error) {
+	var name, status string
+	if err := dbQueryRow(db, "SELECT name, status FROM task WHERE ID = ?", id).Scan(&name, &status); err != nil {
+		return "", "", err
 	}
-	return t, nil
+	return name, status, nil
+}
+
+// GetTaskRetries returns the times the task was set as pending again, its current attempt is retries+1
+func (db *DB) GetTaskRetries(id string, verbose, debug bool) (int, error) {
+	var retries int
+	if err := dbQueryRow(db, "SELECT retries FROM task WHERE ID = ?", id).Scan(&retries); err != nil {
+		return 0, err
+	}
+	return retries, nil
+}
+
+// GetTasksStatus returns the ID, name, status and username of the tasks with those IDs by ID,
+// the tasks not found are missing from the map
+func (db *DB) GetTasksStatus(ids []string, verbose, debug bool) (map[string]globalstructs.Task, error) {
+	tasks := make(map[string]globalstructs.Task, len(ids))
+	for start := 0; start < len(ids); start += addTasksChunk {
+		cond, args := inCond("ID", ids[start:min(start+addTasksChunk, len(ids))])
+		rows, err := dbQuery(db, "SELECT ID, name, status, username FROM task WHERE "+cond, args...)
+		if err != nil {
+			if debug {
+				log.Println("GetTasksStatus query error:", err)
+			}
+			return nil, err
+		}
+		for rows.Next() {
+			var task globalstructs.Task
+			if err = rows.Scan(&task.ID, &task.Name, &task.Status, &task.Username); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tasks[task.ID] = task
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tasks, nil
+}
+
+// GetTaskUsername returns the user that added the task
+func (db *DB) GetTaskUsername(id string, verbose, debug bool) (string, error) {
+	var username string
+	if err := dbQueryRow(db, "SELECT username FROM task WHERE ID = ?", id).Scan(&username); err != nil {
+		return "", err
+	}
+	return username, nil
 }
 
 // Generic helper function to execute a database update
-func executeDBUpdate(db *sql.DB, query string, args []interface{}, verbose, debug bool, taskName string) error {
+func executeDBUpdate(db *DB, query string, args []interface{}, verbose, debug bool, taskName string) error {
 	_, err := execWithRetry(db, false, query, args...)
 
 	if err != nil {
@@ -252,16 +958,73 @@ func executeDBUpdate(db *sql.DB, query string, args []interface{}, verbose, debu
 	return nil
 }
 
-// SetTasksWorkerPending Function to set tasks worker status to 'pending'
-func SetTasksWorkerPending(db *sql.DB, workerName string, verbose, debug bool) error {
-	query := "UPDATE task SET status = 'pending', updatedAt = NOW() WHERE workerName = ? AND status = 'running'"
+// SetTasksWorkerPending Function to set tasks worker status to 'pending', like RetryTask only the
+// pinned ones keep the worker. The ones deleted by the user are set as deleted by DeleteTasksWorkerCancelled first
+func (db *DB) SetTasksWorkerPending(workerName string, verbose, debug bool) error {
+	query := "UPDATE task SET status = 'pending', " + unpinWorker + ", updatedAt = CURRENT_TIMESTAMP WHERE workerName = ? AND status = 'running' AND cancelRequested = FALSE"
 	args := []interface{}{workerName}
 	return executeDBUpdate(db, query, args, verbose, debug, "DBTask: SetTasksWorkerPending")
 }
 
+// DeleteTasksWorkerCancelled sets as deleted the running tasks of the worker that the user deleted,
+// they are not sent again when the worker is gone. Returns their IDs
+func (db *DB) DeleteTasksWorkerCancelled(workerName string, verbose, debug bool) ([]string, error) {
+	const cond = "workerName = ? AND status = 'running' AND cancelRequested = TRUE"
+	rows, err := dbQuery(db, "SELECT ID FROM task WHERE "+cond, workerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, id := range ids {
+		res, err := execWithRetry(db, false, "UPDATE task SET status = 'deleted', updatedAt = CURRENT_TIMESTAMP WHERE ID = ? AND "+cond, id, workerName)
+		if err != nil {
+			return deleted, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			deleted = append(deleted, id)
+		}
+	}
+	if verbose || debug {
+		log.Println("DeleteTasksWorkerCancelled", workerName, deleted)
+	}
+	return deleted, nil
+}
+
+// SetTaskCancelRequested saves that the user deleted the task while it runs on workerName,
+// returns false if the task isn't running on that worker anymore
+func (db *DB) SetTaskCancelRequested(id, workerName string, verbose, debug bool) (bool, error) {
+	const q = `UPDATE task SET cancelRequested = TRUE, updatedAt = CURRENT_TIMESTAMP
+               WHERE ID = ? AND status = 'running' AND WorkerName = ?`
+	res, err := execWithRetry(db, false, q, id, workerName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if debug && n > 0 {
+		log.Println("SetTaskCancelRequested", id, workerName)
+	}
+	return n > 0, nil
+}
+
 // SetTaskExecutedAtNow Function to set task's executedAt timestamp to now()
-func SetTaskExecutedAtNow(db *sql.DB, id string, verbose, debug bool) error {
-	res, err := execWithRetry(db, false, "UPDATE task SET executedAt = NOW(), updatedAt = NOW() WHERE ID = ?", id)
+func (db *DB) SetTaskExecutedAtNow(id string, verbose, debug bool) error {
+	res, err := execWithRetry(db, false, "UPDATE task SET executedAt = CURRENT_TIMESTAMP, updatedAt = CURRENT_TIMESTAMP WHERE ID = ?", id)
 	if err != nil {
 		return err
 	}
@@ -271,13 +1034,13 @@ func SetTaskExecutedAtNow(db *sql.DB, id string, verbose, debug bool) error {
 	return nil
 }
 
-func clearWorkerName(db *sql.DB, workerName string, verbose, debug bool) error {
-	_, err := execWithRetry(db, false, "UPDATE task SET WorkerName = '', updatedAt = NOW() WHERE WorkerName = ?", workerName)
+func clearWorkerName(db *DB, workerName string, verbose, debug bool) error {
+	_, err := execWithRetry(db, false, "UPDATE task SET WorkerName = '', updatedAt = CURRENT_TIMESTAMP WHERE WorkerName = ?", workerName)
 	return err
 }
 
-func SetTaskStatus(db *sql.DB, id, status string, verbose, debug bool) error {
-	res, err := execWithRetry(db, false, "UPDATE task SET status = ?, updatedAt = NOW() WHERE ID = ?", status, id)
+func (db *DB) SetTaskStatus(id, status string, verbose, debug bool) error {
+	res, err := execWithRetry(db, false, "UPDATE task SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE ID = ?", status, id)
 	if err != nil {
 		return err
 	}
@@ -290,47 +1053,86 @@ func SetTaskStatus(db *sql.DB, id, status string, verbose, debug bool) error {
 	return nil
 }
 
+// SetTaskStatusIfStatus sets the status of a task only if its current status is currentStatus,
+// returns true if the task was updated
+func (db *DB) SetTaskStatusIfStatus(id, currentStatus, newStatus string, verbose, debug bool) (bool, error) {
+	const q = "UPDATE task SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE ID = ? AND status = ?"
+	res, err := execWithRetry(db, false, q, newStatus, id, currentStatus)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if debug && n > 0 {
+		log.Println("SetTaskStatusIfStatus", id, currentStatus, "->", newStatus)
+	}
+	return n > 0, nil
+}
+
 // ---------------- Statistics & housekeeping ------------------------------
 
-func GetCountByStatus(status string, db *sql.DB, verbose, debug bool) (int, error) {
+func (db *DB) GetCountByStatus(status string, verbose, debug bool) (int, error) {
 	const q = `SELECT COUNT(*) FROM task WHERE status = ?`
 	var c int
-	if err := db.QueryRow(q, status).Scan(&c); err != nil {
+	if err := dbQueryRow(db, q, status).Scan(&c); err != nil {
 		return 0, err
 	}
 	return c, nil
 }
 
-// DeleteMaxEntriesHistory keeps only the newest <maxEntries> rows whose status = 'done'.
-func DeleteMaxEntriesHistory(db *sql.DB, maxEntries int, table string, verbose, debug bool) error {
+// DeleteMaxEntriesHistory keeps only the newest <maxEntries> rows whose status = 'done',
+// returns the IDs of the rows deleted.
+func (db *DB) DeleteMaxEntriesHistory(maxEntries int, table string, verbose, debug bool) ([]string, error) {
 	if maxEntries <= 0 {
 		maxEntries = defaultHistoryLimit
 	}
 	var total int
-	if err := db.QueryRow("SELECT COUNT(*) FROM " + table + " WHERE status = 'done'").Scan(&total); err != nil {
-		return err
+	if err := dbQueryRow(db, "SELECT COUNT(*) FROM "+table+" WHERE status = 'done'").Scan(&total); err != nil {
+		return nil, err
 	}
 	if total <= maxEntries {
-		return nil // nothing to do
+		return nil, nil // nothing to do
 	}
 	del := total - maxEntries
-	cte := fmt.Sprintf(`WITH old AS (
-            SELECT ID FROM %s WHERE status = 'done' ORDER BY createdAt ASC LIMIT ?)
-        DELETE FROM %s WHERE ID IN (SELECT ID FROM old)`, table, table)
-	if _, err := execWithRetry(db, false, cte, del); err != nil {
-		return err
+	rows, err := dbQuery(db, "SELECT ID FROM "+table+" WHERE status = 'done' ORDER BY createdAt ASC LIMIT ?", del)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(ids); start += addTasksChunk {
+		chunk := ids[start:min(start+addTasksChunk, len(ids))]
+		cond, args := inCond("ID", chunk)
+		if _, err := execWithRetry(db, false, "DELETE FROM "+table+" WHERE status = 'done' AND "+cond, args...); err != nil {
+			return ids[:start], err
+		}
 	}
 	if verbose || debug {
 		log.Printf("DeleteMaxEntriesHistory: trimmed %d → %d rows in %s", total, maxEntries, table)
 	}
-	return nil
+	return ids, nil
 }
 
 // setTasksWorkerEmpty remove the worker name of the task in the database
-func setTasksWorkerEmpty(db *sql.DB, workerName string, verbose, debug bool) error {
+func setTasksWorkerEmpty(db *DB, workerName string, verbose, debug bool) error {
 
 	// Update the workerName column of the task table for the given ID
-	query := "UPDATE task SET workerName = '', updatedAt = NOW() WHERE  workerName = ?"
+	query := "UPDATE task SET workerName = '', updatedAt = CURRENT_TIMESTAMP WHERE  workerName = ?"
 	_, err := execWithRetry(db, false, query, workerName)
 	if err != nil {
 		if debug || verbose {
@@ -342,10 +1144,10 @@ func setTasksWorkerEmpty(db *sql.DB, workerName string, verbose, debug bool) err
 }
 
 // SetTasksStatusIfStatus saves the status of the task in the database if current status is currentStatus
-func SetTasksStatusIfStatus(currentStatus string, db *sql.DB, newStatus string, verbose, debug bool) error {
+func (db *DB) SetTasksStatusIfStatus(currentStatus, newStatus string, verbose, debug bool) error {
 
 	// Update the status column of the task table for the given ID
-	query := "UPDATE task SET status = ?, updatedAt = NOW() WHERE status = ?"
+	query := "UPDATE task SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE status = ?"
 	_, err := execWithRetry(db, false, query, newStatus, currentStatus)
 	if err != nil {
 		if debug || verbose {
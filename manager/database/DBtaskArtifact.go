@@ -0,0 +1,51 @@
+package database
+
+import (
+	"log"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+// addTaskArtifactsTx saves the artifacts collected by the worker in the execution of the task with
+// the given retries, the keys in the result store are set here and not taken from the worker
+func addTaskArtifactsTx(tx *Tx, id string, retries int, artifacts []globalstructs.Artifact) error {
+	attempt := retries + 1
+	const q = `INSERT INTO task_artifact (taskID, attempt, num, path, artifactKey, size) VALUES (?, ?, ?, ?, ?, ?)`
+	for num, artifact := range artifacts {
+		key := globalstructs.ArtifactKey(id, retries, num)
+		if _, err := txExec(tx, q, id, attempt, num, artifact.Path, key, artifact.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTaskArtifacts returns the artifacts of a task, of every attempt if attempt is 0
+func (db *DB) GetTaskArtifacts(id string, attempt int, verbose, debug bool) ([]globalstructs.Artifact, error) {
+	q := `SELECT num, attempt, path, artifactKey, size FROM task_artifact WHERE taskID = ?`
+	args := []interface{}{id}
+	if attempt > 0 {
+		q += " AND attempt = ?"
+		args = append(args, attempt)
+	}
+	q += " ORDER BY attempt ASC, num ASC"
+
+	rows, err := dbQuery(db, q, args...)
+	if err != nil {
+		if debug {
+			log.Println("GetTaskArtifacts query error:", err)
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := []globalstructs.Artifact{}
+	for rows.Next() {
+		var a globalstructs.Artifact
+		if err = rows.Scan(&a.Num, &a.Attempt, &a.Path, &a.Key, &a.Size); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
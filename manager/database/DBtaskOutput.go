@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+// AddTaskOutput saves a chunk of the output of a task only if it is running on workerName
+func (db *DB) AddTaskOutput(workerName string, output globalstructs.TaskOutput, verbose, debug bool) error {
+	const q = `INSERT INTO task_output (taskID, command, stream, data)
+               SELECT ID, ?, ?, ? FROM task WHERE ID = ? AND status = 'running' AND workerName = ?`
+	res, err := execWithRetry(db, true, q, output.Command, output.Stream, output.Data, output.ID, workerName)
+	if err != nil {
+		return fmt.Errorf("AddTaskOutput: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("AddTaskOutput: task %s is not running on worker %s", output.ID, workerName)
+	}
+	return nil
+}
+
+// GetTaskOutputs returns up to limit chunks of the output of a task with seq greater than afterSeq
+func (db *DB) GetTaskOutputs(id string, afterSeq int64, limit int, verbose, debug bool) ([]globalstructs.TaskOutput, error) {
+	if limit <= 0 {
+		limit = defaultSelectLimit
+	}
+	const q = `SELECT seq, taskID, command, stream, data, createdAt FROM task_output
+               WHERE taskID = ? AND seq > ? ORDER BY seq ASC LIMIT ?`
+	rows, err := dbQuery(db, q, id, afterSeq, limit)
+	if err != nil {
+		if debug {
+			log.Println("GetTaskOutputs query error:", err)
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outputs []globalstructs.TaskOutput
+	for rows.Next() {
+		var o globalstructs.TaskOutput
+		if err = rows.Scan(&o.Seq, &o.ID, &o.Command, &o.Stream, &o.Data, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+	return outputs, rows.Err()
+}
+
+// DeleteTaskOutputs removes the streamed output of a task, used before a new attempt
+func (db *DB) DeleteTaskOutputs(id string, verbose, debug bool) error {
+	_, err := execWithRetry(db, false, "DELETE FROM task_output WHERE taskID = ?", id)
+	if err != nil && (verbose || debug) {
+		log.Println("DB Error DeleteTaskOutputs:", err)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+const tokenSelectCols = `ID, name, kind, username, role, scopes, expiresAt, lastUsedAt, createdBy, createdAt`
+
+// HashToken returns the hash of a token saved in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddToken inserts a new API token, only the hash of token.Token is saved
+func (db *DB) AddToken(token globalstructs.Token, expiresAt *time.Time, verbose, debug bool) error {
+	const q = `INSERT INTO api_token (ID, name, hash, kind, username, role, scopes, expiresAt, createdBy)
+               VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	scopesJSON, err := serializeToJSON(token.Scopes)
+	if err != nil {
+		return err
+	}
+	if _, err := execWithRetry(db, true, q, token.ID, token.Name, HashToken(token.Token), token.Kind,
+		token.Username, token.Role, scopesJSON, expiresAt, token.CreatedBy); err != nil {
+		return fmt.Errorf("AddToken: %w", err)
+	}
+	if debug {
+		log.Println("AddToken", token.ID, token.Kind, token.Username)
+	}
+	return nil
+}
+
+// RmToken deletes an API token, the requests with it are rejected from now on
+func (db *DB) RmToken(id string, verbose, debug bool) error {
+	res, err := execWithRetry(db, false, "DELETE FROM api_token WHERE ID = ?", id)
+	if err != nil {
+		return fmt.Errorf("RmToken: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("RmToken: token %s not found", id)
+	}
+	return nil
+}
+
+// GetTokens returns every API token without the token itself
+func (db *DB) GetTokens(verbose, debug bool) ([]globalstructs.Token, error) {
+	q := "SELECT " + tokenSelectCols + " FROM api_token ORDER BY createdAt ASC"
+	return getTokensSQL(q, nil, db, verbose, debug)
+}
+
+// GetToken fetches a single API token by ID
+func (db *DB) GetToken(id string, verbose, debug bool) (globalstructs.Token, error) {
+	q := "SELECT " + tokenSelectCols + " FROM api_token WHERE ID = ?"
+	return getTokenSQL(q, []interface{}{id}, db, verbose, debug)
+}
+
+// GetTokenByValue returns the API token with the hash of token if it hasn't expired at now,
+// sql.ErrNoRows if there is none
+func (db *DB) GetTokenByValue(token string, now time.Time, verbose, debug bool) (globalstructs.Token, error) {
+	q := "SELECT " + tokenSelectCols + " FROM api_token WHERE hash = ? AND (expiresAt IS NULL OR expiresAt > ?)"
+	return getTokenSQL(q, []interface{}{HashToken(token), now}, db, verbose, debug)
+}
+
+// SetTokenLastUsed saves when an API token was last used
+func (db *DB) SetTokenLastUsed(id string, lastUsedAt time.Time, verbose, debug bool) error {
+	if _, err := execWithRetry(db, false, "UPDATE api_token SET lastUsedAt = ? WHERE ID = ?", lastUsedAt, id); err != nil {
+		return fmt.Errorf("SetTokenLastUsed: %w", err)
+	}
+	return nil
+}
+
+func getTokenSQL(sqlQuery string, args []interface{}, db *DB, verbose, debug bool) (globalstructs.Token, error) {
+	tokens, err := getTokensSQL(sqlQuery, args, db, verbose, debug)
+	if err != nil {
+		return globalstructs.Token{}, err
+	}
+	if len(tokens) == 0 {
+		return globalstructs.Token{}, sql.ErrNoRows
+	}
+	return tokens[0], nil
+}
+
+func getTokensSQL(sqlQuery string, args []interface{}, db *DB, verbose, debug bool) ([]globalstructs.Token, error) {
+	rows, err := dbQuery(db, sqlQuery, args...)
+	if err != nil {
+		if debug {
+			log.Println("getTokensSQL query error:", err)
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []globalstructs.Token{}
+	for rows.Next() {
+		var (
+			t                   globalstructs.Token
+			scopesStr           string
+			expiresAt, lastUsed sql.NullString
+		)
+		if err = rows.Scan(&t.ID, &t.Name, &t.Kind, &t.Username, &t.Role, &scopesStr,
+			&expiresAt, &lastUsed, &t.CreatedBy, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(scopesStr), &t.Scopes); err != nil {
+			return nil, fmt.Errorf("parse scopes: %w", err)
+		}
+		t.ExpiresAt, t.LastUsedAt = expiresAt.String, lastUsed.String
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -13,17 +14,21 @@ import (
 // -------------------------------------------------------------------------
 
 // AddWorker inserts a new worker row.
-func AddWorker(db *sql.DB, w *globalstructs.Worker, verbose, debug bool) error {
-	const q = `INSERT INTO worker (name, defaultThreads, iddleThreads, up, downCount, updatedAt)
-	           VALUES (?, ?, ?, ?, ?, NOW())`
-	if _, err := execWithRetry(db, true, q, w.Name, w.DefaultThreads, w.IddleThreads, w.UP, w.DownCount); err != nil {
+func (db *DB) AddWorker(w *globalstructs.Worker, verbose, debug bool) error {
+	const q = `INSERT INTO worker (name, defaultThreads, iddleThreads, up, downCount, labels, modules, updatedAt)
+	           VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	labelsJSON, modulesJSON, err := prepareWorkerQuery(w)
+	if err != nil {
+		return err
+	}
+	if _, err := execWithRetry(db, true, q, w.Name, w.DefaultThreads, w.IddleThreads, w.UP, w.DownCount, labelsJSON, modulesJSON); err != nil {
 		return fmt.Errorf("AddWorker: %w", err)
 	}
 	return nil
 }
 
 // RmWorkerName deletes a worker by name and detaches its running tasks.
-func RmWorkerName(db *sql.DB, name string, verbose, debug bool) error {
+func (db *DB) RmWorkerName(name string, verbose, debug bool) error {
 	const del = `DELETE FROM worker WHERE name = ?`
 	res, err := execWithRetry(db, false, del, name)
 	if err != nil {
@@ -33,7 +38,7 @@ func RmWorkerName(db *sql.DB, name string, verbose, debug bool) error {
 		return fmt.Errorf("RmWorkerName: worker %s not found", name)
 	}
 	// orphan tasks → pending
-	if err := SetTasksWorkerPending(db, name, verbose, debug); err != nil {
+	if err := db.SetTasksWorkerPending(name, verbose, debug); err != nil {
 		return err
 	}
 	if err := clearWorkerName(db, name, verbose, debug); err != nil {
@@ -46,16 +51,16 @@ func RmWorkerName(db *sql.DB, name string, verbose, debug bool) error {
 // Select helpers
 // -------------------------------------------------------------------------
 
-const workerSelectCols = `name, defaultThreads, iddleThreads, up, downCount, updatedAt`
+const workerSelectCols = `name, defaultThreads, iddleThreads, up, downCount, updatedAt, labels, modules`
 
 // GetWorkers returns every row in the worker table.
-func GetWorkers(db *sql.DB, verbose, debug bool) ([]globalstructs.Worker, error) {
+func (db *DB) GetWorkers(verbose, debug bool) ([]globalstructs.Worker, error) {
 	q := "SELECT " + workerSelectCols + " FROM worker"
 	return getWorkerSQL(q, db, verbose, debug)
 }
 
 // GetWorker fetches a single worker by name.
-func GetWorker(db *sql.DB, name string, verbose, debug bool) (globalstructs.Worker, error) {
+func (db *DB) GetWorker(name string, verbose, debug bool) (globalstructs.Worker, error) {
 	q := "SELECT " + workerSelectCols + " FROM worker WHERE name = ?"
 	rows, err := getWorkerSQL(q, db, verbose, debug, name)
 	if err != nil {
@@ -68,13 +73,13 @@ func GetWorker(db *sql.DB, name string, verbose, debug bool) (globalstructs.Work
 }
 
 // GetWorkerIddle returns workers that are up and have spare threads.
-func GetWorkerIddle(db *sql.DB, verbose, debug bool) ([]globalstructs.Worker, error) {
-	q := "SELECT " + workerSelectCols + " FROM worker WHERE up = TRUE AND iddleThreads > 0 ORDER BY RAND()"
+func (db *DB) GetWorkerIddle(verbose, debug bool) ([]globalstructs.Worker, error) {
+	q := "SELECT " + workerSelectCols + " FROM worker WHERE up = TRUE AND iddleThreads > 0 ORDER BY " + db.backend.Random()
 	return getWorkerSQL(q, db, verbose, debug)
 }
 
 // GetWorkerUP returns all workers with up = true.
-func GetWorkerUP(db *sql.DB, verbose, debug bool) ([]globalstructs.Worker, error) {
+func (db *DB) GetWorkerUP(verbose, debug bool) ([]globalstructs.Worker, error) {
 	q := "SELECT " + workerSelectCols + " FROM worker WHERE up = TRUE"
 	return getWorkerSQL(q, db, verbose, debug)
 }
@@ -84,9 +89,13 @@ func GetWorkerUP(db *sql.DB, verbose, debug bool) ([]globalstructs.Worker, error
 // -------------------------------------------------------------------------
 
 // UpdateWorker replaces every mutable column of the given worker.
-func UpdateWorker(db *sql.DB, w *globalstructs.Worker, verbose, debug bool) error {
-	const q = `UPDATE worker SET defaultThreads = ?, iddleThreads = ?, up = ?, downCount = ?, updatedAt = NOW() WHERE name = ?`
-	res, err := execWithRetry(db, false, q, w.DefaultThreads, w.IddleThreads, w.UP, w.DownCount, w.Name)
+func (db *DB) UpdateWorker(w *globalstructs.Worker, verbose, debug bool) error {
+	const q = `UPDATE worker SET defaultThreads = ?, iddleThreads = ?, up = ?, downCount = ?, labels = ?, modules = ?, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
+	labelsJSON, modulesJSON, err := prepareWorkerQuery(w)
+	if err != nil {
+		return err
+	}
+	res, err := execWithRetry(db, false, q, w.DefaultThreads, w.IddleThreads, w.UP, w.DownCount, labelsJSON, modulesJSON, w.Name)
 	if err != nil {
 		return fmt.Errorf("UpdateWorker: %w", err)
 	}
@@ -96,9 +105,26 @@ func UpdateWorker(db *sql.DB, w *globalstructs.Worker, verbose, debug bool) erro
 	return nil
 }
 
+// SetWorkerModules replaces the modules of the worker.
+func (db *DB) SetWorkerModules(name string, modules []string, verbose, debug bool) error {
+	const q = `UPDATE worker SET modules = ?, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
+	modulesJSON, err := serializeToJSON(modules)
+	if err != nil {
+		return err
+	}
+	res, err := execWithRetry(db, false, q, modulesJSON, name)
+	if err != nil {
+		return fmt.Errorf("SetWorkerModules: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("SetWorkerModules: worker %s not found", name)
+	}
+	return nil
+}
+
 // SetWorkerUPto toggles the up column.
-func SetWorkerUPto(db *sql.DB, name string, up bool, verbose, debug bool) error {
-	const q = `UPDATE worker SET up = ?, updatedAt = NOW() WHERE name = ?`
+func (db *DB) SetWorkerUPto(name string, up bool, verbose, debug bool) error {
+	const q = `UPDATE worker SET up = ?, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
 	res, err := execWithRetry(db, false, q, up, name)
 	if err != nil {
 		return fmt.Errorf("SetWorkerUPto: %w", err)
@@ -112,7 +138,7 @@ func SetWorkerUPto(db *sql.DB, name string, up bool, verbose, debug bool) error
 	if n == 0 {
 		// Check existence explicitly
 		var dummy int
-		err := db.QueryRow("SELECT 1 FROM worker WHERE name = ?", name).Scan(&dummy)
+		err := dbQueryRow(db, "SELECT 1 FROM worker WHERE name = ?", name).Scan(&dummy)
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("SetWorkerUPto: worker %s not found", name)
 		} else if err != nil {
@@ -128,8 +154,8 @@ func SetWorkerUPto(db *sql.DB, name string, up bool, verbose, debug bool) error
 }
 
 // SetIddleThreadsTo sets the iddleThreads value.
-func SetIddleThreadsTo(db *sql.DB, name string, idle int, verbose, debug bool) error {
-	const q = `UPDATE worker SET iddleThreads = ?, updatedAt = NOW() WHERE name = ?`
+func (db *DB) SetIddleThreadsTo(name string, idle int, verbose, debug bool) error {
+	const q = `UPDATE worker SET iddleThreads = ?, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
 	res, err := execWithRetry(db, false, q, idle, name)
 	if err != nil {
 		return fmt.Errorf("SetIddleThreadsTo: %w", err)
@@ -141,8 +167,8 @@ func SetIddleThreadsTo(db *sql.DB, name string, idle int, verbose, debug bool) e
 }
 
 // SubtractWorkerIddleThreads1 decrements iddleThreads by 1 if > 0.
-func SubtractWorkerIddleThreads1(db *sql.DB, name string, verbose, debug bool) error {
-	const q = `UPDATE worker SET iddleThreads = CASE WHEN iddleThreads > 0 THEN iddleThreads - 1 ELSE 0 END, updatedAt = NOW() WHERE name = ?`
+func (db *DB) SubtractWorkerIddleThreads1(name string, verbose, debug bool) error {
+	const q = `UPDATE worker SET iddleThreads = CASE WHEN iddleThreads > 0 THEN iddleThreads - 1 ELSE 0 END, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
 	res, err := execWithRetry(db, false, q, name)
 	if err != nil {
 		return fmt.Errorf("SubtractWorkerIddleThreads1: %w", err)
@@ -155,16 +181,16 @@ func SubtractWorkerIddleThreads1(db *sql.DB, name string, verbose, debug bool) e
 
 // Down‑count helpers -------------------------------------------------------
 
-func GetWorkerDownCount(db *sql.DB, name string, verbose, debug bool) (int, error) {
+func (db *DB) GetWorkerDownCount(name string, verbose, debug bool) (int, error) {
 	var dc int
-	if err := db.QueryRow("SELECT downCount FROM worker WHERE name = ?", name).Scan(&dc); err != nil {
+	if err := dbQueryRow(db, "SELECT downCount FROM worker WHERE name = ?", name).Scan(&dc); err != nil {
 		return 0, err
 	}
 	return dc, nil
 }
 
-func SetWorkerDownCount(db *sql.DB, name string, count int, verbose, debug bool) error {
-	const q = `UPDATE worker SET downCount = ?, updatedAt = NOW() WHERE name = ?`
+func (db *DB) SetWorkerDownCount(name string, count int, verbose, debug bool) error {
+	const q = `UPDATE worker SET downCount = ?, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
 	res, err := execWithRetry(db, false, q, count, name)
 	if err != nil {
 		return fmt.Errorf("SetWorkerDownCount: %w", err)
@@ -175,8 +201,8 @@ func SetWorkerDownCount(db *sql.DB, name string, count int, verbose, debug bool)
 	return nil
 }
 
-func AddWorkerDownCount(db *sql.DB, name string, verbose, debug bool) error {
-	const q = `UPDATE worker SET downCount = downCount + 1, updatedAt = NOW() WHERE name = ?`
+func (db *DB) AddWorkerDownCount(name string, verbose, debug bool) error {
+	const q = `UPDATE worker SET downCount = downCount + 1, updatedAt = CURRENT_TIMESTAMP WHERE name = ?`
 	res, err := execWithRetry(db, false, q, name)
 	if err != nil {
 		return fmt.Errorf("AddWorkerDownCount: %w", err)
@@ -191,18 +217,18 @@ func AddWorkerDownCount(db *sql.DB, name string, verbose, debug bool) error {
 // Simple aggregates
 // -------------------------------------------------------------------------
 
-func GetUpCount(db *sql.DB, verbose, debug bool) (int, error) {
+func (db *DB) GetUpCount(verbose, debug bool) (int, error) {
 	return getBoolCount(db, true)
 }
 
-func GetDownCount(db *sql.DB, verbose, debug bool) (int, error) {
+func (db *DB) GetDownCount(verbose, debug bool) (int, error) {
 	return getBoolCount(db, false)
 }
 
-func getBoolCount(db *sql.DB, up bool) (int, error) {
+func getBoolCount(db *DB, up bool) (int, error) {
 	query := "SELECT COUNT(*) FROM worker WHERE up = ?"
 	var c int
-	if err := db.QueryRow(query, up).Scan(&c); err != nil {
+	if err := dbQueryRow(db, query, up).Scan(&c); err != nil {
 		return 0, err
 	}
 	return c, nil
@@ -212,8 +238,8 @@ func getBoolCount(db *sql.DB, up bool) (int, error) {
 // Row‑mapper
 // -------------------------------------------------------------------------
 
-func getWorkerSQL(sqlStr string, db *sql.DB, verbose, debug bool, args ...interface{}) ([]globalstructs.Worker, error) {
-	rows, err := db.Query(sqlStr, args...)
+func getWorkerSQL(sqlStr string, db *DB, verbose, debug bool, args ...interface{}) ([]globalstructs.Worker, error) {
+	rows, err := dbQuery(db, sqlStr, args...)
 	if err != nil {
 		if debug {
 			log.Println("getWorkerSQL query error:", err)
@@ -224,11 +250,38 @@ func getWorkerSQL(sqlStr string, db *sql.DB, verbose, debug bool, args ...interf
 
 	var workers []globalstructs.Worker
 	for rows.Next() {
-		var w globalstructs.Worker
-		if err = rows.Scan(&w.Name, &w.DefaultThreads, &w.IddleThreads, &w.UP, &w.DownCount, &w.UpdatedAt); err != nil {
+		var (
+			w          globalstructs.Worker
+			labelsStr  sql.NullString
+			modulesStr sql.NullString
+		)
+		if err = rows.Scan(&w.Name, &w.DefaultThreads, &w.IddleThreads, &w.UP, &w.DownCount, &w.UpdatedAt, &labelsStr, &modulesStr); err != nil {
 			return nil, err
 		}
+		if labelsStr.Valid && labelsStr.String != "" {
+			if err = json.Unmarshal([]byte(labelsStr.String), &w.Labels); err != nil {
+				return nil, fmt.Errorf("parse labels: %w", err)
+			}
+		}
+		if modulesStr.Valid && modulesStr.String != "" {
+			if err = json.Unmarshal([]byte(modulesStr.String), &w.Modules); err != nil {
+				return nil, fmt.Errorf("parse modules: %w", err)
+			}
+		}
 		workers = append(workers, w)
 	}
 	return workers, rows.Err()
 }
+
+// prepareWorkerQuery serializes the JSON columns of a worker.
+func prepareWorkerQuery(w *globalstructs.Worker) (labelsJSON, modulesJSON string, err error) {
+	labelsJSON, err = serializeToJSON(w.Labels)
+	if err != nil {
+		return "", "", err
+	}
+	modulesJSON, err = serializeToJSON(w.Modules)
+	if err != nil {
+		return "", "", err
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backend is a SQL database where the manager stores tasks and workers.
+// The methods of DB use the SQL common to every backend and ask the backend
+// of the DB for the parts that differ.
+type Backend interface {
+	// Name of the backend in the dbDriver option of the manager and
+	// of its directory in migrations
+	Name() string
+	// Open returns the connection pool, for sqlite database is the path of the file
+	Open(username, password, host, port, database string, debug bool) (*sql.DB, error)
+	// Rebind converts the "?" placeholders of a query to the ones of the backend
+	Rebind(query string) string
+	// Random returns the SQL function to order rows randomly
+	Random() string
+	// IsDuplicateKey returns true if the error is an insert of a primary key that already exists
+	IsDuplicateKey(err error) bool
+	// IsDeadlock returns true if the statement failed by a lock and can be retried
+	IsDeadlock(err error) bool
+	// Timestamp returns the value of a time argument compared with the TIMESTAMP columns
+	Timestamp(t time.Time) interface{}
+	// Text returns a column as text, to filter the TIMESTAMP columns with LIKE
+	Text(column string) string
+	// CountTables returns the query that counts the tables named like its argument
+	CountTables() string
+	// LockUser returns the statement that makes the transactions of the user of its argument
+	// wait for each other until they end, to check the quotas of the user
+	LockUser() string
+	// LockMigrations returns the statements that make the migrations of the other managers wait
+	// until unlock, both run on the same connection. Empty if the backend doesn't need them
+	LockMigrations() (lock, unlock string)
+}
+
+// backends by name, each one registers itself in the init of its file
+var backends = map[string]Backend{}
+
+func registerBackend(b Backend) {
+	backends[b.Name()] = b
+}
+
+func getBackend(name string) (Backend, error) {
+	if name == "" {
+		name = "mysql"
+	}
+	b, ok := backends[name]
+	if !ok {
+		available := make([]string, 0, len(backends))
+		for n := range backends {
+			available = append(available, n)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("unknown database backend %q (available: %s)", name, strings.Join(available, ", "))
+	}
+	return b, nil
+}
+
+// rebindDollar converts "?" to $1, $2... outside quoted strings
+func rebindDollar(query string) string {
+	var sb strings.Builder
+	sb.Grow(len(query) + 16)
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// bindArgs returns the arguments of a query with the times converted by backend.Timestamp
+func bindArgs(backend Backend, args []interface{}) []interface{} {
+	bound := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch t := arg.(type) {
+		case time.Time:
+			bound[i] = backend.Timestamp(t)
+		case *time.Time:
+			if t != nil {
+				bound[i] = backend.Timestamp(*t)
+			}
+		default:
+			bound[i] = arg
+		}
+	}
+	return bound
+}
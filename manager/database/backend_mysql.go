@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlBackend MySQL and MariaDB, the default backend
+type mysqlBackend struct{}
+
+func init() {
+	registerBackend(mysqlBackend{})
+}
+
+func (mysqlBackend) Name() string { return "mysql" }
+
+func (mysqlBackend) Open(username, password, host, port, database string, debug bool) (*sql.DB, error) {
+	dsn := fmt.Sprintf(
+		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local&clientFoundRows=true",
+		username,
+		password,
+		host,
+		port,
+		database,
+	)
+	if debug {
+		log.Println("DB ConnectDB - DSN:", dsn)
+	}
+	return sql.Open("mysql", dsn)
+}
+
+func (mysqlBackend) Rebind(query string) string { return query }
+
+func (mysqlBackend) Random() string { return "RAND()" }
+
+func (mysqlBackend) IsDuplicateKey(err error) bool {
+	var merr *mysql.MySQLError
+	return errors.As(err, &merr) && merr.Number == 1062 // duplicate entry
+}
+
+func (mysqlBackend) IsDeadlock(err error) bool {
+	var merr *mysql.MySQLError
+	return errors.As(err, &merr) && merr.Number == 1213 // deadlock found
+}
+
+// Timestamp is converted by the driver to the loc of the DSN
+func (mysqlBackend) Timestamp(t time.Time) interface{} { return t }
+
+func (mysqlBackend) Text(column string) string { return column }
+
+func (mysqlBackend) CountTables() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+}
+
+// LockUser locks the range of the pending tasks of the user in the index, the inserts wait for the lock
+func (mysqlBackend) LockUser() string {
+	return "SELECT COUNT(*) FROM task WHERE status = 'pending' AND username = ? FOR UPDATE"
+}
+
+// LockMigrations named lock of the session, waits without a timeout
+func (mysqlBackend) LockMigrations() (string, string) {
+	return "SELECT GET_LOCK('ntask_migrations', -1)", "SELECT RELEASE_LOCK('ntask_migrations')"
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver
+)
+
+// postgresBackend PostgreSQL
+type postgresBackend struct{}
+
+func init() {
+	registerBackend(postgresBackend{})
+}
+
+func (postgresBackend) Name() string { return "postgres" }
+
+func (postgresBackend) Open(username, password, host, port, database string, debug bool) (*sql.DB, error) {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(username, password),
+		Host:   host + ":" + port,
+		Path:   "/" + database,
+	}
+	if debug {
+		log.Println("DB ConnectDB - DSN:", dsn.String())
+	}
+	return sql.Open("pgx", dsn.String())
+}
+
+func (postgresBackend) Rebind(query string) string { return rebindDollar(query) }
+
+func (postgresBackend) Random() string { return "RANDOM()" }
+
+func (postgresBackend) IsDuplicateKey(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" // unique_violation
+}
+
+func (postgresBackend) IsDeadlock(err error) bool {
+	var pgErr *pgconn.PgError
+	// deadlock_detected or serialization_failure
+	return errors.As(err, &pgErr) && (pgErr.Code == "40P01" || pgErr.Code == "40001")
+}
+
+func (postgresBackend) Timestamp(t time.Time) interface{} { return t }
+
+// Text the timestamp columns don't support LIKE
+func (postgresBackend) Text(column string) string { return "CAST(" + column + " AS TEXT)" }
+
+func (postgresBackend) CountTables() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+func (postgresBackend) LockUser() string { return "SELECT pg_advisory_xact_lock(hashtext(?))" }
+
+// LockMigrations advisory lock of the session
+func (postgresBackend) LockMigrations() (string, string) {
+	return "SELECT pg_advisory_lock(hashtext('ntask_migrations'))", "SELECT pg_advisory_unlock(hashtext('ntask_migrations'))"
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+// sqliteBackend embedded SQLite database file
+type sqliteBackend struct{}
+
+func init() {
+	registerBackend(sqliteBackend{})
+}
+
+func (sqliteBackend) Name() string { return "sqlite" }
+
+// Open uses database as the path of the file, the other parameters are ignored
+func (sqliteBackend) Open(username, password, host, port, database string, debug bool) (*sql.DB, error) {
+	// WAL and busy_timeout let the manager goroutines read while one writes
+	dsn := "file:" + database + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"
+	if debug {
+		log.Println("DB ConnectDB - DSN:", dsn)
+	}
+	return sql.Open("sqlite", dsn)
+}
+
+func (sqliteBackend) Rebind(query string) string { return query }
+
+func (sqliteBackend) Random() string { return "RANDOM()" }
+
+func (sqliteBackend) IsDuplicateKey(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (sqliteBackend) IsDeadlock(err error) bool {
+	return strings.Contains(err.Error(), "database is locked") || strings.Contains(err.Error(), "SQLITE_BUSY")
+}
+
+// Timestamp SQLite compares the timestamps as text, in the UTC format of CURRENT_TIMESTAMP
+func (sqliteBackend) Timestamp(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (sqliteBackend) Text(column string) string { return column }
+
+func (sqliteBackend) CountTables() string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+// LockUser starts writing, SQLite runs a single write transaction at a time
+func (sqliteBackend) LockUser() string {
+	return "UPDATE task SET updatedAt = updatedAt WHERE username = ? AND 1 = 0"
+}
+
+// LockMigrations none, SQLite runs a single write transaction at a time and each migration
+// checks in its transaction that it wasn't applied by another manager
+func (sqliteBackend) LockMigrations() (string, string) { return "", "" }
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB returns an empty SQLite database in a temporary file, or the PostgreSQL
+// database of NTASK_TEST_POSTGRES_URL if it is set
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	if raw := os.Getenv("NTASK_TEST_POSTGRES_URL"); raw != "" {
+		return openPostgresTestDB(t, raw)
+	}
+	db, err := ConnectDB("sqlite", "", "", "", "", filepath.Join(t.TempDir(), "ntask.db"), false, false)
+	if err != nil {
+		t.Fatalf("ConnectDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// migrationsFS up-migrations of every backend, migrations/<backend>/NNNN_name.sql
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration SQL file that changes the schema from Version-1 to Version
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Statements returns the statements of the migration without the comments
+func (m Migration) Statements() []string {
+	return splitStatements(m.SQL)
+}
+
+// splitStatements splits SQL on the ";" that end its statements, not on the ones in quotes,
+// comments or in the BEGIN ... END body of a trigger. The comments are removed
+func splitStatements(sql string) []string {
+	var (
+		stmts []string
+		stmt  strings.Builder
+		depth int // BEGIN and CASE blocks open
+	)
+	add := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		stmt.Reset()
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end - 1
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			stmt.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			// A quote is escaped by doubling it
+			end := i + 1
+			for end < len(sql) && sql[end] != c {
+				end++
+			}
+			stmt.WriteString(sql[i:min(end+1, len(sql))])
+			i = end
+		case c == '$' && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sql) - i - len(tag)
+			} else {
+				end += len(tag)
+			}
+			stmt.WriteString(sql[i : i+len(tag)+end])
+			i += len(tag) + end - 1
+		case c == ';' && depth == 0:
+			add()
+		case isWordStart(sql, i):
+			word := sqlWord(sql[i:])
+			switch strings.ToUpper(word) {
+			case "BEGIN", "CASE":
+				depth++
+			case "END":
+				// END IF, END LOOP... close blocks that weren't counted
+				next := strings.ToUpper(sqlWord(strings.TrimLeft(sql[i+len(word):], " \t\r\n")))
+				if depth > 0 && next != "IF" && next != "LOOP" && next != "WHILE" && next != "REPEAT" {
+					depth--
+				}
+			}
+			stmt.WriteString(word)
+			i += len(word) - 1
+		default:
+			stmt.WriteByte(c)
+		}
+	}
+	add()
+	return stmts
+}
+
+// dollarTag returns the $tag$ that starts s, a PostgreSQL dollar quote, or "" if there is none
+func dollarTag(s string) string {
+	end := strings.IndexByte(s[1:], '$')
+	if end < 0 {
+		return ""
+	}
+	tag := s[:end+2]
+	for j, r := range tag[1 : len(tag)-1] {
+		if !(r == '_' || unicode.IsLetter(r) || (unicode.IsDigit(r) && j > 0)) {
+			return ""
+		}
+	}
+	return tag
+}
+
+// isWordStart returns true if a word starts at sql[i]
+func isWordStart(sql string, i int) bool {
+	return isWordByte(sql[i]) && (i == 0 || !isWordByte(sql[i-1]))
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// sqlWord returns the word at the start of s
+func sqlWord(s string) string {
+	end := 0
+	for end < len(s) && isWordByte(s[end]) {
+		end++
+	}
+	return s[:end]
+}
+
+// migrations returns the migrations of the backend ordered by version
+func migrations(backendName string) ([]Migration, error) {
+	dir := path.Join("migrations", backendName)
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for backend %s: %w", backendName, err)
+	}
+
+	var list []Migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s", name)
+		}
+		data, err := migrationsFS.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: strings.TrimSuffix(name, ".sql"), SQL: string(data)})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %s out of order, expected version %d", m.Name, i+1)
+		}
+	}
+	return list, nil
+}
+
+// SchemaVersion returns the last migration applied to the database, 0 if none
+func (db *DB) SchemaVersion(verbose, debug bool) (int, error) {
+	// The table doesn't exist before the first migration
+	var tables int
+	if err := dbQueryRow(db, db.backend.CountTables(), "schema_version").Scan(&tables); err != nil {
+		return 0, fmt.Errorf("SchemaVersion: %w", err)
+	}
+	if tables == 0 {
+		if debug {
+			log.Println("SchemaVersion: no schema_version table")
+		}
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	if err := dbQueryRow(db, "SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("SchemaVersion: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// PendingMigrations returns the current version of the database and the migrations not applied
+func (db *DB) PendingMigrations(verbose, debug bool) (int, []Migration, error) {
+	list, err := migrations(db.backend.Name())
+	if err != nil {
+		return 0, nil, err
+	}
+	current, err := db.SchemaVersion(verbose, debug)
+	if err != nil {
+		return 0, nil, err
+	}
+	if current > len(list) {
+		return current, nil, fmt.Errorf("database schema version %d is newer than this manager (%d)", current, len(list))
+	}
+	return current, list[current:], nil
+}
+
+// Migrate applies the pending migrations in order and returns them,
+// with dryRun the migrations are only returned. The first one creates the schema_version table.
+// The managers that start at the same time apply them one after the other with a lock of the backend.
+// The migrations run on their own connection without a timeout, they can rewrite big tables,
+// and are not retried. Each migration runs in a transaction, but MySQL commits every DDL
+// statement: if one fails the previous statements of its migration stay applied and the
+// version isn't saved, see the README to recover
+func (db *DB) Migrate(dryRun, verbose, debug bool) ([]Migration, error) {
+	current, pending, err := db.PendingMigrations(verbose, debug)
+	if err != nil || dryRun || len(pending) == 0 {
+		return pending, err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Migrate: %w", err)
+	}
+	defer conn.Close()
+
+	// Another manager may be applying the same migrations, read them again after its lock
+	lock, unlock := db.backend.LockMigrations()
+	if lock != "" {
+		if _, err := conn.ExecContext(ctx, lock); err != nil {
+			return nil, fmt.Errorf("Migrate: lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, unlock)
+		if current, pending, err = db.PendingMigrations(verbose, debug); err != nil || len(pending) == 0 {
+			return pending, err
+		}
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		if verbose || debug {
+			log.Printf("Migrate: applying %s (version %d → %d)", m.Name, current, m.Version)
+		}
+		ok, err := applyMigration(ctx, conn, db.backend, m)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, m)
+		}
+		current = m.Version
+	}
+	return applied, nil
+}
+
+// applyMigration runs the statements of the migration and saves its version in a transaction,
+// MySQL commits each DDL statement so the version is saved after all of them. Returns false
+// if the migration was applied by another manager
+func applyMigration(ctx context.Context, conn *sql.Conn, backend Backend, m Migration) (bool, error) {
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	tx := &Tx{Tx: sqlTx, backend: backend}
+	// The first migration creates schema_version
+	if m.Version > 1 {
+		var saved int
+		if err := txQueryRow(tx, "SELECT COUNT(*) FROM schema_version WHERE version = ?", m.Version).Scan(&saved); err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("%s: reading the version: %w", m.Name, err)
+		}
+		if saved > 0 {
+			tx.Rollback()
+			return false, nil
+		}
+	}
+	for _, stmt := range m.Statements() {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("%s: executing %q: %w", m.Name, stmt, err)
+		}
+	}
+	if _, err := txExec(tx, "INSERT INTO schema_version (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("%s: saving the version: %w", m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"statements", "CREATE TABLE a (x INT);\nCREATE TABLE b (y INT);\n", []string{"CREATE TABLE a (x INT)", "CREATE TABLE b (y INT)"}},
+		{"comments", "-- first; table\nCREATE TABLE a (x INT); /* b; */ DROP TABLE c", []string{"CREATE TABLE a (x INT)", "DROP TABLE c"}},
+		{"quotes", "INSERT INTO a VALUES ('x;y', 'it''s;');\nSELECT \"a;b\", `c;d`", []string{"INSERT INTO a VALUES ('x;y', 'it''s;')", "SELECT \"a;b\", `c;d`"}},
+		{"dollar quotes", "CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL; SELECT $$;$$",
+			[]string{"CREATE FUNCTION f() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL", "SELECT $$;$$"}},
+		{"trigger", "CREATE TRIGGER t AFTER INSERT ON a FOR EACH ROW BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN 1 ELSE 0 END;\n  IF y THEN DELETE FROM c; END IF;\nEND;\nDROP TABLE d;",
+			[]string{"CREATE TRIGGER t AFTER INSERT ON a FOR EACH ROW BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN 1 ELSE 0 END;\n  IF y THEN DELETE FROM c; END IF;\nEND", "DROP TABLE d"}},
+		{"case in a statement", "UPDATE a SET x = CASE WHEN x THEN 1 END; DROP TABLE b", []string{"UPDATE a SET x = CASE WHEN x THEN 1 END", "DROP TABLE b"}},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.sql); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: splitStatements = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The migrations have no ";" in quotes or blocks, they are split like on every ";"
+func TestMigrationStatements(t *testing.T) {
+	for _, backend := range []string{"mysql", "postgres", "sqlite"} {
+		list, err := migrations(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range list {
+			var lines []string
+			for _, line := range strings.Split(m.SQL, "\n") {
+				if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+					lines = append(lines, line)
+				}
+			}
+			var want []string
+			for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+				if stmt = strings.TrimSpace(stmt); stmt != "" {
+					want = append(want, stmt)
+				}
+			}
+			if got := m.Statements(); !slices.Equal(got, want) {
+				t.Errorf("%s %s: statements = %q, want %q", backend, m.Name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+-- Dependencies, retries, placement, groups and cancellation of the tasks.
+-- A single ALTER so the table is changed once, MySQL 8 adds the columns instantly
+ALTER TABLE task
+    ADD COLUMN dependsOn LONGTEXT,
+    ADD COLUMN maxRetries INT DEFAULT 0,
+    ADD COLUMN retryBackoffSeconds INT DEFAULT 0,
+    ADD COLUMN retries INT DEFAULT 0,
+    ADD COLUMN retryAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01',
+    ADD COLUMN requires TEXT,
+    ADD COLUMN groupID VARCHAR(255),
+    ADD COLUMN cancelGraceSeconds INT DEFAULT 0;
+
+CREATE INDEX idx_groupID ON task (groupID);
@@ -0,0 +1,14 @@
+-- Files collected by the workers after the execution of the tasks
+ALTER TABLE task ADD COLUMN artifacts TEXT;
+
+CREATE TABLE IF NOT EXISTS task_artifact (
+    taskID VARCHAR(255),
+    attempt INT,
+    num INT,
+    path TEXT,
+    artifactKey VARCHAR(255),
+    size BIGINT DEFAULT 0,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (taskID, attempt, num),
+    FOREIGN KEY (taskID) REFERENCES task(ID) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- API tokens of users and workers managed with the API, only the SHA-256 of the token is saved
+CREATE TABLE IF NOT EXISTS api_token (
+    ID VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255),
+    hash VARCHAR(64) NOT NULL UNIQUE,
+    kind VARCHAR(255),
+    username VARCHAR(255),
+    role VARCHAR(255),
+    scopes TEXT,
+    expiresAt TIMESTAMP NULL DEFAULT NULL,
+    lastUsedAt TIMESTAMP NULL DEFAULT NULL,
+    createdBy VARCHAR(255),
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
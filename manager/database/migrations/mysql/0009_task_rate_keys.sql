@@ -0,0 +1,4 @@
+-- Key of the tasks limited together by the rate limits of the manager config, e.g. the target host
+ALTER TABLE task ADD COLUMN rateKey VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_rateKey ON task (rateKey, status);
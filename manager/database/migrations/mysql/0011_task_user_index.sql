@@ -0,0 +1,2 @@
+-- Pending tasks of each user, read by the fair share and the quotas of the manager
+CREATE INDEX idx_status_username ON task (status, username);
@@ -0,0 +1,2 @@
+-- Running tasks deleted by the user, they stay running until their worker stops them
+ALTER TABLE task ADD COLUMN cancelRequested BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+-- The manager fills task_command with the commands of the tasks older than migration 10 in
+-- batches after the migrations, lastID is the last task filled
+CREATE TABLE IF NOT EXISTS task_command_backfill (
+    lastID VARCHAR(255) NOT NULL,
+    done BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO task_command_backfill (lastID, done) VALUES ('', FALSE);
@@ -0,0 +1,12 @@
+-- Dependencies, retries, placement, groups and cancellation of the tasks
+ALTER TABLE task
+    ADD COLUMN dependsOn TEXT,
+    ADD COLUMN maxRetries INT DEFAULT 0,
+    ADD COLUMN retryBackoffSeconds INT DEFAULT 0,
+    ADD COLUMN retries INT DEFAULT 0,
+    ADD COLUMN retryAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01',
+    ADD COLUMN requires TEXT,
+    ADD COLUMN groupID VARCHAR(255),
+    ADD COLUMN cancelGraceSeconds INT DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_groupID ON task (groupID);
@@ -0,0 +1,4 @@
+-- Labels and modules of the workers
+ALTER TABLE worker
+    ADD COLUMN labels TEXT,
+    ADD COLUMN modules TEXT;
@@ -0,0 +1,12 @@
+-- Status and exit code of the commands that ran, for the commandStatus and exitCode filters of GET /task
+CREATE TABLE IF NOT EXISTS task_command (
+    taskID VARCHAR(255),
+    num INT,
+    status VARCHAR(255) NOT NULL,
+    exitCode INT,
+    PRIMARY KEY (taskID, num),
+    FOREIGN KEY (taskID) REFERENCES task(ID) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_status ON task_command (status, exitCode, taskID);
+CREATE INDEX IF NOT EXISTS idx_command_exitCode ON task_command (exitCode, taskID);
@@ -0,0 +1,4 @@
+-- Tasks whose WorkerName was set by the user, the rest get the worker that runs them
+ALTER TABLE task ADD COLUMN workerPinned BOOLEAN NOT NULL DEFAULT FALSE;
+-- Only the pinned tasks are pending with a worker
+UPDATE task SET workerPinned = TRUE WHERE status = 'pending' AND WorkerName <> '';
@@ -0,0 +1,37 @@
+-- Tables of nTask before versioned migrations
+CREATE TABLE IF NOT EXISTS worker (
+    name VARCHAR(255) PRIMARY KEY,
+    DefaultThreads INT,
+    IddleThreads INT,
+    up BOOLEAN,
+    downCount INT,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task (
+    ID VARCHAR(255) PRIMARY KEY,
+    notes TEXT,
+    commands TEXT,
+    files TEXT,
+    name TEXT,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    executedAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01',
+    status VARCHAR(255),
+    duration REAL DEFAULT 0,
+    workerName VARCHAR(255),
+    username VARCHAR(255),
+    priority INT DEFAULT 0,
+    timeout INT DEFAULT 0,
+    callbackURL TEXT,
+    callbackToken TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_status ON task (status);
+
+-- Migrations applied to the database, each one saves its version in its own transaction
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INT PRIMARY KEY,
+    name VARCHAR(255),
+    appliedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
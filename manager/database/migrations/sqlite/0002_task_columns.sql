@@ -0,0 +1,11 @@
+-- Dependencies, retries, placement, groups and cancellation of the tasks
+ALTER TABLE task ADD COLUMN dependsOn TEXT;
+ALTER TABLE task ADD COLUMN maxRetries INT DEFAULT 0;
+ALTER TABLE task ADD COLUMN retryBackoffSeconds INT DEFAULT 0;
+ALTER TABLE task ADD COLUMN retries INT DEFAULT 0;
+ALTER TABLE task ADD COLUMN retryAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01';
+ALTER TABLE task ADD COLUMN requires TEXT;
+ALTER TABLE task ADD COLUMN groupID VARCHAR(255);
+ALTER TABLE task ADD COLUMN cancelGraceSeconds INT DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_groupID ON task (groupID);
@@ -0,0 +1,3 @@
+-- Labels and modules of the workers
+ALTER TABLE worker ADD COLUMN labels TEXT;
+ALTER TABLE worker ADD COLUMN modules TEXT;
@@ -0,0 +1,58 @@
+-- Jobs, schedules, dependencies, attempts and output of the tasks
+CREATE TABLE IF NOT EXISTS job (
+    ID VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(255),
+    username VARCHAR(255),
+    total INT DEFAULT 0,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS schedule (
+    ID VARCHAR(255) PRIMARY KEY,
+    name TEXT,
+    task TEXT,
+    cron VARCHAR(255),
+    runAt TIMESTAMP NULL DEFAULT NULL,
+    nextRunAt TIMESTAMP NULL DEFAULT NULL,
+    lastRunAt TIMESTAMP NULL DEFAULT NULL,
+    lastTaskID VARCHAR(255),
+    enabled BOOLEAN,
+    username VARCHAR(255),
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_dependency (
+    taskID VARCHAR(255),
+    dependsOn VARCHAR(255),
+    PRIMARY KEY (taskID, dependsOn),
+    FOREIGN KEY (taskID) REFERENCES task(ID) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS task_attempt (
+    taskID VARCHAR(255),
+    attempt INT,
+    workerName VARCHAR(255),
+    status VARCHAR(255),
+    commands TEXT,
+    duration REAL DEFAULT 0,
+    executedAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:01',
+    finishedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (taskID, attempt),
+    FOREIGN KEY (taskID) REFERENCES task(ID) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS task_output (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    taskID VARCHAR(255),
+    command INT,
+    stream VARCHAR(255),
+    data TEXT,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (taskID) REFERENCES task(ID) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_nextRunAt ON schedule (enabled, nextRunAt);
+
+CREATE INDEX IF NOT EXISTS idx_dependsOn ON task_dependency (dependsOn);
+
+CREATE INDEX IF NOT EXISTS idx_taskID_seq ON task_output (taskID, seq);
@@ -0,0 +1,2 @@
+-- Resources that each command of a task can use in the worker
+ALTER TABLE task ADD COLUMN resourceLimits TEXT;
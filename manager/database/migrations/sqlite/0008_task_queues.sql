@@ -0,0 +1,4 @@
+-- Queue of the tasks, with the limits of its definition in the manager config
+ALTER TABLE task ADD COLUMN queue VARCHAR(255) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_queue ON task (queue, status);
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"net/http"
+	"time"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+)
+
+// Store is the storage of the manager: the tasks, the workers and the rest of its data.
+// ConnectDB returns the DB of the MySQL, PostgreSQL or SQLite backend, the SQL of each
+// one is in its Backend
+type Store interface {
+	// Tasks
+	AddTask(task globalstructs.Task, maxPending int, verbose, debug bool) error
+	UpdateTask(task globalstructs.Task, verbose, debug bool) error
+	RmTask(id string, verbose, debug bool) error
+	GetTasks(r *http.Request, owner string, verbose, debug bool) ([]globalstructs.Task, error)
+	GetTasksPending(limit, offset int, skip PendingSkip, verbose, debug bool) ([]globalstructs.Task, error)
+	GetTasksPendingByUser(limit int, offsets map[string]int, skipUsers []string, skip PendingSkip, verbose, debug bool) ([]globalstructs.Task, error)
+	CountTasksByUser(status string, verbose, debug bool) (map[string]int, error)
+	CountTasksByQueue(status string, verbose, debug bool) (map[string]int, error)
+	CountTasksByRateKey(status string, verbose, debug bool) (map[string]int, error)
+	CountTasksStartedByUser(since time.Time, verbose, debug bool) (map[string]int, error)
+	GetTask(id string, verbose, debug bool) (globalstructs.Task, error)
+	GetTaskWithAttempts(id string, verbose, debug bool) (globalstructs.Task, error)
+	SaveTaskResult(result globalstructs.Task, workerName string, verbose, debug bool) (bool, error)
+	GetTaskAttempts(id string, verbose, debug bool) ([]globalstructs.TaskAttempt, error)
+	RetryTask(id string, backoffSeconds int, verbose, debug bool) error
+	GetTaskDependencies(id string, verbose, debug bool) ([]string, error)
+	GetTaskDependents(id string, verbose, debug bool) ([]string, error)
+	GetTasksDependencies(ids []string, verbose, debug bool) ([]TaskDependency, error)
+	GetTaskNameStatus(id string, verbose, debug bool) (string, string, error)
+	GetTaskRetries(id string, verbose, debug bool) (int, error)
+	GetTasksStatus(ids []string, verbose, debug bool) (map[string]globalstructs.Task, error)
+	GetTaskUsername(id string, verbose, debug bool) (string, error)
+	SetTasksWorkerPending(workerName string, verbose, debug bool) error
+	DeleteTasksWorkerCancelled(workerName string, verbose, debug bool) ([]string, error)
+	SetTaskCancelRequested(id, workerName string, verbose, debug bool) (bool, error)
+	SetTaskExecutedAtNow(id string, verbose, debug bool) error
+	SetTaskStatus(id, status string, verbose, debug bool) error
+	SetTaskStatusIfStatus(id, currentStatus, newStatus string, verbose, debug bool) (bool, error)
+	GetCountByStatus(status string, verbose, debug bool) (int, error)
+	DeleteMaxEntriesHistory(maxEntries int, table string, verbose, debug bool) ([]string, error)
+	SetTasksStatusIfStatus(currentStatus, newStatus string, verbose, debug bool) error
+	BackfillTaskCommands(batchSize int, verbose, debug bool) (bool, error)
+
+	// Workers
+	AddWorker(w *globalstructs.Worker, verbose, debug bool) error
+	RmWorkerName(name string, verbose, debug bool) error
+	GetWorkers(verbose, debug bool) ([]globalstructs.Worker, error)
+	GetWorker(name string, verbose, debug bool) (globalstructs.Worker, error)
+	GetWorkerIddle(verbose, debug bool) ([]globalstructs.Worker, error)
+	GetWorkerUP(verbose, debug bool) ([]globalstructs.Worker, error)
+	UpdateWorker(w *globalstructs.Worker, verbose, debug bool) error
+	SetWorkerModules(name string, modules []string, verbose, debug bool) error
+	SetWorkerUPto(name string, up bool, verbose, debug bool) error
+	SetIddleThreadsTo(name string, idle int, verbose, debug bool) error
+	SubtractWorkerIddleThreads1(name string, verbose, debug bool) error
+	GetWorkerDownCount(name string, verbose, debug bool) (int, error)
+	SetWorkerDownCount(name string, count int, verbose, debug bool) error
+	AddWorkerDownCount(name string, verbose, debug bool) error
+	GetUpCount(verbose, debug bool) (int, error)
+	GetDownCount(verbose, debug bool) (int, error)
+
+	// Jobs
+	AddJob(job globalstructs.Job, tasks []globalstructs.Task, maxPending int, verbose, debug bool) error
+	GetJobs(owner string, page, limit int, verbose, debug bool) ([]globalstructs.Job, error)
+	GetJob(id string, verbose, debug bool) (globalstructs.Job, error)
+	GetJobTasks(id string, statuses []string, page, limit int, verbose, debug bool) ([]globalstructs.Task, error)
+
+	// Schedules
+	AddSchedule(schedule globalstructs.Schedule, runAt, nextRunAt *time.Time, verbose, debug bool) error
+	RmSchedule(id string, verbose, debug bool) error
+	GetSchedules(owner string, verbose, debug bool) ([]globalstructs.Schedule, error)
+	GetSchedule(id string, verbose, debug bool) (globalstructs.Schedule, error)
+	GetSchedulesDue(now time.Time, verbose, debug bool) ([]globalstructs.Schedule, error)
+	SetScheduleRun(id, taskID string, lastRunAt time.Time, nextRunAt *time.Time, verbose, debug bool) error
+
+	// API tokens
+	AddToken(token globalstructs.Token, expiresAt *time.Time, verbose, debug bool) error
+	RmToken(id string, verbose, debug bool) error
+	GetTokens(verbose, debug bool) ([]globalstructs.Token, error)
+	GetToken(id string, verbose, debug bool) (globalstructs.Token, error)
+	GetTokenByValue(token string, now time.Time, verbose, debug bool) (globalstructs.Token, error)
+	SetTokenLastUsed(id string, lastUsedAt time.Time, verbose, debug bool) error
+
+	// Output streamed by the workers
+	AddTaskOutput(workerName string, output globalstructs.TaskOutput, verbose, debug bool) error
+	GetTaskOutputs(id string, afterSeq int64, limit int, verbose, debug bool) ([]globalstructs.TaskOutput, error)
+	DeleteTaskOutputs(id string, verbose, debug bool) error
+
+	// Artifacts
+	GetTaskArtifacts(id string, attempt int, verbose, debug bool) ([]globalstructs.Artifact, error)
+
+	// IsDuplicateKeyError returns true if the error is an insert of a primary key that already exists
+	IsDuplicateKeyError(err error) bool
+	// Close closes the database
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
@@ -10,15 +10,18 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/r4ulcl/nTask/globalstructs"
 	"github.com/r4ulcl/nTask/manager/api"
 	"github.com/r4ulcl/nTask/manager/cloud"
 	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/resultstore"
 	sshtunnel "github.com/r4ulcl/nTask/manager/sshTunnel"
 	"github.com/r4ulcl/nTask/manager/utils"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -76,7 +79,7 @@ func loadManagerCloudConfig(filename string, verbose, debug bool) (*utils.Manage
 	return loadConfigFile[utils.ManagerCloudConfig](filename, verbose, debug, "Cloud")
 }
 
-func addHandleWorker(workers *mux.Router, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex) {
+func addHandleWorker(workers *mux.Router, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
 	// worker
 	workers.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
 		api.HandleWorkerGet(w, r, db, verbose, debug)
@@ -100,16 +103,24 @@ func addHandleWorker(workers *mux.Router, config *utils.ManagerConfig, db *sql.D
 
 }
 
-func addHandleTask(task *mux.Router, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex) {
+func addHandleTask(task *mux.Router, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
 	// task
 	task.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
 		api.HandleTaskGet(w, r, db, verbose, debug)
 	}).Methods("GET") // check tasks
 
 	task.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
-		api.HandleTaskPost(w, r, db, verbose, debug)
+		api.HandleTaskPost(w, r, config, db, verbose, debug)
 	}).Methods("POST") // Add task
 
+	task.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskBatch(w, r, config, db, verbose, debug)
+	}).Methods("POST") // Add many tasks
+
+	task.HandleFunc("/template", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskTemplate(w, r, config, db, verbose, debug)
+	}).Methods("POST") // Add the tasks of a template
+
 	task.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
 		api.HandleTaskDelete(w, r, config, db, verbose, debug, writeLock)
 	}).Methods("DELETE") // Delete task
@@ -118,6 +129,75 @@ func addHandleTask(task *mux.Router, config *utils.ManagerConfig, db *sql.DB, ve
 		api.HandleTaskStatus(w, r, db, verbose, debug)
 	}).Methods("GET") // get status task
 
+	task.HandleFunc("/{ID}/graph", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskGraph(w, r, db, verbose, debug)
+	}).Methods("GET") // get dependency graph of a task
+
+	task.HandleFunc("/{ID}/output/{n}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskOutput(w, r, config, db, verbose, debug)
+	}).Methods("GET") // get the output of a command
+
+	task.HandleFunc("/{ID}/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskArtifacts(w, r, db, verbose, debug)
+	}).Methods("GET") // list the artifacts of a task
+
+	task.HandleFunc("/{ID}/artifacts/{n}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskArtifact(w, r, config, db, verbose, debug)
+	}).Methods("GET") // download an artifact of a task
+
+	task.HandleFunc("/{ID}/stream", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTaskStream(w, r, db, verbose, debug)
+	}).Methods("GET") // follow the output of a task
+
+}
+
+func addHandleJob(job *mux.Router, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
+	// job
+	job.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleJobGet(w, r, db, verbose, debug)
+	}).Methods("GET") // get jobs
+
+	job.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleJobStatus(w, r, db, verbose, debug)
+	}).Methods("GET") // get status job
+
+	job.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleJobDelete(w, r, config, db, verbose, debug, writeLock)
+	}).Methods("DELETE") // cancel job
+}
+
+func addHandleSchedule(schedule *mux.Router, config *utils.ManagerConfig, db database.Store, verbose, debug bool) {
+	// schedule
+	schedule.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleScheduleGet(w, r, db, verbose, debug)
+	}).Methods("GET") // get schedules
+
+	schedule.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleSchedulePost(w, r, config, db, verbose, debug)
+	}).Methods("POST") // Add schedule
+
+	schedule.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleScheduleStatus(w, r, db, verbose, debug)
+	}).Methods("GET") // get schedule
+
+	schedule.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleScheduleDelete(w, r, db, verbose, debug)
+	}).Methods("DELETE") // Delete schedule
+}
+
+func addHandleToken(token *mux.Router, db database.Store, verbose, debug bool) {
+	// token
+	token.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTokenGet(w, r, db, verbose, debug)
+	}).Methods("GET") // get tokens
+
+	token.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTokenPost(w, r, db, verbose, debug)
+	}).Methods("POST") // Add token
+
+	token.HandleFunc("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTokenDelete(w, r, db, verbose, debug)
+	}).Methods("DELETE") // Delete token
 }
 
 func startSwaggerWeb(router *mux.Router, verbose, debug bool) {
@@ -163,6 +243,14 @@ func StartManager(swagger bool, configFile, configSSHFile, configCloudFile strin
 	db := connectToDatabase(config, debug)
 	defer db.Close()
 
+	// Create or update the schema
+	migrateDatabase(db, config, verbose, debug)
+
+	config.Results, err = resultstore.New(config.ResultStore, nil)
+	if err != nil {
+		log.Fatalf("Error creating the result store: %v", err)
+	}
+
 	// Handle initial task status updates
 	setInitialTaskStatus(db, verbose, debug)
 
@@ -223,6 +311,40 @@ func loadManagerConfigurations(configFile string, verbose, debug bool) (*utils.M
 		config.MaxTaskHistory = 0
 	}
 
+	for username, user := range config.Users {
+		switch user.Role {
+		case "":
+			// the users written as a string are admins, see utils.User.UnmarshalJSON
+			user.Role = utils.RoleSubmitter
+			config.Users[username] = user
+		case utils.RoleAdmin, utils.RoleSubmitter, utils.RoleReadOnly:
+		default:
+			return nil, fmt.Errorf("invalid role %q of user %s", user.Role, username)
+		}
+		if user.MaxRunning < 0 || user.MaxPending < 0 {
+			return nil, fmt.Errorf("invalid quota of user %s", username)
+		}
+	}
+	if config.DefaultQuota.MaxRunning < 0 || config.DefaultQuota.MaxPending < 0 {
+		return nil, fmt.Errorf("invalid defaultQuota")
+	}
+	if config.FairShareWindow <= 0 {
+		config.FairShareWindow = 3600
+	}
+	for name, queue := range config.Queues {
+		if name == "" || queue.MaxRunning < 0 {
+			return nil, fmt.Errorf("invalid queue %q", name)
+		}
+	}
+	for key, limit := range config.RateLimits {
+		if key == "" || limit.MaxRunning < 0 || limit.MaxPerMinute < 0 {
+			return nil, fmt.Errorf("invalid rate limit %q", key)
+		}
+	}
+	if config.DefaultRateLimit.MaxRunning < 0 || config.DefaultRateLimit.MaxPerMinute < 0 {
+		return nil, fmt.Errorf("invalid defaultRateLimit")
+	}
+
 	return config, nil
 }
 
@@ -262,15 +384,15 @@ func processCloudConfiguration(configCloud *utils.ManagerCloudConfig, configSSH
 	return nil
 }
 
-func connectToDatabase(config *utils.ManagerConfig, debug bool) *sql.DB {
-	var db *sql.DB
+func connectToDatabase(config *utils.ManagerConfig, debug bool) *database.DB {
+	var db *database.DB
 	var err error
 
 	for {
 		if debug {
 			log.Println("Manager Trying to connect to DB")
 		}
-		db, err = database.ConnectDB(config.DBUsername, config.DBPassword, config.DBHost, config.DBPort, config.DBDatabase, false, debug)
+		db, err = database.ConnectDB(config.DBDriver, config.DBUsername, config.DBPassword, config.DBHost, config.DBPort, config.DBDatabase, false, debug)
 		if err != nil {
 			log.Printf("Error connecting to DB: %v", err)
 			time.Sleep(5 * time.Second)
@@ -281,12 +403,74 @@ func connectToDatabase(config *utils.ManagerConfig, debug bool) *sql.DB {
 	return db
 }
 
-func setInitialTaskStatus(db *sql.DB, verbose, debug bool) {
+func migrateDatabase(db *database.DB, config *utils.ManagerConfig, verbose, debug bool) {
+	if config.ManualMigrations {
+		current, pending, err := db.PendingMigrations(verbose, debug)
+		if err != nil {
+			log.Fatalf("Error checking migrations: %v", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("Database schema version %d has %d pending migrations, run: nTask manager migrate", current, len(pending))
+		}
+		return
+	}
+
+	applied, err := db.Migrate(false, verbose, debug)
+	for _, m := range applied {
+		log.Println("Manager applied migration", m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+}
+
+// MigrateManager applies the pending migrations of the manager database and exits,
+// with dryRun the pending migrations are only printed
+func MigrateManager(configFile string, dryRun, verbose, debug bool) error {
+	config, err := loadManagerConfigurations(configFile, verbose, debug)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.ConnectDB(config.DBDriver, config.DBUsername, config.DBPassword, config.DBHost, config.DBPort, config.DBDatabase, verbose, debug)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, pending, err := db.PendingMigrations(verbose, debug)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version: %d\n", current)
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations")
+		return nil
+	}
+
+	if dryRun {
+		for _, m := range pending {
+			fmt.Printf("-- %s\n", m.Name)
+			for _, stmt := range m.Statements() {
+				fmt.Printf("%s;\n", stmt)
+			}
+		}
+		return nil
+	}
+
+	applied, err := db.Migrate(false, verbose, debug)
+	for _, m := range applied {
+		fmt.Println("Applied", m.Name)
+	}
+	return err
+}
+
+func setInitialTaskStatus(db database.Store, verbose, debug bool) {
 	if debug {
 		log.Println("Manager Setting tasks with running status to failed")
 	}
 	// if the manager app restarst, set al running to pending to launch again
-	if err := database.SetTasksStatusIfStatus("running", db, "pending", verbose, debug); err != nil {
+	if err := db.SetTasksStatusIfStatus("running", "pending", verbose, debug); err != nil {
 		log.Printf("Error setting task statuses: %v", err)
 	}
 }
@@ -308,17 +492,25 @@ func initializeHTTPClient(config *utils.ManagerConfig, verifyAltName, verbose, d
 func startSSHBackgroundTask(configSSH *utils.ManagerSSHConfig, config *utils.ManagerConfig, verbose, debug bool) {
 	go sshtunnel.StartSSH(configSSH, config.HTTPPort, config.HTTPSPort, verbose, debug)
 }
-func startBackgroundTask(db *sql.DB, config *utils.ManagerConfig, writeLock *sync.Mutex, verbose, debug bool) {
+func startBackgroundTask(db database.Store, config *utils.ManagerConfig, writeLock *sync.Mutex, verbose, debug bool) {
 	go utils.VerifyWorkersLoop(db, config, verbose, debug, writeLock)
 	go utils.ManageTasks(config, db, verbose, debug, writeLock)
 	go utils.DeleteMaxTaskHistoryLoop(db, config, verbose, debug)
+	go utils.ManageSchedules(db, config, verbose, debug)
+	go utils.BackfillTaskCommandsLoop(db, verbose, debug)
 }
 
-func setupAndStartServers(swagger bool, config *utils.ManagerConfig, db *sql.DB, writeLock *sync.Mutex, verbose, debug bool) {
+func setupAndStartServers(swagger bool, config *utils.ManagerConfig, db database.Store, writeLock *sync.Mutex, verbose, debug bool) {
 	router := mux.NewRouter()
-	amw := authenticationMiddleware{
+	amw := &authenticationMiddleware{
 		tokenUsers:   make(map[string]string),
 		tokenWorkers: make(map[string]string),
+		userRoles:    make(map[string]string),
+		db:           db,
+		verbose:      verbose,
+		debug:        debug,
+		tokenUsed:    make(map[string]time.Time),
+		tokenCache:   make(map[string]cachedToken),
 	}
 	amw.Populate(config)
 
@@ -333,7 +525,7 @@ func setupAndStartServers(swagger bool, config *utils.ManagerConfig, db *sql.DB,
 	startServers(router, config, verbose, debug)
 }
 
-func setupRoutes(router *mux.Router, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex, amw authenticationMiddleware) {
+func setupRoutes(router *mux.Router, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex, amw *authenticationMiddleware) {
 	status := router.PathPrefix("/status").Subrouter()
 	status.Use(amw.Middleware)
 	status.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
@@ -344,10 +536,34 @@ func setupRoutes(router *mux.Router, config *utils.ManagerConfig, db *sql.DB, ve
 	workers.Use(amw.Middleware)
 	addHandleWorker(workers, config, db, verbose, debug, writeLock)
 
+	module := router.PathPrefix("/module").Subrouter()
+	module.Use(amw.Middleware)
+	module.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleModuleGet(w, r, db, verbose, debug)
+	}).Methods("GET")
+
+	queue := router.PathPrefix("/queue").Subrouter()
+	queue.Use(amw.Middleware)
+	queue.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleQueueGet(w, r, config, db, verbose, debug)
+	}).Methods("GET")
+
 	task := router.PathPrefix("/task").Subrouter()
 	task.Use(amw.Middleware)
 	addHandleTask(task, config, db, verbose, debug, writeLock)
 
+	job := router.PathPrefix("/job").Subrouter()
+	job.Use(amw.Middleware)
+	addHandleJob(job, config, db, verbose, debug, writeLock)
+
+	schedule := router.PathPrefix("/schedule").Subrouter()
+	schedule.Use(amw.Middleware)
+	addHandleSchedule(schedule, config, db, verbose, debug)
+
+	token := router.PathPrefix("/token").Subrouter()
+	token.Use(amw.Middleware)
+	addHandleToken(token, db, verbose, debug)
+
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Server", "Apache")
@@ -406,46 +622,152 @@ func startServers(router *mux.Router, config *utils.ManagerConfig, verbose, debu
 type authenticationMiddleware struct {
 	tokenUsers   map[string]string
 	tokenWorkers map[string]string
+	userRoles    map[string]string
+	db           database.Store // API tokens added with /token
+	verbose      bool
+	debug        bool
+	mu           sync.Mutex
+	tokenUsed    map[string]time.Time   // last lastUsedAt saved of each API token
+	tokenCache   map[string]cachedToken // API tokens read from the database by hash
 }
 
+// cachedToken API token read from the database, or its absence, until expires
+type cachedToken struct {
+	token   globalstructs.Token
+	found   bool
+	expires time.Time
+}
+
+// tokenUsedInterval min time between the updates of lastUsedAt of an API token
+const tokenUsedInterval = time.Minute
+
+// tokenCacheTTL time an API token read from the database is used without reading it again,
+// a deleted or expired token works until then
+const tokenCacheTTL = 10 * time.Second
+
+// tokenCacheMax max tokens in the cache, it is emptied when it is full
+const tokenCacheMax = 10000
+
 // Initialize it somewhere
 func (amw *authenticationMiddleware) Populate(config *utils.ManagerConfig) {
 	// the key is the token instead of user
 	for k, v := range config.Users {
-		amw.tokenUsers[v] = k
+		amw.tokenUsers[v.Token] = k
+		amw.userRoles[k] = v.Role
 	}
 	for k, v := range config.Workers {
 		amw.tokenWorkers[v] = k
 	}
 }
 
+// lookup returns the kind, name, role and scopes of a token, first in the config file
+// and then in the API tokens of the database
+func (amw *authenticationMiddleware) lookup(token string) (kind, name, role string, scopes []string, found bool) {
+	if token == "" {
+		return "", "", "", nil, false
+	}
+	if user, ok := amw.tokenUsers[token]; ok {
+		return globalstructs.TokenUser, user, amw.userRoles[user], nil, true
+	}
+	if worker, ok := amw.tokenWorkers[token]; ok {
+		return globalstructs.TokenWorker, worker, "", nil, true
+	}
+
+	now := time.Now()
+	apiToken, found := amw.getToken(token, now)
+	if !found {
+		return "", "", "", nil, false
+	}
+	amw.setTokenUsed(apiToken.ID, now)
+	return apiToken.Kind, apiToken.Username, apiToken.Role, apiToken.Scopes, true
+}
+
+// getToken returns the API token from the cache, or from the database if it isn't
+// in the cache for less than tokenCacheTTL
+func (amw *authenticationMiddleware) getToken(token string, now time.Time) (globalstructs.Token, bool) {
+	hash := database.HashToken(token)
+	amw.mu.Lock()
+	cached, ok := amw.tokenCache[hash]
+	amw.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.token, cached.found
+	}
+
+	apiToken, err := amw.db.GetTokenByValue(token, now, amw.verbose, amw.debug)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// not cached, the next request reads it again
+		if amw.verbose || amw.debug {
+			log.Println("Middleware GetTokenByValue error:", err)
+		}
+		return globalstructs.Token{}, false
+	}
+	cached = cachedToken{token: apiToken, found: err == nil, expires: now.Add(tokenCacheTTL)}
+
+	amw.mu.Lock()
+	if len(amw.tokenCache) >= tokenCacheMax {
+		clear(amw.tokenCache)
+	}
+	amw.tokenCache[hash] = cached
+	amw.mu.Unlock()
+	return cached.token, cached.found
+}
+
+// setTokenUsed saves the last use of an API token, at most once per tokenUsedInterval
+func (amw *authenticationMiddleware) setTokenUsed(id string, now time.Time) {
+	amw.mu.Lock()
+	if now.Sub(amw.tokenUsed[id]) < tokenUsedInterval {
+		amw.mu.Unlock()
+		return
+	}
+	amw.tokenUsed[id] = now
+	amw.mu.Unlock()
+
+	if err := amw.db.SetTokenLastUsed(id, now, amw.verbose, amw.debug); err != nil && (amw.verbose || amw.debug) {
+		log.Println("Middleware SetTokenLastUsed error:", err)
+	}
+}
+
 // Middleware function, which will be called for each request
 func (amw *authenticationMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.URL.Path, "/swagger/") && r.URL.Path != "/docs/swagger.json" {
-			token := r.Header.Get("Authorization")
-			user, foundUser := amw.tokenUsers[token]
-			worker, foundWorker := amw.tokenWorkers[token]
-			if foundUser {
-				// We found the token in our map
-				// Add the username to the request context
-				ctx := context.WithValue(r.Context(), utils.UsernameKey, user)
+			kind, name, role, scopes, found := amw.lookup(r.Header.Get("Authorization"))
+			if !found {
+				// Write an error and stop the handler chain
+				http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
+				return
+			}
 
-				// Pass down the request with the updated context to the next middleware (or final handler)
-				next.ServeHTTP(w, r.WithContext(ctx))
-			} else if foundWorker {
-				// We found the token in our map
-				// Add the username to the request context
-				ctx := context.WithValue(r.Context(), utils.WorkerKey, worker)
+			// The tokens with scopes can only use those paths of the API
+			if len(scopes) > 0 {
+				path, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+				if !slices.Contains(scopes, path) {
+					http.Error(w, "{ \"error\" : \"Forbidden: out of the scopes of the token\" }", http.StatusForbidden)
+					return
+				}
+			}
+
+			if kind == globalstructs.TokenWorker {
+				// Add the worker name to the request context
+				ctx := context.WithValue(r.Context(), utils.WorkerKey, name)
 
 				// Pass down the request with the updated context to the next middleware (or final handler)
 				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 
-			} else {
-				// Write an error and stop the handler chain
-				http.Error(w, "{ \"error\" : \"Forbidden\" }", http.StatusForbidden)
-
+			// The read-only users can't change anything
+			if role == utils.RoleReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "{ \"error\" : \"Forbidden: read-only user\" }", http.StatusForbidden)
+				return
 			}
+
+			// Add the username and its role to the request context
+			ctx := context.WithValue(r.Context(), utils.UsernameKey, name)
+			ctx = context.WithValue(ctx, utils.RoleKey, role)
+
+			// Pass down the request with the updated context to the next middleware (or final handler)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 	})
 }
@@ -0,0 +1,230 @@
+// Package resultstore saves the outputs of the commands that are too big to be stored in the database.
+// The workers upload them in chunks and the tasks keep only the key of the result.
+package resultstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// ErrNotFound the result doesn't exist in the store
+var ErrNotFound = errors.New("result not found")
+
+// validID task IDs accepted in the keys, they are part of the paths in the store
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Config result store options of the manager config file
+type Config struct {
+	Type      string `json:"type"`      // local (default) or s3
+	Path      string `json:"path"`      // folder of the local results and of the uploads in progress
+	Endpoint  string `json:"endpoint"`  // s3 endpoint, e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string `json:"region"`    // s3 region, us-east-1 by default
+	Bucket    string `json:"bucket"`    // s3 bucket
+	AccessKey string `json:"accessKey"` // s3 access key
+	SecretKey string `json:"secretKey"` // s3 secret key
+}
+
+// Backend where the finished results are saved
+type Backend interface {
+	// Put saves size bytes of r with the key
+	Put(key string, r io.Reader, size int64) error
+	// Open returns the result with the key and its size, ErrNotFound if it doesn't exist
+	Open(key string) (io.ReadCloser, int64, error)
+	// DeletePrefix removes every result whose key starts with prefix, that ends with a slash
+	DeletePrefix(prefix string) error
+}
+
+// Store joins the chunks sent by the workers and saves the results in the backend
+type Store struct {
+	backend Backend
+	uploads string // folder of the uploads in progress
+	mu      sync.Mutex
+	locks   map[string]*keyLock // uploads in progress by key
+}
+
+// keyLock lock of the upload of a key, removed when nobody uses it
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// New creates the store of the config, client is used by the s3 backend
+func New(config Config, client *http.Client) (*Store, error) {
+	if config.Path == "" {
+		config.Path = "results"
+	}
+
+	var backend Backend
+	switch config.Type {
+	case "", "local":
+		backend = localBackend{dir: config.Path}
+	case "s3":
+		b, err := newS3Backend(config, client)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	default:
+		return nil, fmt.Errorf("unknown result store type %q, use local or s3", config.Type)
+	}
+
+	uploads := filepath.Join(config.Path, ".uploads")
+	if err := os.MkdirAll(uploads, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{backend: backend, uploads: uploads, locks: make(map[string]*keyLock)}, nil
+}
+
+// lock locks the upload of key and returns the function that unlocks it,
+// the uploads of different keys don't wait for each other
+func (s *Store) lock(key string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// WriteChunk writes a chunk of a result, the result is saved in the backend
+// with the last chunk. A chunk with offset 0 starts the upload again.
+func (s *Store) WriteChunk(chunk globalstructs.ResultChunk) error {
+	if !validID.MatchString(chunk.ID) || chunk.Index < 0 || chunk.Attempt < 0 || chunk.Offset < 0 {
+		return fmt.Errorf("invalid result chunk of task %q", chunk.ID)
+	}
+	key := chunk.Key()
+	path := filepath.Join(s.uploads, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// The lock protects the uploads of the same result sent again by a worker that reconnected,
+	// it's held while the result is saved in the backend
+	unlock := s.lock(key)
+	defer unlock()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if chunk.Offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	// A missing chunk would leave a hole, the upload must be sent again from offset 0
+	if info, err := file.Stat(); err != nil || info.Size() != chunk.Offset {
+		file.Close()
+		return fmt.Errorf("chunk of result %s out of order at offset %d", key, chunk.Offset)
+	}
+	_, err = file.WriteAt(chunk.Data, chunk.Offset)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !chunk.Last {
+		return err
+	}
+
+	defer os.Remove(path)
+	file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size := chunk.Offset + int64(len(chunk.Data))
+	return s.backend.Put(key, io.LimitReader(file, size), size)
+}
+
+// Open returns the result with the key and its size
+func (s *Store) Open(key string) (io.ReadCloser, int64, error) {
+	return s.backend.Open(key)
+}
+
+// DeleteTask removes the outputs and artifacts of every attempt of the task id,
+// and its uploads in progress
+func (s *Store) DeleteTask(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid task ID %q", id)
+	}
+	if err := os.RemoveAll(filepath.Join(s.uploads, id)); err != nil {
+		return err
+	}
+	return s.backend.DeletePrefix(id + "/")
+}
+
+// localBackend saves the results in a folder
+type localBackend struct {
+	dir string
+}
+
+func (b localBackend) Put(key string, r io.Reader, size int64) error {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return fmt.Errorf("invalid result key %q", key)
+	}
+	path := filepath.Join(b.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file so a result is never read half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b localBackend) DeletePrefix(prefix string) error {
+	dir := filepath.FromSlash(strings.TrimSuffix(prefix, "/"))
+	if !strings.HasSuffix(prefix, "/") || !filepath.IsLocal(dir) {
+		return fmt.Errorf("invalid result prefix %q", prefix)
+	}
+	return os.RemoveAll(filepath.Join(b.dir, dir))
+}
+
+func (b localBackend) Open(key string) (io.ReadCloser, int64, error) {
+	// The keys of the outputs are sent by the workers
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return nil, 0, ErrNotFound
+	}
+	file, err := os.Open(filepath.Join(b.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
@@ -0,0 +1,167 @@
+package resultstore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// readResult returns the result with the key
+func readResult(t *testing.T, store *Store, key string) string {
+	t.Helper()
+	r, size, err := store.Open(key)
+	if err != nil {
+		t.Fatalf("Open %s: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size {
+		t.Errorf("Open %s: size %d, read %d bytes", key, size, len(data))
+	}
+	return string(data)
+}
+
+func TestWriteChunk(t *testing.T) {
+	store, err := New(Config{Path: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []globalstructs.ResultChunk{
+		{ID: "task", Attempt: 1, Index: 2, Offset: 0, Data: []byte("hello ")},
+		{ID: "task", Attempt: 1, Index: 2, Offset: 6, Data: []byte("world"), Last: true},
+	}
+	for _, chunk := range chunks {
+		if err := store.WriteChunk(chunk); err != nil {
+			t.Fatalf("WriteChunk offset %d: %v", chunk.Offset, err)
+		}
+	}
+	if got := readResult(t, store, globalstructs.ResultKey("task", 1, 2)); got != "hello world" {
+		t.Errorf("result = %q, want hello world", got)
+	}
+
+	// a missing chunk leaves a hole, the upload starts again from offset 0
+	chunk := globalstructs.ResultChunk{ID: "task", Index: 0, Offset: 0, Data: []byte("abc")}
+	if err := store.WriteChunk(chunk); err != nil {
+		t.Fatal(err)
+	}
+	chunk.Offset = 10
+	if err := store.WriteChunk(chunk); err == nil {
+		t.Error("WriteChunk out of order returned no error")
+	}
+	chunk.Offset, chunk.Last = 0, true
+	if err := store.WriteChunk(chunk); err != nil {
+		t.Fatal(err)
+	}
+	if got := readResult(t, store, globalstructs.ResultKey("task", 0, 0)); got != "abc" {
+		t.Errorf("result sent again = %q, want abc", got)
+	}
+
+	for _, id := range []string{"../task", "a/b", ""} {
+		if err := store.WriteChunk(globalstructs.ResultChunk{ID: id, Data: []byte("x"), Last: true}); err == nil {
+			t.Errorf("WriteChunk of task %q returned no error", id)
+		}
+	}
+}
+
+func TestDeleteTask(t *testing.T) {
+	dir := t.TempDir()
+	store, err := New(Config{Path: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(chunk globalstructs.ResultChunk) {
+		t.Helper()
+		if err := store.WriteChunk(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(globalstructs.ResultChunk{ID: "task", Index: 0, Data: []byte("output"), Last: true})
+	write(globalstructs.ResultChunk{ID: "task", Attempt: 1, Index: 0, Artifact: true, Data: []byte("artifact"), Last: true})
+	write(globalstructs.ResultChunk{ID: "task", Attempt: 1, Index: 1, Data: []byte("in progress")})
+	write(globalstructs.ResultChunk{ID: "task_2", Index: 0, Data: []byte("other"), Last: true})
+
+	if err := store.DeleteTask("task"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{globalstructs.ResultKey("task", 0, 0), globalstructs.ArtifactKey("task", 1, 0)} {
+		if _, _, err := store.Open(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open %s after DeleteTask = %v, want ErrNotFound", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".uploads", "task")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("uploads in progress of a deleted task: %v", err)
+	}
+	if got := readResult(t, store, globalstructs.ResultKey("task_2", 0, 0)); got != "other" {
+		t.Errorf("result of another task = %q, want other", got)
+	}
+}
+
+// blockingBackend backend whose Put of the blocked key waits until release is closed
+type blockingBackend struct {
+	localBackend
+	blocked string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingBackend) Put(key string, r io.Reader, size int64) error {
+	if key == b.blocked {
+		close(b.started)
+		<-b.release
+	}
+	return b.localBackend.Put(key, r, size)
+}
+
+func TestWriteChunkLocksByKey(t *testing.T) {
+	store, err := New(Config{Path: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := blockingBackend{
+		localBackend: store.backend.(localBackend),
+		blocked:      globalstructs.ResultKey("slow", 0, 0),
+		started:      make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	store.backend = backend
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := store.WriteChunk(globalstructs.ResultChunk{ID: "slow", Data: []byte("slow"), Last: true}); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-backend.started
+
+	// the upload of another result doesn't wait for the slow one
+	done := make(chan error, 1)
+	go func() {
+		done <- store.WriteChunk(globalstructs.ResultChunk{ID: "fast", Data: []byte("fast"), Last: true})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("WriteChunk of another key waited for a slow Put")
+	}
+	close(backend.release)
+	wg.Wait()
+
+	if len(store.locks) != 0 {
+		t.Errorf("%d locks left after the uploads", len(store.locks))
+	}
+}
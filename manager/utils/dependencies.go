@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// maxGraphNodes limits the size of the graph returned by GetTaskGraph
+const maxGraphNodes = 10000
+
+// CheckDependencies verifies that every parent of the task exists and is of owner if it is not empty,
+// and removes duplicates. If one of them will never be done the task is set as skipped. AddTask
+// checks the parents again in its transaction
+func CheckDependencies(db database.Store, task *globalstructs.Task, owner string, verbose, debug bool) error {
+	parents, err := GetParents(db, []globalstructs.Task{*task}, owner, verbose, debug)
+	if err != nil {
+		return err
+	}
+	return CheckParents(task, parents)
+}
+
+// GetParents returns the parents of the tasks in the database by ID, read at once,
+// only the ones of owner if it is not empty
+func GetParents(db database.Store, tasks []globalstructs.Task, owner string, verbose, debug bool) (map[string]globalstructs.Task, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, task := range tasks {
+		for _, parent := range task.DependsOn {
+			if parent != "" && !seen[parent] {
+				seen[parent] = true
+				ids = append(ids, parent)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]globalstructs.Task{}, nil
+	}
+	parents, err := db.GetTasksStatus(ids, verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+	// The tasks of other users are not found
+	for id, parent := range parents {
+		if owner != "" && parent.Username != owner {
+			delete(parents, id)
+		}
+	}
+	return parents, nil
+}
+
+// CheckParents is CheckDependencies with the parents returned by GetParents
+func CheckParents(task *globalstructs.Task, parents map[string]globalstructs.Task) error {
+	seen := make(map[string]bool)
+	var dependsOn []string
+	for _, id := range task.DependsOn {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		dependsOn = append(dependsOn, id)
+
+		parent, ok := parents[id]
+		if !ok {
+			return fmt.Errorf("task %s not found", id)
+		}
+		if database.IsFailedParentStatus(parent.Status) {
+			task.Status = "skipped"
+		}
+	}
+	task.DependsOn = dependsOn
+	return nil
+}
+
+// SkipDependentTasks sets as skipped every pending task that depends (directly or not) on the task id
+func SkipDependentTasks(db database.Store, id string, verbose, debug bool) error {
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		children, err := db.GetTaskDependents(current, verbose, debug)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			skipped, err := db.SetTaskStatusIfStatus(child, "pending", "skipped", verbose, debug)
+			if err != nil {
+				return err
+			}
+			if skipped {
+				if verbose {
+					log.Println("Utils Task", child, "skipped, parent", current, "not done")
+				}
+				queue = append(queue, child)
+			}
+		}
+	}
+	return nil
+}
+
+// GetTaskGraph returns every task connected to the task id through dependencies,
+// only through the tasks of owner if it is not empty
+func GetTaskGraph(db database.Store, id, owner string, verbose, debug bool) (TaskGraph, error) {
+	return getTaskGraph(db, id, owner, maxGraphNodes, verbose, debug)
+}
+
+// getTaskGraph returns the graph of the task id with up to maxNodes tasks, each level
+// of the BFS is read with one query of the tasks and one of their dependencies
+func getTaskGraph(db database.Store, id, owner string, maxNodes int, verbose, debug bool) (TaskGraph, error) {
+	graph := TaskGraph{
+		ID:    id,
+		Nodes: []TaskGraphNode{},
+		Edges: []TaskGraphEdge{},
+	}
+
+	// check that the task exists
+	if _, _, err := db.GetTaskNameStatus(id, verbose, debug); err != nil {
+		return graph, err
+	}
+
+	visited := map[string]bool{id: true}
+	nodes := map[string]bool{}
+	edges := map[TaskGraphEdge]bool{}
+	level := []string{id}
+	for len(level) > 0 && len(graph.Nodes) < maxNodes {
+		tasks, err := db.GetTasksStatus(level, verbose, debug)
+		if err != nil {
+			return graph, err
+		}
+		var added []string
+		for _, current := range level {
+			if len(graph.Nodes) >= maxNodes {
+				break
+			}
+			task, found := tasks[current]
+			if !found {
+				// parent trimmed from the history
+				task.Status = "done"
+			} else if owner != "" && task.Username != owner {
+				// the tasks of other users and their dependencies are left out
+				continue
+			}
+			graph.Nodes = append(graph.Nodes, TaskGraphNode{ID: current, Name: task.Name, Status: task.Status})
+			nodes[current] = true
+			added = append(added, current)
+		}
+
+		dependencies, err := db.GetTasksDependencies(added, verbose, debug)
+		if err != nil {
+			return graph, err
+		}
+		level = nil
+		for _, dependency := range dependencies {
+			edge := TaskGraphEdge{From: dependency.DependsOn, To: dependency.TaskID}
+			if !edges[edge] {
+				edges[edge] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+			for _, next := range []string{dependency.DependsOn, dependency.TaskID} {
+				if !visited[next] {
+					visited[next] = true
+					level = append(level, next)
+				}
+			}
+		}
+	}
+
+	// the edges to the tasks left out or beyond maxNodes
+	graph.Edges = slices.DeleteFunc(graph.Edges, func(edge TaskGraphEdge) bool { return !nodes[edge.From] || !nodes[edge.To] })
+
+	if debug {
+		log.Println("Utils GetTaskGraph", id, "nodes:", len(graph.Nodes), "edges:", len(graph.Edges))
+	}
+	return graph, nil
+}
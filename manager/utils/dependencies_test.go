@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+func addTestChild(t *testing.T, db database.Store, id, username string, dependsOn ...string) {
+	t.Helper()
+	task := globalstructs.Task{ID: id, Status: "pending", Username: username, Queue: DefaultQueue,
+		DependsOn: dependsOn, Files: []globalstructs.File{}}
+	if err := db.AddTask(task, 0, false, false); err != nil {
+		t.Fatalf("AddTask %s: %v", id, err)
+	}
+}
+
+func TestCheckDependenciesOwner(t *testing.T) {
+	db := openTestDB(t)
+	addTestTask(t, db, "mine", "user", 0, "")
+	addTestTask(t, db, "theirs", "other", 0, "")
+
+	for _, tt := range []struct {
+		owner  string
+		parent string
+		ok     bool
+	}{
+		{"user", "mine", true},
+		{"user", "theirs", false},
+		{"", "theirs", true},
+	} {
+		task := globalstructs.Task{Username: "user", DependsOn: []string{tt.parent}}
+		if err := CheckDependencies(db, &task, tt.owner, false, false); (err == nil) != tt.ok {
+			t.Errorf("CheckDependencies of %s for %q = %v, want ok %v", tt.parent, tt.owner, err, tt.ok)
+		}
+	}
+}
+
+func TestGetTaskGraphOwner(t *testing.T) {
+	db := openTestDB(t)
+	// a of user <- b of other <- c of user
+	addTestTask(t, db, "a", "user", 0, "")
+	addTestChild(t, db, "b", "other", "a")
+	addTestChild(t, db, "c", "user", "b")
+
+	nodes := func(graph TaskGraph) []string {
+		var ids []string
+		for _, node := range graph.Nodes {
+			ids = append(ids, node.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	graph, err := GetTaskGraph(db, "a", "", false, false)
+	if err != nil || !slices.Equal(nodes(graph), []string{"a", "b", "c"}) || len(graph.Edges) != 2 {
+		t.Errorf("graph of an admin = %v %v, %v, want the 3 tasks", nodes(graph), graph.Edges, err)
+	}
+	if graph, err = GetTaskGraph(db, "a", "user", false, false); err != nil || !slices.Equal(nodes(graph), []string{"a"}) || len(graph.Edges) != 0 {
+		t.Errorf("graph of a for user = %v %v, %v, want only a", nodes(graph), graph.Edges, err)
+	}
+	if graph, err = GetTaskGraph(db, "c", "user", false, false); err != nil || !slices.Equal(nodes(graph), []string{"c"}) || len(graph.Edges) != 0 {
+		t.Errorf("graph of c for user = %v %v, %v, want only c", nodes(graph), graph.Edges, err)
+	}
+}
+
+func TestGetTaskGraphMaxNodes(t *testing.T) {
+	db := openTestDB(t)
+	// a <- b <- c and a <- d
+	addTestTask(t, db, "a", "user", 0, "")
+	addTestChild(t, db, "b", "user", "a")
+	addTestChild(t, db, "c", "user", "b")
+	addTestChild(t, db, "d", "user", "a")
+
+	graph, err := getTaskGraph(db, "a", "", 4, false, false)
+	if err != nil || len(graph.Nodes) != 4 || len(graph.Edges) != 3 {
+		t.Fatalf("graph of a = %v %v, %v, want 4 tasks and 3 edges", graph.Nodes, graph.Edges, err)
+	}
+
+	// the edges to the tasks beyond the limit are left out
+	for maxNodes := 1; maxNodes <= 3; maxNodes++ {
+		graph, err := getTaskGraph(db, "a", "", maxNodes, false, false)
+		if err != nil || len(graph.Nodes) != maxNodes || len(graph.Edges) != maxNodes-1 {
+			t.Errorf("graph of a with %d nodes = %v %v, %v, want %d edges", maxNodes, graph.Nodes, graph.Edges, err, maxNodes-1)
+		}
+		nodes := map[string]bool{}
+		for _, node := range graph.Nodes {
+			nodes[node.ID] = true
+		}
+		for _, edge := range graph.Edges {
+			if !nodes[edge.From] || !nodes[edge.To] {
+				t.Errorf("graph of a with %d nodes has the edge %v out of the nodes", maxNodes, edge)
+			}
+		}
+	}
+}
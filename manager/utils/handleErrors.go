@@ -1,40 +1,32 @@
 package utils
 
 import (
-	"database/sql"
-
 	"github.com/r4ulcl/nTask/globalstructs"
 	"github.com/r4ulcl/nTask/manager/database"
-
-	"github.com/go-sql-driver/mysql"
 )
 
 // HandleAddWorkerError func to handle error adding workers
-func HandleAddWorkerError(err error, db *sql.DB, worker *globalstructs.Worker, verbose, debug bool) error {
-	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
-		// Handle the MySQL duplicate entry error
-		if mysqlErr.Number == 1062 { // MySQL error number for duplicate entry
-			// Set all worker tasks to 'pending' with REDO status
-			err = database.SetTasksWorkerPending(db, worker.Name, verbose, debug)
-			if err != nil {
-				return err
-			}
+func HandleAddWorkerError(err error, db database.Store, worker *globalstructs.Worker, verbose, debug bool) error {
+	// Handle the duplicate entry error, the worker is connecting again
+	if db.IsDuplicateKeyError(err) {
+		// Set all worker tasks to 'pending' with REDO status
+		err = db.SetTasksWorkerPending(worker.Name, verbose, debug)
+		if err != nil {
+			return err
+		}
 
-			// Update worker record
-			err = database.UpdateWorker(db, worker, verbose, debug)
-			if err != nil {
-				return err
-			}
+		// Update worker record
+		err = db.UpdateWorker(worker, verbose, debug)
+		if err != nil {
+			return err
+		}
 
-			// Reset the worker's down count
-			err = database.SetWorkerDownCount(db, worker.Name, 0, verbose, debug)
-			if err != nil {
-				return err
-			}
+		// Reset the worker's down count
+		err = db.SetWorkerDownCount(worker.Name, 0, verbose, debug)
+		if err != nil {
+			return err
 		}
-		// Return the original error if it's not the duplicate entry error
-		return err
 	}
-	// Return nil if no error
-	return nil
+	// Return the original error if it's not the duplicate entry error
+	return err
 }
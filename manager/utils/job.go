@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// jobPageSize tasks read at once when a job is cancelled
+const jobPageSize = 1000
+
+// IsFinishedStatus returns true if a task with this status will not run again
+func IsFinishedStatus(status string) bool {
+	return status == "done" || database.IsFailedParentStatus(status)
+}
+
+// GetJobStatus returns a job with its progress and, if page > 0,
+// a page of its tasks with the outputs of their commands
+func GetJobStatus(db database.Store, id string, page, limit int, verbose, debug bool) (globalstructs.Job, error) {
+	job, err := db.GetJob(id, verbose, debug)
+	if err != nil {
+		return job, err
+	}
+
+	// The tasks trimmed from the history are not counted
+	total, finished := 0, 0
+	for status, count := range job.Status {
+		total += count
+		if IsFinishedStatus(status) {
+			finished += count
+		}
+	}
+	if total > 0 {
+		job.Progress = float64(finished) * 100 / float64(total)
+	}
+
+	if page < 1 {
+		return job, nil
+	}
+	tasks, err := db.GetJobTasks(id, nil, page, limit, verbose, debug)
+	if err != nil {
+		return job, err
+	}
+	job.Tasks = make([]globalstructs.JobTask, 0, len(tasks))
+	for _, task := range tasks {
+		jobTask := globalstructs.JobTask{
+			ID:      task.ID,
+			Name:    task.Name,
+			Status:  task.Status,
+			Outputs: make([]string, 0, len(task.Commands)),
+		}
+		for _, command := range task.Commands {
+			jobTask.Outputs = append(jobTask.Outputs, command.Output)
+		}
+		job.Tasks = append(job.Tasks, jobTask)
+	}
+	return job, nil
+}
+
+// deleteTaskTries times DeleteTask reads the task again when its status changes meanwhile
+const deleteTaskTries = 3
+
+// DeleteTask sets the task as deleted and skips its dependents. A running task is stopped
+// instead: it stays running with cancelRequested, so it still counts in the limits of the
+// manager, until its worker sends it back as cancelled, or with its real status if it finished
+// before being stopped. The task is updated with its status in the database
+func DeleteTask(db database.Store, config *ManagerConfig, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
+	for try := 0; try < deleteTaskTries; try++ {
+		if task.Status == "running" {
+			worker, err := db.GetWorker(task.WorkerName, verbose, debug)
+			if err == nil {
+				// Only if it is still running on the worker, it isn't sent again or retried
+				requested, err := db.SetTaskCancelRequested(task.ID, worker.Name, verbose, debug)
+				if err != nil {
+					return err
+				}
+				if requested {
+					// If its runing send stop signal to worker, its callback sets the status
+					err = SendDeleteTask(db, config, &worker, task, verbose, debug, writeLock)
+					if err != nil {
+						return err
+					}
+					*task, err = db.GetTask(task.ID, verbose, debug)
+					return err
+				}
+				*task, err = db.GetTask(task.ID, verbose, debug)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		// Only if the status didn't change since the task was read, e.g. sent to a worker
+		deleted, err := db.SetTaskStatusIfStatus(task.ID, task.Status, "deleted", verbose, debug)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			// Only a task that was sent to a worker has results
+			ran := task.Retries > 0 || (task.Status != "pending" && task.Status != "skipped")
+			task.Status = "deleted"
+			TaskDeleted(db, config, task.ID, ran, verbose, debug)
+			return nil
+		}
+
+		*task, err = db.GetTask(task.ID, verbose, debug)
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("task %s changed while it was deleted, status %s", task.ID, task.Status)
+}
+
+// TaskDeleted skips the dependents of a task set as deleted and removes its results
+// from the result store if it ran
+func TaskDeleted(db database.Store, config *ManagerConfig, id string, ran, verbose, debug bool) {
+	// The tasks waiting for this one will never run
+	if err := SkipDependentTasks(db, id, verbose, debug); err != nil {
+		log.Println("Utils Error SkipDependentTasks:", err)
+	}
+	if ran {
+		DeleteTaskResults(config, id, verbose, debug)
+	}
+}
+
+// DeleteTaskResults removes the outputs and artifacts of every attempt of the task from the result store
+func DeleteTaskResults(config *ManagerConfig, id string, verbose, debug bool) {
+	if config.Results == nil {
+		return
+	}
+	if err := config.Results.DeleteTask(id); err != nil {
+		log.Println("Utils Error deleting the results of task", id, err)
+		return
+	}
+	if debug {
+		log.Println("Utils Results of task", id, "deleted")
+	}
+}
+
+// CancelJob deletes the pending and running tasks of a job, returns the number of tasks deleted
+func CancelJob(db database.Store, config *ManagerConfig, id string, verbose, debug bool, writeLock *sync.Mutex) (int, error) {
+	// Read all the tasks first, deleting them changes the pages
+	var tasks []globalstructs.Task
+	for page := 1; ; page++ {
+		pageTasks, err := db.GetJobTasks(id, []string{"pending", "running"}, page, jobPageSize, verbose, debug)
+		if err != nil {
+			return 0, err
+		}
+		tasks = append(tasks, pageTasks...)
+		if len(pageTasks) < jobPageSize {
+			break
+		}
+	}
+
+	deleted := 0
+	for i := range tasks {
+		err := DeleteTask(db, config, &tasks[i], verbose, debug, writeLock)
+		if err != nil {
+			log.Println("Utils Error CancelJob", tasks[i].ID, err.Error())
+			continue
+		}
+		deleted++
+	}
+	if verbose {
+		log.Println("Utils CancelJob", id, "deleted", deleted, "of", len(tasks))
+	}
+	return deleted, nil
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/resultstore"
+)
+
+func TestDeleteTask(t *testing.T) {
+	db := openTestDB(t)
+	config := &ManagerConfig{}
+	var writeLock sync.Mutex
+
+	addTestTask(t, db, "parent", "user", 0, "")
+	addTestChild(t, db, "child", "user", "parent")
+
+	task, err := db.GetTask("parent", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteTask(db, config, &task, false, false, &writeLock); err != nil || task.Status != "deleted" {
+		t.Fatalf("DeleteTask = %v, status %s, want deleted", err, task.Status)
+	}
+	if child, err := db.GetTask("child", false, false); err != nil || child.Status != "skipped" {
+		t.Errorf("child of a deleted task: status %s, %v, want skipped", child.Status, err)
+	}
+}
+
+func TestDeleteTaskStatusChanged(t *testing.T) {
+	db := openTestDB(t)
+	config := &ManagerConfig{}
+	var writeLock sync.Mutex
+
+	addTestTask(t, db, "task", "user", 0, "")
+	task, err := db.GetTask("task", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the task finished after it was read, it's deleted from its new status
+	if err = db.SetTaskStatus("task", "done", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteTask(db, config, &task, false, false, &writeLock); err != nil || task.Status != "deleted" {
+		t.Fatalf("DeleteTask = %v, status %s, want deleted", err, task.Status)
+	}
+}
+
+// testWorkerConn returns the manager side of a websocket to a worker, the messages
+// the worker receives are sent to the channel
+func testWorkerConn(t *testing.T) (*websocket.Conn, <-chan globalstructs.WebsocketMessage) {
+	t.Helper()
+	messages := make(chan globalstructs.WebsocketMessage, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := globalstructs.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg globalstructs.WebsocketMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, messages
+}
+
+func TestDeleteRunningTask(t *testing.T) {
+	db := openTestDB(t)
+	conn, messages := testWorkerConn(t)
+	config := &ManagerConfig{WebSockets: map[string]*websocket.Conn{"worker1": conn}}
+	var writeLock sync.Mutex
+
+	worker := globalstructs.Worker{Name: "worker1", DefaultThreads: 1, UP: true}
+	if err := db.AddWorker(&worker, false, false); err != nil {
+		t.Fatal(err)
+	}
+	addTestTask(t, db, "parent", "user", 0, "")
+	addTestChild(t, db, "child", "user", "parent")
+	task, err := db.GetTask("parent", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Status, task.WorkerName = "running", "worker1"
+	if err = db.UpdateTask(task, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the task keeps running, and counting in the limits, until the worker stops it
+	if err = DeleteTask(db, config, &task, false, false, &writeLock); err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != "running" || !task.CancelRequested {
+		t.Errorf("deleted running task: status %s, cancelRequested %v, want running and true", task.Status, task.CancelRequested)
+	}
+	msg := <-messages
+	var sent globalstructs.Task
+	if err = json.Unmarshal([]byte(msg.JSON), &sent); err != nil || msg.Type != "deleteTask" || sent.ID != "parent" {
+		t.Errorf("worker received %s %s, want deleteTask of parent", msg.Type, msg.JSON)
+	}
+	if child, err := db.GetTask("child", false, false); err != nil || child.Status != "pending" {
+		t.Errorf("child of a task being cancelled: status %s, %v, want pending", child.Status, err)
+	}
+
+	// the worker is gone before it stops the task, the task isn't sent again
+	if err = WorkerDisconnected(db, config, &worker, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if task, err = db.GetTask("parent", false, false); err != nil || task.Status != "deleted" {
+		t.Errorf("cancelled task of a disconnected worker: status %s, %v, want deleted", task.Status, err)
+	}
+	if child, err := db.GetTask("child", false, false); err != nil || child.Status != "skipped" {
+		t.Errorf("child of a deleted task: status %s, %v, want skipped", child.Status, err)
+	}
+}
+
+func TestDeleteTaskResults(t *testing.T) {
+	db := openTestDB(t)
+	results, err := resultstore.New(resultstore.Config{Path: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ManagerConfig{Results: results}
+	var writeLock sync.Mutex
+
+	addTestTask(t, db, "task", "user", 0, "")
+	if err = db.SetTaskStatus("task", "done", false, false); err != nil {
+		t.Fatal(err)
+	}
+	key := globalstructs.ResultKey("task", 0, 0)
+	if err = results.WriteChunk(globalstructs.ResultChunk{ID: "task", Data: []byte("output"), Last: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := db.GetTask("task", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteTask(db, config, &task, false, false, &writeLock); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := results.Open(key); !errors.Is(err, resultstore.ErrNotFound) {
+		t.Errorf("output of a deleted task: %v, want ErrNotFound", err)
+	}
+}
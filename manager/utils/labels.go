@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelRequirement one term of a label selector
+type labelRequirement struct {
+	Key      string
+	Value    string
+	Operator string // exists, notExists, equals, notEquals
+}
+
+// ParseLabelSelector parses a comma separated label selector.
+// Each term can be "key" (label exists), "!key" (label does not exist),
+// "key=value" or "key!=value", e.g. "region=eu,has-nmap,gpu!=true"
+func ParseLabelSelector(selector string) ([]labelRequirement, error) {
+	var requirements []labelRequirement
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var req labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			req = labelRequirement{Key: parts[0], Value: parts[1], Operator: "notEquals"}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+			req = labelRequirement{Key: parts[0], Value: parts[1], Operator: "equals"}
+		case strings.HasPrefix(term, "!"):
+			req = labelRequirement{Key: term[1:], Operator: "notExists"}
+		default:
+			req = labelRequirement{Key: term, Operator: "exists"}
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Key == "" || strings.ContainsAny(req.Key, "=! ") {
+			return nil, fmt.Errorf("invalid label selector term %q", term)
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, nil
+}
+
+// MatchLabels returns true if the labels match every term of the selector,
+// an invalid selector never matches
+func MatchLabels(selector string, labels map[string]string) bool {
+	requirements, err := ParseLabelSelector(selector)
+	if err != nil {
+		return false
+	}
+	for _, req := range requirements {
+		value, found := labels[req.Key]
+		switch req.Operator {
+		case "exists":
+			if !found {
+				return false
+			}
+		case "notExists":
+			if found {
+				return false
+			}
+		case "equals":
+			if !found || value != req.Value {
+				return false
+			}
+		case "notEquals":
+			if found && value == req.Value {
+				return false
+			}
+		}
+	}
+	return true
+}
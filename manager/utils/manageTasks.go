@@ -1,66 +1,306 @@
 package utils
 
 import (
-	"database/sql"
 	"log"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/r4ulcl/nTask/globalstructs"
 	"github.com/r4ulcl/nTask/manager/database"
 )
 
+// maxPendingPages pages of pending tasks read in each cycle of ManageTasks, the tasks that
+// no idle worker can run are only filtered after reading them
+const maxPendingPages = 10
+
 // ManageTasks infinite loop to manage task
-func ManageTasks(config *ManagerConfig, db *sql.DB, verbose, debug bool, writeLock *sync.Mutex) {
+func ManageTasks(config *ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
+	// tasks started by rate key, for the maxPerMinute of the rate limits
+	starts := rateStarts{}
+	// offsets where the next cycle starts reading the pending tasks, after maxPendingPages
+	var resume map[string]int
 	// infinite loop eecuted with go routine
 	for {
+		// Get iddle workers
+		workers, err := db.GetWorkerIddle(verbose, debug)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		if len(workers) == 0 {
+			time.Sleep(time.Millisecond * 500)
+			continue
+		}
+
 		// Get all tasks in order and if priority
 		workersThreads := getWorkersThreads(db, verbose, debug)
-		tasks, err := database.GetTasksPending(workersThreads, db, verbose, debug)
+		queueRunning, err := db.CountTasksByQueue("running", verbose, debug)
 		if err != nil {
 			log.Println(err.Error())
+			queueRunning = map[string]int{}
 		}
-
-		// Get iddle workers
-		workers, err := database.GetWorkerIddle(db, verbose, debug)
+		rateRunning := map[string]int{}
+		if config.hasRateLimits() {
+			rateRunning, err = db.CountTasksByRateKey("running", verbose, debug)
+			if err != nil {
+				log.Println(err.Error())
+				rateRunning = map[string]int{}
+			}
+		}
+		skip := database.PendingSkip{
+			Queues:      append(fullQueues(config, queueRunning), queuesWithoutWorkers(config, workers)...),
+			RateKeys:    limitedRateKeys(config, rateRunning, starts, time.Now()),
+			IdleWorkers: workerNames(workers),
+		}
+		pages, err := newPendingPages(config, workersThreads, skip, db, verbose, debug)
 		if err != nil {
 			log.Println(err.Error())
+			time.Sleep(time.Second * 1)
+			continue
 		}
-
-		if debug {
-			log.Println("Utils tasks", len(tasks))
-			log.Println("Utils workers", len(workers))
+		if resume != nil {
+			pages.passed = resume
 		}
 
-		// if there are tasks
-		if len(tasks) > 0 && len(workers) > 0 {
+		// The tasks that no iddle worker can run are passed over, the next pages are read
+		// until the workers are busy, there are no more tasks or maxPendingPages were read,
+		// then the next cycle continues after them
+		found, sent, page := 0, 0, 0
+		for ; len(workers) > 0 && !pages.done && page < maxPendingPages; page++ {
+			tasks, err := pages.next(verbose, debug)
+			if err != nil {
+				log.Println(err.Error())
+				break
+			}
+			found += len(tasks)
+			if debug {
+				log.Println("Utils tasks", len(tasks))
+				log.Println("Utils workers", len(workers))
+			}
+
 			for _, task := range tasks {
+				// the user can't run more tasks at the same time
+				if maxRunning := config.UserQuota(task.Username).MaxRunning; maxRunning > 0 && pages.running[task.Username] >= maxRunning {
+					continue
+				}
+				// the tasks of the rate key can't start now
+				if !rateAllows(config, &task, rateRunning, starts, time.Now()) {
+					continue
+				}
 				for _, worker := range workers {
-					// if WorkerName not send or set this worker, just sendAddTask
-					if task.WorkerName == "" || task.WorkerName == worker.Name {
+					// if the worker can run the task, just sendAddTask
+					if canRunOn(&task, &worker) && queueAllows(config, &task, &worker, queueRunning) {
 						err = sendAddTask(db, config, &worker, &task, verbose, debug, writeLock)
 						if err != nil {
 							log.Println("Utils Error sendAddTask", err.Error())
 							//time.Sleep(time.Second * 1)
-							break
+						} else {
+							sent++
+							pages.sent(&task)
+							queueRunning[task.Queue]++
+							if task.RateKey != "" {
+								rateRunning[task.RateKey]++
+								starts.add(task.RateKey, time.Now())
+							}
+							// Update iddle workers after sending a task
+							workers, err = db.GetWorkerIddle(verbose, debug)
+							if err != nil {
+								log.Println(err.Error())
+							}
 						}
+						break
 					}
 				}
-				// Update iddle workers after loop all
-				workers, err = database.GetWorkerIddle(db, verbose, debug)
-				if err != nil {
-					log.Println(err.Error())
-				}
 				// If no workers just start again
 				if len(workers) == 0 {
 					break
 				}
 			}
-		} else {
-			if len(tasks) == 0 {
-				time.Sleep(time.Second * 1)
-			} else if len(workers) == 0 {
-				time.Sleep(time.Millisecond * 500)
+		}
+
+		resume = nil
+		if page == maxPendingPages && !pages.done {
+			resume = pages.passed
+		}
+
+		if found == 0 {
+			time.Sleep(time.Second * 1)
+		} else if sent == 0 {
+			// No iddle worker can run the pending tasks
+			time.Sleep(time.Millisecond * 500)
+		}
+	}
+}
+
+// workerNames returns the names of the workers
+func workerNames(workers []globalstructs.Worker) []string {
+	names := make([]string, len(workers))
+	for i, worker := range workers {
+		names[i] = worker.Name
+	}
+	return names
+}
+
+// pendingPages reads the tasks to send to the workers in order by pages of limit tasks,
+// without the ones of skip.
+// With fairShare or a limit of running tasks the tasks of each user are read apart,
+// so the tasks of a user can't hide the ones of the rest
+type pendingPages struct {
+	config  *ManagerConfig
+	db      database.Store
+	limit   int
+	skip    database.PendingSkip
+	byUser  bool
+	running map[string]int // running tasks of each user
+	usage   map[string]int // tasks started by each user in the fairShare window
+	passed  map[string]int // tasks of each user read and not sent, by "" without byUser
+	done    bool           // there are no more tasks after the last page
+}
+
+// newPendingPages reads the running and started tasks of each user
+func newPendingPages(config *ManagerConfig, limit int, skip database.PendingSkip, db database.Store, verbose, debug bool) (*pendingPages, error) {
+	pages := &pendingPages{
+		config:  config,
+		db:      db,
+		limit:   max(limit, 1),
+		skip:    skip,
+		byUser:  config.FairShare || config.hasQuotas(),
+		running: map[string]int{},
+		passed:  map[string]int{},
+	}
+	if !pages.byUser {
+		return pages, nil
+	}
+
+	var err error
+	pages.running, err = db.CountTasksByUser("running", verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+	if config.FairShare {
+		since := time.Now().Add(-time.Duration(config.FairShareWindow) * time.Second)
+		pages.usage, err = db.CountTasksStartedByUser(since, verbose, debug)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// next returns the next page of tasks, done is set when there are no more.
+// The tasks sent to the workers leave the pending ones, so the pages
+// start after the tasks read and not sent
+func (pages *pendingPages) next(verbose, debug bool) ([]globalstructs.Task, error) {
+	if !pages.byUser {
+		tasks, err := pages.db.GetTasksPending(pages.limit, pages.passed[""], pages.skip, verbose, debug)
+		pages.done = err != nil || len(tasks) < pages.limit
+		pages.passed[""] += len(tasks)
+		return tasks, err
+	}
+
+	// the users that can't run more tasks at the same time
+	var full []string
+	for username, running := range pages.running {
+		if maxRunning := pages.config.UserQuota(username).MaxRunning; maxRunning > 0 && running >= maxRunning {
+			full = append(full, username)
+		}
+	}
+	tasks, err := pages.db.GetTasksPendingByUser(pages.limit, pages.passed, full, pages.skip, verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	pages.done = true
+	byUser := make(map[string][]globalstructs.Task)
+	for _, task := range tasks {
+		byUser[task.Username] = append(byUser[task.Username], task)
+	}
+	for username, userTasks := range byUser {
+		pages.passed[username] += len(userTasks)
+		if len(userTasks) == pages.limit {
+			pages.done = false
+		}
+	}
+
+	if !pages.config.FairShare {
+		return mergeTasks(byUser), nil
+	}
+	return interleaveTasks(byUser, pages.usage), nil
+}
+
+// sent saves that a task of the last page was sent to a worker
+func (pages *pendingPages) sent(task *globalstructs.Task) {
+	pages.running[task.Username]++
+	if pages.byUser {
+		pages.passed[task.Username]--
+	} else {
+		pages.passed[""]--
+	}
+}
+
+// mergeTasks returns the tasks of every user in the order of GetTasksPending
+func mergeTasks(byUser map[string][]globalstructs.Task) []globalstructs.Task {
+	var tasks []globalstructs.Task
+	for _, userTasks := range byUser {
+		tasks = append(tasks, userTasks...)
+	}
+	slices.SortStableFunc(tasks, func(a, b globalstructs.Task) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return strings.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	return tasks
+}
+
+// interleaveTasks returns the tasks of every user taking each time the next task of the user
+// with the lowest usage, the tasks of a user keep their order
+func interleaveTasks(byUser map[string][]globalstructs.Task, usage map[string]int) []globalstructs.Task {
+	var tasks []globalstructs.Task
+	for {
+		next := ""
+		for username, userTasks := range byUser {
+			if len(userTasks) == 0 {
+				continue
 			}
+			if next == "" || usage[username] < usage[next] || (usage[username] == usage[next] && username < next) {
+				next = username
+			}
+		}
+		if next == "" {
+			return tasks
+		}
+		tasks = append(tasks, byUser[next][0])
+		byUser[next] = byUser[next][1:]
+		usage[next]++
+	}
+}
+
+// canRunOn returns true if the task can be sent to the worker
+func canRunOn(task *globalstructs.Task, worker *globalstructs.Worker) bool {
+	// if WorkerName is set only that worker can run the task
+	if task.WorkerName != "" && task.WorkerName != worker.Name {
+		return false
+	}
+	// the worker labels must match the task selector
+	if task.Requires != "" && !MatchLabels(task.Requires, worker.Labels) {
+		return false
+	}
+	// the worker must have every module of the task,
+	// workers that don't send their modules can run anything
+	if len(worker.Modules) > 0 && !hasModules(worker.Modules, task.Commands) {
+		return false
+	}
+	return true
+}
+
+// hasModules returns true if every command module is in modules
+func hasModules(modules []string, commands []globalstructs.Command) bool {
+	for _, command := range commands {
+		if !slices.Contains(modules, command.Module) {
+			return false
 		}
 	}
+	return true
 }
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// openTestDB returns an empty SQLite database with every migration applied
+func openTestDB(t *testing.T) database.Store {
+	t.Helper()
+	db, err := database.ConnectDB("sqlite", "", "", "", "", filepath.Join(t.TempDir(), "ntask.db"), false, false)
+	if err != nil {
+		t.Fatalf("ConnectDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err = db.Migrate(false, false, false); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func addTestTask(t *testing.T, db database.Store, id, username string, priority int, requires string, modules ...string) {
+	t.Helper()
+	task := globalstructs.Task{
+		ID:       id,
+		Name:     id,
+		Status:   "pending",
+		Username: username,
+		Priority: priority,
+		Queue:    DefaultQueue,
+		Requires: requires,
+		Files:    []globalstructs.File{},
+	}
+	for _, module := range modules {
+		task.Commands = append(task.Commands, globalstructs.Command{Module: module})
+	}
+	if err := db.AddTask(task, 0, false, false); err != nil {
+		t.Fatalf("AddTask %s: %v", id, err)
+	}
+}
+
+// placeable reads the pages until a task can run on the worker, like ManageTasks,
+// and returns it and the number of pages read
+func placeable(t *testing.T, pages *pendingPages, worker *globalstructs.Worker) (string, int) {
+	t.Helper()
+	for read := 1; !pages.done; read++ {
+		tasks, err := pages.next(false, false)
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		for _, task := range tasks {
+			if canRunOn(&task, worker) {
+				return task.ID, read
+			}
+		}
+	}
+	return "", 0
+}
+
+func TestPendingPagesPassUnplaceableTasks(t *testing.T) {
+	db := openTestDB(t)
+	// more tasks for a GPU worker than threads, with higher priority
+	for i := 0; i < 5; i++ {
+		addTestTask(t, db, fmt.Sprintf("gpu%d", i), "user", 10, "gpu")
+	}
+	addTestTask(t, db, "cpu", "user", 1, "")
+
+	for _, config := range []*ManagerConfig{
+		{},
+		{FairShare: true, FairShareWindow: 3600},
+	} {
+		worker := globalstructs.Worker{Name: "worker1", Labels: map[string]string{}}
+		pages, err := newPendingPages(config, 2, database.PendingSkip{}, db, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, read := placeable(t, pages, &worker); id != "cpu" || read != 3 {
+			t.Errorf("fairShare %v: placeable task %q in page %d, want cpu in page 3", config.FairShare, id, read)
+		}
+	}
+}
+
+func TestPendingPagesPassMissingModules(t *testing.T) {
+	db := openTestDB(t)
+	for i := 0; i < 5; i++ {
+		addTestTask(t, db, fmt.Sprintf("nmap%d", i), "user", 10, "", "exec", "nmap")
+	}
+	addTestTask(t, db, "exec", "user", 1, "", "exec")
+
+	worker := globalstructs.Worker{Name: "worker1", Modules: []string{"exec"}}
+	pages, err := newPendingPages(&ManagerConfig{}, 2, database.PendingSkip{}, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, read := placeable(t, pages, &worker); id != "exec" || read != 3 {
+		t.Errorf("placeable task %q in page %d, want exec in page 3", id, read)
+	}
+}
+
+func TestPendingPagesSent(t *testing.T) {
+	db := openTestDB(t)
+	for i := 0; i < 4; i++ {
+		addTestTask(t, db, fmt.Sprintf("task%d", i), "user", 10-i, "")
+	}
+
+	pages, err := newPendingPages(&ManagerConfig{}, 2, database.PendingSkip{}, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := pages.next(false, false)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("first page = %d tasks, %v", len(tasks), err)
+	}
+	// task0 is sent and leaves the pending tasks, task1 is passed over
+	if err = db.SetTaskStatus(tasks[0].ID, "running", false, false); err != nil {
+		t.Fatal(err)
+	}
+	pages.sent(&tasks[0])
+
+	if tasks, err = pages.next(false, false); err != nil || len(tasks) != 2 || tasks[0].ID != "task2" {
+		t.Errorf("second page = %v, %v, want task2 and task3", tasks, err)
+	}
+}
+
+func TestRetryRunsOnAnotherWorker(t *testing.T) {
+	db := openTestDB(t)
+	addTestTask(t, db, "task", "user", 0, "")
+	task, err := db.GetTask("task", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.MaxRetries = 1
+	task.Status, task.WorkerName = "running", "worker1"
+	if err = db.UpdateTask(task, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// worker1 fails the task and leaves
+	retried, err := RetryTaskIfAllowed(db, task, false, false)
+	if err != nil || !retried {
+		t.Fatalf("RetryTaskIfAllowed = %v, %v, want retried", retried, err)
+	}
+	if task, err = db.GetTask("task", false, false); err != nil {
+		t.Fatal(err)
+	}
+	worker := globalstructs.Worker{Name: "worker2"}
+	if task.Status != "pending" || !canRunOn(&task, &worker) {
+		t.Errorf("retried task: status %s, workerName %q, want pending and runnable on worker2", task.Status, task.WorkerName)
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// CheckQueue sets the default queue of a task without queue, checks that the queue exists
+// and that the user can add tasks to it, and sets the default priority of the queue
+func CheckQueue(config *ManagerConfig, task *globalstructs.Task, username string) error {
+	if task.Queue == "" {
+		task.Queue = DefaultQueue
+	}
+	queue, ok := config.Queues[task.Queue]
+	if !ok && task.Queue != DefaultQueue {
+		return fmt.Errorf("Invalid queue: %s", task.Queue)
+	}
+	if len(queue.Users) > 0 && !slices.Contains(queue.Users, username) {
+		return fmt.Errorf("Invalid queue: %s can't add tasks to %s", username, task.Queue)
+	}
+	if task.Priority == 0 {
+		task.Priority = queue.DefaultPriority
+	}
+	return nil
+}
+
+// fullQueues returns the queues that can't run more tasks at the same time
+func fullQueues(config *ManagerConfig, running map[string]int) []string {
+	var full []string
+	for name, queue := range config.Queues {
+		if queue.MaxRunning > 0 && running[name] >= queue.MaxRunning {
+			full = append(full, name)
+		}
+	}
+	sort.Strings(full)
+	return full
+}
+
+// queuesWithoutWorkers returns the queues with allowed workers when none of them is idle
+func queuesWithoutWorkers(config *ManagerConfig, idle []globalstructs.Worker) []string {
+	var queues []string
+	for name, queue := range config.Queues {
+		if len(queue.Workers) > 0 && !slices.ContainsFunc(idle, func(worker globalstructs.Worker) bool {
+			return slices.Contains(queue.Workers, worker.Name)
+		}) {
+			queues = append(queues, name)
+		}
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// queueAllows returns true if the queue of the task is not full and the worker can run its tasks,
+// the queues removed from the config have no limits
+func queueAllows(config *ManagerConfig, task *globalstructs.Task, worker *globalstructs.Worker, running map[string]int) bool {
+	queue := config.Queues[task.Queue]
+	if queue.MaxRunning > 0 && running[task.Queue] >= queue.MaxRunning {
+		return false
+	}
+	return len(queue.Workers) == 0 || slices.Contains(queue.Workers, worker.Name)
+}
+
+// GetStatusQueues returns the pending and running tasks of the configured queues
+// and of the queues with tasks
+func GetStatusQueues(config *ManagerConfig, db database.Store, verbose, debug bool) ([]StatusQueue, error) {
+	pending, err := db.CountTasksByQueue("pending", verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+	running, err := db.CountTasksByQueue("running", verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{DefaultQueue: true}
+	for name := range config.Queues {
+		names[name] = true
+	}
+	for name := range pending {
+		names[name] = true
+	}
+	for name := range running {
+		names[name] = true
+	}
+
+	status := make([]StatusQueue, 0, len(names))
+	for name := range names {
+		queue := config.Queues[name]
+		status = append(status, StatusQueue{
+			Name:       name,
+			Pending:    pending[name],
+			Running:    running[name],
+			MaxRunning: queue.MaxRunning,
+			Users:      append([]string{}, queue.Users...),
+			Workers:    append([]string{}, queue.Workers...),
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status, nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+func TestQueuesWithoutWorkers(t *testing.T) {
+	config := &ManagerConfig{Queues: map[string]Queue{
+		"gpu":     {Workers: []string{"gpu1", "gpu2"}},
+		"scans":   {Workers: []string{"scanner"}},
+		"default": {MaxRunning: 10},
+	}}
+
+	tests := []struct {
+		idle []string
+		want []string
+	}{
+		{nil, []string{"gpu", "scans"}},
+		{[]string{"worker1"}, []string{"gpu", "scans"}},
+		{[]string{"worker1", "gpu2"}, []string{"scans"}},
+		{[]string{"scanner", "gpu1"}, nil},
+	}
+	for _, tt := range tests {
+		var idle []globalstructs.Worker
+		for _, name := range tt.idle {
+			idle = append(idle, globalstructs.Worker{Name: name})
+		}
+		if got := queuesWithoutWorkers(config, idle); !slices.Equal(got, tt.want) {
+			t.Errorf("queuesWithoutWorkers(%v) = %v, want %v", tt.idle, got, tt.want)
+		}
+	}
+}
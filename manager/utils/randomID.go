@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+)
+
+// GenerateRandomID generates a random ID of the specified length
+func GenerateRandomID(length int, verbose, debug bool) (string, error) {
+	// Calculate the number of bytes needed to achieve the desired length
+	numBytes := length / 2 // Since 1 byte = 2 hex characters
+
+	// Generate random bytes
+	randomBytes := make([]byte, numBytes)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Convert random bytes to hex string
+	randomID := hex.EncodeToString(randomBytes)
+
+	if verbose || debug {
+		log.Println("generateRandomID executed", randomID)
+	}
+
+	return randomID, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"sort"
+	"time"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// rateStarts start times of the tasks of each rate key in the last minute
+type rateStarts map[string][]time.Time
+
+// count returns the tasks of the key started in the minute before now
+func (starts rateStarts) count(key string, now time.Time) int {
+	times := starts[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= time.Minute {
+		i++
+	}
+	if i == len(times) {
+		delete(starts, key)
+		return 0
+	}
+	starts[key] = times[i:]
+	return len(times) - i
+}
+
+// add saves a start of a task of the key
+func (starts rateStarts) add(key string, now time.Time) {
+	starts[key] = append(starts[key], now)
+}
+
+// rateAllows returns true if the task can start now with the limits of its rate key
+func rateAllows(config *ManagerConfig, task *globalstructs.Task, running map[string]int, starts rateStarts, now time.Time) bool {
+	if task.RateKey == "" {
+		return true
+	}
+	limit := config.KeyRateLimit(task.RateKey)
+	if limit.MaxRunning > 0 && running[task.RateKey] >= limit.MaxRunning {
+		return false
+	}
+	return limit.MaxPerMinute <= 0 || starts.count(task.RateKey, now) < limit.MaxPerMinute
+}
+
+// limitedRateKeys returns the rate keys that can't start more tasks now
+func limitedRateKeys(config *ManagerConfig, running map[string]int, starts rateStarts, now time.Time) []string {
+	keys := map[string]bool{}
+	for key := range running {
+		keys[key] = true
+	}
+	for key := range starts {
+		keys[key] = true
+	}
+
+	var limited []string
+	for key := range keys {
+		if !rateAllows(config, &globalstructs.Task{RateKey: key}, running, starts, now) {
+			limited = append(limited, key)
+		}
+	}
+	sort.Strings(limited)
+	return limited
+}
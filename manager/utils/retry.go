@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"log"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// maxRetryBackoff max seconds to wait before a retry (1 day)
+const maxRetryBackoff = 24 * 60 * 60
+
+// RetryBackoff returns the seconds to wait before the next attempt,
+// retryBackoffSeconds is doubled after each retry
+func RetryBackoff(task globalstructs.Task) int {
+	backoff := task.RetryBackoffSeconds
+	if backoff <= 0 {
+		return 0
+	}
+	for i := 0; i < task.Retries; i++ {
+		backoff *= 2
+		if backoff >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	return backoff
+}
+
+// RetryTaskIfAllowed sets the failed task as pending again if it has retries left,
+// returns true if the task is going to be retried
+func RetryTaskIfAllowed(db database.Store, task globalstructs.Task, verbose, debug bool) (bool, error) {
+	if task.Retries >= task.MaxRetries {
+		return false, nil
+	}
+
+	backoff := RetryBackoff(task)
+	if err := db.RetryTask(task.ID, backoff, verbose, debug); err != nil {
+		return false, err
+	}
+
+	if verbose {
+		log.Printf("Utils Task %s failed, retry %d/%d in %d seconds", task.ID, task.Retries+1, task.MaxRetries, backoff)
+	}
+	return true, nil
+}
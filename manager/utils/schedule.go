@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+// scheduleInterval time between checks of the due schedules
+const scheduleInterval = 5 * time.Second
+
+// ManageSchedules infinite loop to add the tasks of the schedules when they are due
+func ManageSchedules(db database.Store, config *ManagerConfig, verbose, debug bool) {
+	for {
+		now := time.Now()
+		schedules, err := db.GetSchedulesDue(now, verbose, debug)
+		if err != nil {
+			log.Println("Utils Error GetSchedulesDue", err.Error())
+		}
+
+		for _, schedule := range schedules {
+			err = runSchedule(db, config, schedule, now, verbose, debug)
+			if err != nil {
+				log.Println("Utils Error runSchedule", schedule.ID, err.Error())
+			}
+		}
+
+		time.Sleep(scheduleInterval)
+	}
+}
+
+// runSchedule adds a new task from the schedule template and sets the next execution,
+// the queue and the maxPending quota of the user are checked like in the API
+func runSchedule(db database.Store, config *ManagerConfig, schedule globalstructs.Schedule, now time.Time, verbose, debug bool) error {
+	nextRunAt, err := NextScheduleRun(schedule.Cron, now)
+	if err != nil {
+		return err
+	}
+
+	task := schedule.Task
+	task.ID, err = GenerateRandomID(30, verbose, debug)
+	if err != nil {
+		return fmt.Errorf("Invalid ID generated: %s", err.Error())
+	}
+	task.Status = "pending"
+	task.Username = schedule.Username
+
+	// The queue may have changed since the schedule was created, the schedules
+	// added before the queues have none and use the default queue
+	taskErr := CheckQueue(config, &task, schedule.Username)
+	if taskErr == nil {
+		// The parents may have been deleted since the schedule was created,
+		// their owner was checked then
+		taskErr = CheckDependencies(db, &task, "", verbose, debug)
+	}
+	if taskErr == nil {
+		taskErr = db.AddTask(task, config.UserQuota(schedule.Username).MaxPending, verbose, debug)
+	}
+	if taskErr != nil {
+		task.ID = ""
+	} else if verbose {
+		log.Println("Utils schedule", schedule.ID, "added task", task.ID)
+	}
+
+	// The next execution is saved even if the task wasn't added, so a broken template is not added in a loop
+	err = db.SetScheduleRun(schedule.ID, task.ID, now, nextRunAt, verbose, debug)
+	if err != nil {
+		return err
+	}
+	return taskErr
+}
+
+// NextScheduleRun returns the next execution after t of a cron expression,
+// nil if the expression is empty (a schedule that only runs once)
+func NextScheduleRun(expr string, t time.Time) (*time.Time, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	next := cron.Next(t)
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return &next, nil
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+)
+
+func TestRunScheduleLimits(t *testing.T) {
+	db := openTestDB(t)
+	config := &ManagerConfig{
+		DefaultQuota: Quota{MaxPending: 1},
+		Queues:       map[string]Queue{"private": {Users: []string{"other"}}},
+	}
+	addTestTask(t, db, "pending", "user", 0, "")
+
+	now := time.Now()
+	for _, tt := range []struct {
+		name  string
+		queue string
+	}{
+		{"quota", ""},
+		{"queue", "private"},
+	} {
+		schedule := globalstructs.Schedule{ID: tt.name, Cron: "* * * * *", Username: "user",
+			Task: globalstructs.Task{Queue: tt.queue, Files: []globalstructs.File{}}}
+		if err := db.AddSchedule(schedule, nil, &now, false, false); err != nil {
+			t.Fatal(err)
+		}
+		err := runSchedule(db, config, schedule, now, false, false)
+		var quotaErr *database.QuotaError
+		if err == nil || (tt.queue == "" && !errors.As(err, &quotaErr)) {
+			t.Errorf("runSchedule of the %s schedule = %v, want an error", tt.name, err)
+		}
+		// the next execution is set even if the task wasn't added
+		if schedule, err = db.GetSchedule(tt.name, false, false); err != nil || schedule.LastRunAt == "" || schedule.LastTaskID != "" {
+			t.Errorf("%s schedule = %+v, %v, want run without task", tt.name, schedule, err)
+		}
+	}
+}
@@ -1,71 +1,115 @@
 package utils
 
 import (
-	"database/sql"
+	"sort"
 
 	"github.com/r4ulcl/nTask/manager/database"
 )
 
 // GetStatusTask function to get task status, pending, running, etc
-func GetStatusTask(db *sql.DB, verbose, debug bool) (StatusTask, error) {
+func GetStatusTask(db database.Store, verbose, debug bool) (StatusTask, error) {
 	task := StatusTask{
-		Pending: 0,
-		Running: 0,
-		Done:    0,
-		Failed:  0,
-		Deleted: 0,
+		Pending:   0,
+		Running:   0,
+		Done:      0,
+		Failed:    0,
+		Deleted:   0,
+		Skipped:   0,
+		Cancelled: 0,
 	}
 
-	pending, err := database.GetCountByStatus("pending", db, verbose, debug)
+	pending, err := db.GetCountByStatus("pending", verbose, debug)
 	if err != nil {
 		return task, err
 	}
 	task.Pending = pending
 
-	running, err := database.GetCountByStatus("running", db, verbose, debug)
+	running, err := db.GetCountByStatus("running", verbose, debug)
 	if err != nil {
 		return task, err
 	}
 	task.Running = running
 
-	done, err := database.GetCountByStatus("done", db, verbose, debug)
+	done, err := db.GetCountByStatus("done", verbose, debug)
 	if err != nil {
 		return task, err
 	}
 	task.Done = done
 
-	failed, err := database.GetCountByStatus("failed", db, verbose, debug)
+	failed, err := db.GetCountByStatus("failed", verbose, debug)
 	if err != nil {
 		return task, err
 	}
 	task.Failed = failed
 
-	deleted, err := database.GetCountByStatus("deleted", db, verbose, debug)
+	deleted, err := db.GetCountByStatus("deleted", verbose, debug)
 	if err != nil {
 		return task, err
 	}
 	task.Deleted = deleted
 
+	skipped, err := db.GetCountByStatus("skipped", verbose, debug)
+	if err != nil {
+		return task, err
+	}
+	task.Skipped = skipped
+
+	cancelled, err := db.GetCountByStatus("cancelled", verbose, debug)
+	if err != nil {
+		return task, err
+	}
+	task.Cancelled = cancelled
+
 	return task, nil
 }
 
 // GetStatusWorker func to get status up, down of workers
-func GetStatusWorker(db *sql.DB, verbose, debug bool) (StatusWorker, error) {
+func GetStatusWorker(db database.Store, verbose, debug bool) (StatusWorker, error) {
 	worker := StatusWorker{
 		Up:   0,
 		Down: 0,
 	}
 
-	up, err := database.GetUpCount(db, verbose, debug)
+	up, err := db.GetUpCount(verbose, debug)
 	if err != nil {
 		return worker, err
 	}
 	worker.Up = up
 
-	down, err := database.GetDownCount(db, verbose, debug)
+	down, err := db.GetDownCount(verbose, debug)
 	if err != nil {
 		return worker, err
 	}
 	worker.Down = down
 	return worker, nil
 }
+
+// GetStatusModules func to get the modules of the workers up and how many workers have each one
+func GetStatusModules(db database.Store, verbose, debug bool) ([]StatusModule, error) {
+	workers, err := db.GetWorkerUP(verbose, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]*StatusModule)
+	for _, worker := range workers {
+		for _, name := range worker.Modules {
+			module, ok := modules[name]
+			if !ok {
+				module = &StatusModule{Name: name, WorkerNames: []string{}}
+				modules[name] = module
+			}
+			module.Workers++
+			module.WorkerNames = append(module.WorkerNames, worker.Name)
+		}
+	}
+
+	status := make([]StatusModule, 0, len(modules))
+	for _, module := range modules {
+		status = append(status, *module)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status, nil
+}
@@ -1,25 +1,29 @@
 package utils
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/websocket"
+	"github.com/r4ulcl/nTask/manager/resultstore"
 )
 
 // ManagerConfig manager config file struct
 type ManagerConfig struct {
-	Users              map[string]string          `json:"users"`
+	Users              map[string]User            `json:"users"`
 	Workers            map[string]string          `json:"workers"`
 	HTTPPort           int                        `json:"httpPort"`
 	HTTPSPort          int                        `json:"httpsPort"`
 	APIReadTimeout     int                        `json:"apiReadTimeout"`
 	APIWriteTimeout    int                        `json:"apiWriteTimeout"`
 	APIIdleTimeout     int                        `json:"apiIdleTimeout"`
+	DBDriver           string                     `json:"dbDriver"` // mysql (default), postgres or sqlite
 	DBUsername         string                     `json:"dbUsername"`
 	DBPassword         string                     `json:"dbPassword"`
 	DBHost             string                     `json:"dbHost"`
 	DBPort             string                     `json:"dbPort"`
 	DBDatabase         string                     `json:"dbDatabase"`
+	ManualMigrations   bool                       `json:"manualMigrations"` // don't apply migrations on start, use nTask manager migrate
 	StatusCheckSeconds int                        `json:"statusCheckSeconds"`
 	StatusCheckDown    int                        `json:"statusCheckDown"`
 	DiskPath           string                     `json:"diskPath"`
@@ -27,6 +31,103 @@ type ManagerConfig struct {
 	ClientHTTP         *http.Client               `json:"clientHTTP"`
 	WebSockets         map[string]*websocket.Conn `json:"webSockets"`
 	MaxTaskHistory     int                        `json:"maxTaskHistory"`
+	DefaultQuota       Quota                      `json:"defaultQuota"`     // quota of the users without one, also the users of the API tokens
+	FairShare          bool                       `json:"fairShare"`        // interleave the pending tasks of the users by their recent usage
+	FairShareWindow    int                        `json:"fairShareWindow"`  // seconds of recent usage used by fairShare
+	Queues             map[string]Queue           `json:"queues"`           // queues of the tasks by name, besides default
+	RateLimits         map[string]RateLimit       `json:"rateLimits"`       // limits of the tasks by rateKey
+	DefaultRateLimit   RateLimit                  `json:"defaultRateLimit"` // limits of the rate keys without their own
+	ResultStore        resultstore.Config         `json:"resultStore"`      // where the big outputs are saved
+	Results            *resultstore.Store         `json:"-"`
+}
+
+// User user of the API, in the config file a string is the token of an admin
+type User struct {
+	Token string `json:"token"`
+	Role  string `json:"role"` // admin, submitter (default) or read-only, admin if the user is only a token
+	Quota
+}
+
+// Quota limits of the tasks of a user, 0 is no limit
+type Quota struct {
+	MaxRunning int `json:"maxRunning"` // tasks running at the same time
+	MaxPending int `json:"maxPending"` // tasks waiting to run, more are rejected by the API
+}
+
+// Queue limits of the tasks of a queue, the tasks without queue are in the default queue
+type Queue struct {
+	MaxRunning      int      `json:"maxRunning"`      // tasks of the queue running at the same time, 0 is no limit
+	Users           []string `json:"users"`           // users that can add tasks to the queue, all if empty
+	DefaultPriority int      `json:"defaultPriority"` // priority of the tasks with priority 0
+	Workers         []string `json:"workers"`         // workers that can run the tasks of the queue, all if empty
+}
+
+// RateLimit limits of the tasks with the same rateKey, 0 is no limit
+type RateLimit struct {
+	MaxRunning   int `json:"maxRunning"`   // tasks running at the same time
+	MaxPerMinute int `json:"maxPerMinute"` // tasks started in the last minute
+}
+
+// KeyRateLimit returns the rate limit of a rate key, the limits it doesn't set are the ones of DefaultRateLimit
+func (config *ManagerConfig) KeyRateLimit(key string) RateLimit {
+	limit := config.RateLimits[key]
+	if limit.MaxRunning == 0 {
+		limit.MaxRunning = config.DefaultRateLimit.MaxRunning
+	}
+	if limit.MaxPerMinute == 0 {
+		limit.MaxPerMinute = config.DefaultRateLimit.MaxPerMinute
+	}
+	return limit
+}
+
+// hasRateLimits returns true if a rate key has a limit
+func (config *ManagerConfig) hasRateLimits() bool {
+	return len(config.RateLimits) > 0 || config.DefaultRateLimit != RateLimit{}
+}
+
+// DefaultQueue queue of the tasks without queue, it can be configured in Queues
+const DefaultQueue = "default"
+
+// UserQuota returns the quota of a user, the limits it doesn't set are the ones of DefaultQuota
+func (config *ManagerConfig) UserQuota(username string) Quota {
+	quota := config.Users[username].Quota
+	if quota.MaxRunning == 0 {
+		quota.MaxRunning = config.DefaultQuota.MaxRunning
+	}
+	if quota.MaxPending == 0 {
+		quota.MaxPending = config.DefaultQuota.MaxPending
+	}
+	return quota
+}
+
+// hasQuotas returns true if a user has a limit of running tasks
+func (config *ManagerConfig) hasQuotas() bool {
+	if config.DefaultQuota.MaxRunning > 0 {
+		return true
+	}
+	for _, user := range config.Users {
+		if user.MaxRunning > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// User roles
+const (
+	RoleAdmin     = "admin"     // all the tasks and the workers
+	RoleSubmitter = "submitter" // adds and manages their own tasks
+	RoleReadOnly  = "read-only" // only reads their own tasks
+)
+
+// UnmarshalJSON accepts the token as a string for the admins
+func (u *User) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*u = User{Role: RoleAdmin}
+		return json.Unmarshal(data, &u.Token)
+	}
+	type user User // without the UnmarshalJSON method
+	return json.Unmarshal(data, (*user)(u))
 }
 
 // ManagerSSHConfig manager SSH config struct
@@ -59,11 +160,50 @@ type Status struct {
 
 // StatusTask task status struct
 type StatusTask struct {
-	Pending int `json:"pending"`
-	Running int `json:"running"`
-	Done    int `json:"done"`
-	Failed  int `json:"failed"`
-	Deleted int `json:"deleted"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Done      int `json:"done"`
+	Failed    int `json:"failed"`
+	Deleted   int `json:"deleted"`
+	Skipped   int `json:"skipped"`
+	Cancelled int `json:"cancelled"`
+}
+
+// StatusQueue tasks of a queue
+type StatusQueue struct {
+	Name       string   `json:"name"`
+	Pending    int      `json:"pending"`
+	Running    int      `json:"running"`
+	MaxRunning int      `json:"maxRunning"`
+	Users      []string `json:"users"`
+	Workers    []string `json:"workers"`
+}
+
+// StatusModule number of workers up with a module
+type StatusModule struct {
+	Name        string   `json:"name"`
+	Workers     int      `json:"workers"`
+	WorkerNames []string `json:"workerNames"`
+}
+
+// TaskGraph dependency graph of a task
+type TaskGraph struct {
+	ID    string          `json:"id"`
+	Nodes []TaskGraphNode `json:"nodes"`
+	Edges []TaskGraphEdge `json:"edges"`
+}
+
+// TaskGraphNode task in a dependency graph
+type TaskGraphNode struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// TaskGraphEdge dependency between two tasks, From must be done before To runs
+type TaskGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
 }
 
 // StatusWorker worker status struct
@@ -80,3 +220,6 @@ const UsernameKey contextKey = "username"
 
 // WorkerKey key to get worker in API
 const WorkerKey contextKey = "worker"
+
+// RoleKey key to get the role of the user in API
+const RoleKey contextKey = "role"
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// templateKeyRegex valid names of a template placeholder
+var templateKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ExpandTemplate returns a task for each value of the template, replacing
+// {{key}} in the name and in the args of the commands with the value
+func ExpandTemplate(template globalstructs.TaskTemplate) ([]globalstructs.Task, error) {
+	if !templateKeyRegex.MatchString(template.Key) {
+		return nil, fmt.Errorf("invalid key %q", template.Key)
+	}
+	placeholder := "{{" + template.Key + "}}"
+
+	found := false
+	for _, command := range template.Task.Commands {
+		if strings.Contains(command.Args, placeholder) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in the args of the commands", placeholder)
+	}
+
+	values, err := templateValues(template)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values")
+	}
+
+	tasks := make([]globalstructs.Task, 0, len(values))
+	for _, value := range values {
+		task := template.Task
+		task.Name = strings.ReplaceAll(task.Name, placeholder, value)
+		// Copy the commands so the tasks don't share them
+		task.Commands = make([]globalstructs.Command, len(template.Task.Commands))
+		for i, command := range template.Task.Commands {
+			command.Args = strings.ReplaceAll(command.Args, placeholder, value)
+			task.Commands[i] = command
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// templateValues returns the values of the template and the non empty lines of its file
+func templateValues(template globalstructs.TaskTemplate) ([]string, error) {
+	values := append([]string{}, template.Values...)
+	if template.ValuesFile == "" {
+		return values, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(template.ValuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid valuesFile: %s", err.Error())
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			values = append(values, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid valuesFile: %s", err.Error())
+	}
+	return values, nil
+}
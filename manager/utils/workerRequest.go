@@ -3,7 +3,6 @@ package utils
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -38,7 +37,7 @@ func SendMessage(conn *websocket.Conn, message []byte, verbose, debug bool, writ
 }
 
 // VerifyWorkersLoop checks and sets if the workers are UP infinitely.
-func VerifyWorkersLoop(db *sql.DB, config *ManagerConfig, verbose, debug bool, writeLock *sync.Mutex) {
+func VerifyWorkersLoop(db database.Store, config *ManagerConfig, verbose, debug bool, writeLock *sync.Mutex) {
 	ticker := time.NewTicker(time.Duration(config.StatusCheckSeconds) * time.Second)
 	defer ticker.Stop()
 	for range ticker.C {
@@ -47,26 +46,53 @@ func VerifyWorkersLoop(db *sql.DB, config *ManagerConfig, verbose, debug bool, w
 }
 
 // DeleteMaxTaskHistoryLoop Loop and Delete Database Entries if num tasks > config.MaxTaskHistory
-func DeleteMaxTaskHistoryLoop(db *sql.DB, config *ManagerConfig, verbose, debug bool) {
+func DeleteMaxTaskHistoryLoop(db database.Store, config *ManagerConfig, verbose, debug bool) {
 	maxEntries := config.MaxTaskHistory
 	tableName := "task"
 	if maxEntries > 0 {
 		for {
-			err := database.DeleteMaxEntriesHistory(db, maxEntries, tableName, verbose, debug)
+			ids, err := db.DeleteMaxEntriesHistory(maxEntries, tableName, verbose, debug)
 			if err != nil && (verbose || debug) {
 				log.Println("Error DeleteMaxEntriesHistory:", err)
 			}
+			// The results of the tasks deleted, even if the rest failed
+			for _, id := range ids {
+				DeleteTaskResults(config, id, verbose, debug)
+			}
 			time.Sleep(1 * time.Hour)
 		}
 	}
 }
 
+// backfillTaskCommandsBatch tasks filled per transaction by BackfillTaskCommandsLoop
+const backfillTaskCommandsBatch = 500
+
+// BackfillTaskCommandsLoop fills the command filters of the tasks older than migration 10 in
+// small batches, so the database isn't locked by a single big rewrite
+func BackfillTaskCommandsLoop(db database.Store, verbose, debug bool) {
+	for {
+		done, err := db.BackfillTaskCommands(backfillTaskCommandsBatch, verbose, debug)
+		if err != nil {
+			log.Println("Utils Error BackfillTaskCommands:", err)
+			time.Sleep(1 * time.Minute)
+			continue
+		}
+		if done {
+			if verbose || debug {
+				log.Println("Utils BackfillTaskCommands done")
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // getWorkersThreads get DefaultThreads of all workers
-func getWorkersThreads(db *sql.DB, verbose, debug bool) int {
+func getWorkersThreads(db database.Store, verbose, debug bool) int {
 
 	workersThreads := 0
 	// Get all workers from the database
-	workers, err := database.GetWorkerUP(db, verbose, debug)
+	workers, err := db.GetWorkerUP(verbose, debug)
 	if err != nil {
 		log.Print("GetWorker", err)
 	}
@@ -84,9 +110,9 @@ func getWorkersThreads(db *sql.DB, verbose, debug bool) int {
 }
 
 // verifyWorkers checks and sets if the workers are UP.
-func verifyWorkers(db *sql.DB, config *ManagerConfig, verbose, debug bool, writeLock *sync.Mutex) {
+func verifyWorkers(db database.Store, config *ManagerConfig, verbose, debug bool, writeLock *sync.Mutex) {
 	// Get all workers from the database
-	workers, err := database.GetWorkers(db, verbose, debug)
+	workers, err := db.GetWorkers(verbose, debug)
 	if err != nil {
 		log.Print("GetWorker", err)
 	}
@@ -101,7 +127,7 @@ func verifyWorkers(db *sql.DB, config *ManagerConfig, verbose, debug bool, write
 }
 
 // verifyWorker checks and sets if the worker is UP.
-func verifyWorker(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker, verbose, debug bool, writeLock *sync.Mutex) error {
+func verifyWorker(db database.Store, config *ManagerConfig, worker *globalstructs.Worker, verbose, debug bool, writeLock *sync.Mutex) error {
 	if debug {
 		log.Println("Utils verifyWorker", worker.Name)
 	}
@@ -130,7 +156,7 @@ func verifyWorker(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worke
 // It tolerates “not found” from SetWorkerUPto in case the row was already deleted.
 func handleMissingWebSocket(
 	worker *globalstructs.Worker,
-	db *sql.DB,
+	db database.Store,
 	config *ManagerConfig,
 	verbose, debug bool,
 ) error {
@@ -142,7 +168,7 @@ func handleMissingWebSocket(
 	delete(config.WebSockets, worker.Name)
 
 	// Mark as down
-	if err := database.SetWorkerUPto(db, worker.Name, false, verbose, debug); err != nil {
+	if err := db.SetWorkerUPto(worker.Name, false, verbose, debug); err != nil {
 		// ignore “not found” since it may have been removed already
 		if !strings.Contains(err.Error(), "not found") {
 			return err
@@ -153,20 +179,23 @@ func handleMissingWebSocket(
 	}
 
 	// Increment down-count
-	downCount, err := database.GetWorkerDownCount(db, worker.Name, verbose, debug)
+	downCount, err := db.GetWorkerDownCount(worker.Name, verbose, debug)
 	if err != nil {
 		return err
 	}
-	if err := database.AddWorkerDownCount(db, worker.Name, verbose, debug); err != nil {
+	if err := db.AddWorkerDownCount(worker.Name, verbose, debug); err != nil {
 		return err
 	}
 
 	// If exceeded retries, orphan tasks and delete the worker
 	if downCount+1 >= config.StatusCheckDown {
-		if err := database.SetTasksWorkerPending(db, worker.Name, verbose, debug); err != nil {
+		if err := deleteCancelledTasks(db, config, worker.Name, verbose, debug); err != nil {
+			return err
+		}
+		if err := db.SetTasksWorkerPending(worker.Name, verbose, debug); err != nil {
 			return err
 		}
-		if err := database.RmWorkerName(db, worker.Name, verbose, debug); err != nil {
+		if err := db.RmWorkerName(worker.Name, verbose, debug); err != nil {
 			return err
 		}
 	}
@@ -175,13 +204,13 @@ func handleMissingWebSocket(
 }
 
 // sendAddTask sends a request to a worker to add a task.
-func sendAddTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
+func sendAddTask(db database.Store, config *ManagerConfig, worker *globalstructs.Worker, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
 	if debug {
 		log.Println("Utils sendAddTask")
 	}
 
 	// Subtract Iddle thread in DB, in the next status to worker it will update to real data
-	err := database.SubtractWorkerIddleThreads1(db, worker.Name, verbose, debug)
+	err := db.SubtractWorkerIddleThreads1(worker.Name, verbose, debug)
 	if err != nil {
 		return err
 	}
@@ -194,6 +223,14 @@ func sendAddTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker
 	// Set workerName in DB and in object
 	task.WorkerName = worker.Name
 
+	// Remove the output streamed by a previous attempt
+	if task.Retries > 0 {
+		err = db.DeleteTaskOutputs(task.ID, verbose, debug)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Tast to json
 	// Convert the struct to JSON
 	jsonDataTask, err := json.Marshal(task)
@@ -223,13 +260,13 @@ func sendAddTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker
 	task.WorkerName = worker.Name
 
 	// Set task as running
-	err = database.UpdateTask(db, *task, verbose, debug)
+	err = db.UpdateTask(*task, verbose, debug)
 	if err != nil {
 		return fmt.Errorf("Utils Error SetTaskStatus in request: %s", err)
 	}
 
 	// Set task as executed
-	err = database.SetTaskExecutedAtNow(db, task.ID, verbose, debug)
+	err = db.SetTaskExecutedAtNow(task.ID, verbose, debug)
 	if err != nil {
 		return fmt.Errorf("Error SetTaskExecutedAt in request: %s", err)
 	}
@@ -241,8 +278,9 @@ func sendAddTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker
 	return nil
 }
 
-// SendDeleteTask sends a request to a worker to stop and delete a task.
-func SendDeleteTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Worker, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
+// SendDeleteTask sends a request to a worker to stop a task, the task stays running until
+// the worker sends it back
+func SendDeleteTask(db database.Store, config *ManagerConfig, worker *globalstructs.Worker, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
 	conn := config.WebSockets[worker.Name]
 	if conn == nil {
 		return fmt.Errorf("Error, websocket not found")
@@ -273,12 +311,6 @@ func SendDeleteTask(db *sql.DB, config *ManagerConfig, worker *globalstructs.Wor
 		return err
 	}
 
-	// Set the task and worker as not working
-	err = database.SetTaskStatus(db, task.ID, "deleted", verbose, debug)
-	if err != nil {
-		return err
-	}
-
 	if verbose {
 		log.Println("Utils Delete Task send successfully")
 	}
@@ -357,7 +389,7 @@ func CreateTLSClientWithCACert(caCertPath string, verifyAltName, verbose, debug
 // It closes the socket, marks the worker down, and re-queues its tasks.
 // It tolerates “not found” from SetWorkerUPto.
 func WorkerDisconnected(
-	db *sql.DB,
+	db database.Store,
 	config *ManagerConfig,
 	worker *globalstructs.Worker,
 	verbose, debug bool,
@@ -373,7 +405,7 @@ func WorkerDisconnected(
 	delete(config.WebSockets, worker.Name)
 
 	// Mark as down
-	if err := database.SetWorkerUPto(db, worker.Name, false, verbose, debug); err != nil {
+	if err := db.SetWorkerUPto(worker.Name, false, verbose, debug); err != nil {
 		// ignore “not found” since it may have been removed already
 		if !strings.Contains(err.Error(), "not found") {
 			return err
@@ -383,10 +415,23 @@ func WorkerDisconnected(
 		}
 	}
 
-	// Re-queue any in-flight tasks
-	if err := database.SetTasksWorkerPending(db, worker.Name, verbose, debug); err != nil {
+	// Re-queue any in-flight tasks, except the ones deleted by the user
+	if err := deleteCancelledTasks(db, config, worker.Name, verbose, debug); err != nil {
+		return err
+	}
+	if err := db.SetTasksWorkerPending(worker.Name, verbose, debug); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// deleteCancelledTasks sets as deleted the running tasks of a worker that is gone
+// that the user deleted, skips their dependents and removes their results
+func deleteCancelledTasks(db database.Store, config *ManagerConfig, workerName string, verbose, debug bool) error {
+	ids, err := db.DeleteTasksWorkerCancelled(workerName, verbose, debug)
+	for _, id := range ids {
+		TaskDeleted(db, config, id, true, verbose, debug)
+	}
+	return err
+}
@@ -1,9 +1,10 @@
 package websockets
 
 import (
-	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,7 +15,7 @@ import (
 )
 
 // GetWorkerMessage processes worker messages with robust heartbeat and write synchronization.
-func GetWorkerMessage(conn *websocket.Conn, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool) {
+func GetWorkerMessage(conn *websocket.Conn, config *utils.ManagerConfig, db database.Store, verbose, debug bool, writeLock *sync.Mutex) {
 	var worker globalstructs.Worker
 	// configure timing and retries
 	const (
@@ -143,13 +144,13 @@ func GetWorkerMessage(conn *websocket.Conn, config *utils.ManagerConfig, db *sql
 			}
 			continue
 		}
-		handleMessage(msg, conn, config, db, &worker, verbose, debug)
+		handleMessage(msg, conn, config, db, &worker, verbose, debug, writeLock)
 	}
 }
 
 func handleConnectionError(
 	err error,
-	db *sql.DB,
+	db database.Store,
 	config *utils.ManagerConfig,
 	worker *globalstructs.Worker,
 	verbose, debug bool,
@@ -158,7 +159,7 @@ func handleConnectionError(
 		log.Println("WebSocket connection error:", err)
 	}
 	// only call WorkerDisconnected if worker has been initialized
-	if *worker != (globalstructs.Worker{}) {
+	if worker.Name != "" {
 		if err := utils.WorkerDisconnected(db, config, worker, verbose, debug); err != nil && debug {
 			log.Println("WorkerDisconnected error:", err)
 		}
@@ -178,16 +179,20 @@ func parseMessage(p []byte, debug bool) (globalstructs.WebsocketMessage, error)
 	return msg, nil
 }
 
-func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, config *utils.ManagerConfig, db *sql.DB, worker *globalstructs.Worker, verbose, debug bool) {
+func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool, writeLock *sync.Mutex) {
 	switch msg.Type {
 	case "addWorker":
 		handleAddWorker(msg, conn, config, db, worker, verbose, debug)
 	case "deleteWorker":
 		handleDeleteWorker(msg, config, db, worker, verbose, debug)
 	case "callbackTask":
-		handleCallbackTask(msg, config, db, verbose, debug)
+		handleCallbackTask(msg, config, db, worker, verbose, debug)
 	case "status":
 		handleWorkerStatus(msg, db, verbose, debug)
+	case "taskOutput":
+		handleTaskOutput(msg, db, worker, verbose, debug)
+	case "resultChunk":
+		handleResultChunk(msg, conn, config, db, worker, verbose, debug, writeLock)
 	case "OK;addTask":
 		if debug {
 			log.Println("Receive message OK;addTask from worker")
@@ -195,7 +200,7 @@ func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, con
 		// Set here as working?
 	case "OK;deleteTask":
 		if debug {
-			log.Println("Received OK;deleteTask — marking task as deleted")
+			log.Println("Received OK;deleteTask — the worker sends the task as cancelled when it stops")
 		}
 		/*var completedTask globalstructs.Task
 		if err := json.Unmarshal([]byte(msg.JSON), &completedTask); err != nil {
@@ -203,7 +208,7 @@ func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, con
 			break
 		}
 
-		if err := database.SetTaskStatus(db, completedTask.ID, "deleted", verbose, debug, wg); err != nil {
+		if err := db.SetTaskStatus(completedTask.ID, "deleted", verbose, debug, wg); err != nil {
 			log.Println("Error setting task status to deleted:", err)
 		}*/
 
@@ -216,7 +221,7 @@ func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, con
 			log.Println("Error unmarshaling FAILED;deleteTask JSON:", err)
 			break
 		}
-		log.Printf("Task %d could not be killed on worker %q", failedDelTask.ID, failedDelTask.WorkerName)
+		log.Printf("Task %s could not be killed on worker %q", failedDelTask.ID, failedDelTask.WorkerName)
 
 	case "FAILED;addTask":
 		if debug {
@@ -232,7 +237,18 @@ func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, con
 		// Wait to avoid updating the time at the same second
 		time.Sleep(1 * time.Second)
 
-		if err := database.SetTaskStatus(db, failedTask.ID, "pending", verbose, debug); err != nil {
+		// A task deleted by the user meanwhile is not sent again
+		if current, err := db.GetTask(failedTask.ID, verbose, debug); err == nil && current.CancelRequested {
+			deleted, err := db.SetTaskStatusIfStatus(failedTask.ID, "running", "deleted", verbose, debug)
+			if err != nil {
+				log.Println("Error setting task status to deleted:", err)
+			} else if deleted {
+				utils.TaskDeleted(db, config, failedTask.ID, current.Retries > 0, verbose, debug)
+			}
+			break
+		}
+
+		if err := db.SetTaskStatus(failedTask.ID, "pending", verbose, debug); err != nil {
 			log.Println("Error setting task status back to pending:", err)
 		}
 	default:
@@ -242,7 +258,7 @@ func handleMessage(msg globalstructs.WebsocketMessage, conn *websocket.Conn, con
 	}
 }
 
-func handleAddWorker(msg globalstructs.WebsocketMessage, conn *websocket.Conn, config *utils.ManagerConfig, db *sql.DB, worker *globalstructs.Worker, verbose, debug bool) {
+func handleAddWorker(msg globalstructs.WebsocketMessage, conn *websocket.Conn, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool) {
 	if err := handleWorkerMessage(msg, worker, db, verbose, debug, func() error {
 		config.WebSockets[worker.Name] = conn
 		return addWorker(*worker, db, verbose, debug)
@@ -251,15 +267,15 @@ func handleAddWorker(msg globalstructs.WebsocketMessage, conn *websocket.Conn, c
 	}
 }
 
-func handleDeleteWorker(msg globalstructs.WebsocketMessage, config *utils.ManagerConfig, db *sql.DB, worker *globalstructs.Worker, verbose, debug bool) {
+func handleDeleteWorker(msg globalstructs.WebsocketMessage, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool) {
 	if err := handleWorkerMessage(msg, worker, db, verbose, debug, func() error {
-		return database.RmWorkerName(db, worker.Name, verbose, debug)
+		return db.RmWorkerName(worker.Name, verbose, debug)
 	}); err != nil {
 		log.Println("Error handling deleteWorker:", err)
 	}
 }
 
-func handleWorkerMessage(msg globalstructs.WebsocketMessage, worker *globalstructs.Worker, db *sql.DB, verbose, debug bool, workerAction func() error) error {
+func handleWorkerMessage(msg globalstructs.WebsocketMessage, worker *globalstructs.Worker, db database.Store, verbose, debug bool, workerAction func() error) error {
 	if debug {
 		log.Println("Handling worker message")
 	}
@@ -275,7 +291,7 @@ func handleWorkerMessage(msg globalstructs.WebsocketMessage, worker *globalstruc
 	return nil
 }
 
-func handleCallbackTask(msg globalstructs.WebsocketMessage, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool) {
+func handleCallbackTask(msg globalstructs.WebsocketMessage, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool) {
 	if debug {
 		log.Println("Handling callbackTask message")
 	}
@@ -284,12 +300,57 @@ func handleCallbackTask(msg globalstructs.WebsocketMessage, config *utils.Manage
 		log.Println("Error unmarshaling callbackTask message:", err)
 		return
 	}
-	if err := callback(task, config, db, verbose, debug); err != nil {
+	if err := callback(task, config, db, worker, verbose, debug); err != nil {
 		log.Println("Error handling callback task:", err)
 	}
 }
 
-func handleWorkerStatus(msg globalstructs.WebsocketMessage, db *sql.DB, verbose, debug bool) {
+func handleTaskOutput(msg globalstructs.WebsocketMessage, db database.Store, worker *globalstructs.Worker, verbose, debug bool) {
+	var output globalstructs.TaskOutput
+	if err := json.Unmarshal([]byte(msg.JSON), &output); err != nil {
+		log.Println("Error unmarshaling taskOutput message:", err)
+		return
+	}
+	// A worker can only send the output of the tasks it runs
+	if err := db.AddTaskOutput(worker.Name, output, verbose, debug); err != nil {
+		log.Println("Error saving task output:", err)
+	}
+}
+
+func handleResultChunk(msg globalstructs.WebsocketMessage, conn *websocket.Conn, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool, writeLock *sync.Mutex) {
+	var chunk globalstructs.ResultChunk
+	if err := json.Unmarshal([]byte(msg.JSON), &chunk); err != nil {
+		log.Println("Error unmarshaling resultChunk message:", err)
+		return
+	}
+	if debug {
+		log.Printf("Result chunk %s offset %d (%d bytes)", chunk.Key(), chunk.Offset, len(chunk.Data))
+	}
+	// The worker waits for the answer of each chunk and sends the whole result again if it fails,
+	// so the callback only has the keys of the results saved
+	response := globalstructs.WebsocketMessage{Type: "OK;resultChunk"}
+	if err := saveResultChunk(chunk, config, db, worker, verbose, debug); err != nil {
+		log.Println("Error saving result chunk:", err)
+		response.Type = "FAILED;resultChunk"
+	}
+	chunk.Data = nil
+	chunkJSON, err := json.Marshal(chunk)
+	if err != nil {
+		log.Println("Error encoding resultChunk answer:", err)
+		return
+	}
+	response.JSON = string(chunkJSON)
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		log.Println("Error encoding resultChunk answer:", err)
+		return
+	}
+	if err := utils.SendMessage(conn, jsonData, verbose, debug, writeLock); err != nil {
+		log.Println("Error sending resultChunk answer:", err)
+	}
+}
+
+func handleWorkerStatus(msg globalstructs.WebsocketMessage, db database.Store, verbose, debug bool) {
 	if debug {
 		log.Println("Handling status message")
 	}
@@ -298,32 +359,37 @@ func handleWorkerStatus(msg globalstructs.WebsocketMessage, db *sql.DB, verbose,
 		log.Println("Error unmarshaling status message:", err)
 		return
 	}
-	worker, err := database.GetWorker(db, status.Name, verbose, debug)
+	worker, err := db.GetWorker(status.Name, verbose, debug)
 	if err != nil {
 		log.Println("Error retrieving worker from database:", err)
 		return
 	}
-	if err := database.SetWorkerUPto(db, worker.Name, true, verbose, debug); err != nil {
+	if err := db.SetWorkerUPto(worker.Name, true, verbose, debug); err != nil {
 		log.Println("Error setting worker status to UP:", err)
 	}
 
-	if err := database.SetWorkerDownCount(db, worker.Name, 0, verbose, debug); err != nil {
+	if err := db.SetWorkerDownCount(worker.Name, 0, verbose, debug); err != nil {
 		log.Println("Error setting worker status to UP:", err)
 	}
+	if status.Modules != nil && strings.Join(status.Modules, ",") != strings.Join(worker.Modules, ",") {
+		if err := db.SetWorkerModules(worker.Name, status.Modules, verbose, debug); err != nil {
+			log.Println("Error updating modules in database:", err)
+		}
+	}
 	if status.IddleThreads != worker.IddleThreads {
-		if err := database.SetIddleThreadsTo(db, worker.Name, status.IddleThreads, verbose, debug); err != nil {
+		if err := db.SetIddleThreadsTo(worker.Name, status.IddleThreads, verbose, debug); err != nil {
 			log.Println("Error updating idle threads in database:", err)
 		}
 	}
 }
 
-func addWorker(worker globalstructs.Worker, db *sql.DB, verbose, debug bool) error {
+func addWorker(worker globalstructs.Worker, db database.Store, verbose, debug bool) error {
 
 	if debug {
 		log.Println("WebSockets worker.Name", worker.Name)
 	}
 
-	err := database.AddWorker(db, &worker, verbose, debug)
+	err := db.AddWorker(&worker, verbose, debug)
 	if err != nil {
 		err = utils.HandleAddWorkerError(err, db, &worker, verbose, debug)
 		if err != nil {
@@ -334,32 +400,67 @@ func addWorker(worker globalstructs.Worker, db *sql.DB, verbose, debug bool) err
 	return nil
 }
 
-func callback(result globalstructs.Task, config *utils.ManagerConfig, db *sql.DB, verbose, debug bool) error {
+// callback saves the result of a task sent by the worker, only if the task is running on it
+// in the same attempt: a worker that reconnected can send the result of a task that was
+// set as pending and sent again meanwhile
+func callback(result globalstructs.Task, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool) error {
 
 	if debug {
 		log.Println("WebSockets result: ", result)
 		log.Println("WebSockets Received result (ID: ", result.ID, " from : ", result.WorkerName, " with command: ", result.Commands)
 	}
 
-	// Update task with the worker one
-	err := database.UpdateTask(db, result, verbose, debug)
+	if result.WorkerName != worker.Name {
+		return fmt.Errorf("task %s result of worker %s sent by worker %s", result.ID, result.WorkerName, worker.Name)
+	}
+
+	// Get the task before the update to know its retries and if the user deleted it
+	current, err := db.GetTask(result.ID, verbose, debug)
+	if err != nil {
+		return err
+	}
+
+	// Update the task with the worker one, with its attempt and artifacts
+	saved, err := db.SaveTaskResult(result, worker.Name, verbose, debug)
 	if err != nil {
 		if debug || verbose {
-			log.Println("WebSockets HandleCallback { \"error\" : \"Error UpdateTask: " + err.Error() + "\"}")
+			log.Println("WebSockets HandleCallback { \"error\" : \"Error SaveTaskResult: " + err.Error() + "\"}")
 		}
 
 		return err
 	}
+	if !saved {
+		return fmt.Errorf("task %s attempt %d is not running on worker %s", result.ID, result.Retries, worker.Name)
+	}
+
+	// A failed task is sent again if it has retries left (not if it was deleted by the user)
+	if result.Status == "failed" && !current.CancelRequested {
+		retried, err := utils.RetryTaskIfAllowed(db, current, verbose, debug)
+		if err != nil {
+			log.Println("WebSockets Error RetryTaskIfAllowed:", err)
+		}
+		if retried {
+			return nil
+		}
+	}
+
+	// The tasks waiting for this one will never run
+	if result.Status != "done" {
+		if err := utils.SkipDependentTasks(db, result.ID, verbose, debug); err != nil {
+			log.Println("WebSockets Error SkipDependentTasks:", err)
+		}
+	}
 
 	// if callbackURL is not empty send the request to the client
 	if result.CallbackURL != "" {
+		globalstructs.SetOutputs(result.Commands)
 		utils.CallbackUserTaskMessage(config, &result, verbose, debug)
 	}
 
 	// if path not empty
 	if config.DiskPath != "" {
 		//get the task from DB to get updated
-		task, err := database.GetTask(db, result.ID, verbose, debug)
+		task, err := db.GetTask(result.ID, verbose, debug)
 		if err != nil {
 			return err
 		}
@@ -371,3 +472,15 @@ func callback(result globalstructs.Task, config *utils.ManagerConfig, db *sql.DB
 
 	return nil
 }
+
+// saveResultChunk writes the chunk in the result store, only if its task is running on the worker
+func saveResultChunk(chunk globalstructs.ResultChunk, config *utils.ManagerConfig, db database.Store, worker *globalstructs.Worker, verbose, debug bool) error {
+	task, err := db.GetTask(chunk.ID, verbose, debug)
+	if err != nil {
+		return err
+	}
+	if task.Status != "running" || task.WorkerName != worker.Name || task.Retries != chunk.Attempt {
+		return fmt.Errorf("task %s attempt %d is not running on worker %s", chunk.ID, chunk.Attempt, worker.Name)
+	}
+	return config.Results.WriteChunk(chunk)
+}
@@ -0,0 +1,140 @@
+package websockets
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/manager/database"
+	"github.com/r4ulcl/nTask/manager/resultstore"
+	"github.com/r4ulcl/nTask/manager/utils"
+)
+
+// openTestDB returns an empty SQLite database with every migration applied
+func openTestDB(t *testing.T) database.Store {
+	t.Helper()
+	db, err := database.ConnectDB("sqlite", "", "", "", "", filepath.Join(t.TempDir(), "ntask.db"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err = db.Migrate(false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSaveResultChunk(t *testing.T) {
+	db := openTestDB(t)
+	results, err := resultstore.New(resultstore.Config{Path: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &utils.ManagerConfig{Results: results}
+
+	task := globalstructs.Task{ID: "task", Status: "running", WorkerName: "worker1", Username: "user",
+		Queue: utils.DefaultQueue, Files: []globalstructs.File{}}
+	if err = db.AddTask(task, 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := globalstructs.ResultChunk{ID: "task", Data: []byte("output"), Last: true}
+	tests := []struct {
+		name    string
+		worker  string
+		attempt int
+		ok      bool
+	}{
+		{"running worker", "worker1", 0, true},
+		{"another worker", "worker2", 0, false},
+		{"another attempt", "worker1", 1, false},
+	}
+	for _, tt := range tests {
+		chunk.Attempt = tt.attempt
+		err := saveResultChunk(chunk, config, db, &globalstructs.Worker{Name: tt.worker}, false, false)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: saveResultChunk = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	// the task isn't running anymore
+	if err = db.SetTaskStatus("task", "done", false, false); err != nil {
+		t.Fatal(err)
+	}
+	chunk.Attempt = 0
+	if err = saveResultChunk(chunk, config, db, &globalstructs.Worker{Name: "worker1"}, false, false); err == nil {
+		t.Error("saveResultChunk of a finished task returned no error")
+	}
+}
+
+func TestCallbackCancelRequested(t *testing.T) {
+	db := openTestDB(t)
+	config := &utils.ManagerConfig{}
+
+	task := globalstructs.Task{ID: "task", Status: "running", WorkerName: "worker1", Username: "user",
+		Queue: utils.DefaultQueue, MaxRetries: 3, Files: []globalstructs.File{}}
+	if err := db.AddTask(task, 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.SetTaskCancelRequested("task", "worker1", false, false); err != nil || !ok {
+		t.Fatalf("SetTaskCancelRequested = %v, %v", ok, err)
+	}
+
+	// the task failed before the worker stopped it, it isn't retried
+	task.Status = "failed"
+	if err := callback(task, config, db, &globalstructs.Worker{Name: "worker1"}, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if task, err := db.GetTask("task", false, false); err != nil || task.Status != "failed" || task.Retries != 0 {
+		t.Errorf("failed task deleted by the user: status %s, retries %d, %v, want failed without retries", task.Status, task.Retries, err)
+	}
+}
+
+func TestCallbackCurrentAttempt(t *testing.T) {
+	db := openTestDB(t)
+	config := &utils.ManagerConfig{}
+
+	// the task failed on worker1 and was sent again to worker2 in its second attempt
+	task := globalstructs.Task{ID: "task", Status: "running", WorkerName: "worker1", Username: "user",
+		Queue: utils.DefaultQueue, Files: []globalstructs.File{}}
+	if err := db.AddTask(task, 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RetryTask("task", 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	task.WorkerName, task.Retries = "worker2", 1
+	if err := db.UpdateTask(task, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		worker  string
+		sender  string
+		retries int
+	}{
+		{"late result of another worker", "worker1", "worker1", 1},
+		{"another worker name in the result", "worker1", "worker2", 1},
+		{"result of a previous attempt", "worker2", "worker2", 0},
+	}
+	for _, tt := range tests {
+		result := task
+		result.Status, result.WorkerName, result.Retries = "done", tt.worker, tt.retries
+		if err := callback(result, config, db, &globalstructs.Worker{Name: tt.sender}, false, false); err == nil {
+			t.Errorf("%s: callback returned no error", tt.name)
+		}
+	}
+	if current, err := db.GetTaskWithAttempts("task", false, false); err != nil || current.Status != "running" || len(current.Attempts) != 0 {
+		t.Errorf("task after rejected callbacks: status %s, %d attempts, %v, want running without attempts", current.Status, len(current.Attempts), err)
+	}
+
+	result := task
+	result.Status = "done"
+	if err := callback(result, config, db, &globalstructs.Worker{Name: "worker2"}, false, false); err != nil {
+		t.Fatalf("callback of the running worker: %v", err)
+	}
+	if current, err := db.GetTask("task", false, false); err != nil || current.Status != "done" {
+		t.Errorf("task after the callback: status %s, %v, want done", current.Status, err)
+	}
+}
@@ -114,6 +114,8 @@ func AddWorker(config *utils.WorkerConfig, verbose, debug bool, writeLock *sync.
 		IddleThreads:   config.DefaultThreads,
 		UP:             true,
 		DownCount:      0,
+		Labels:         config.Labels,
+		Modules:        utils.ModuleNames(config),
 	}
 
 	return sendWebSocketMessage(config, "addWorker", worker, verbose, debug, writeLock)
@@ -135,3 +137,8 @@ func DeleteWorker(config *utils.WorkerConfig, verbose, debug bool, writeLock *sy
 func CallbackTaskMessage(config *utils.WorkerConfig, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
 	return sendWebSocketMessage(config, "callbackTask", task, verbose, debug, writeLock)
 }
+
+// TaskOutputMessage sends a chunk of the output of a running task to the manager
+func TaskOutputMessage(config *utils.WorkerConfig, output *globalstructs.TaskOutput, verbose, debug bool, writeLock *sync.Mutex) error {
+	return sendWebSocketMessage(config, "taskOutput", output, verbose, debug, writeLock)
+}
@@ -0,0 +1,203 @@
+package managerrequest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+// resultChunkSize size of the chunks of the big outputs, in base64 they are far below globalstructs.MaxMessageSize
+const resultChunkSize = 512 << 10 // 512 KiB
+
+// resultAckTimeout time to wait for the manager to save a chunk, then the result is uploaded again
+const resultAckTimeout = time.Minute
+
+// OutputUploadFailed error of the commands whose output couldn't be saved in the result store
+const OutputUploadFailed = "output upload failed"
+
+// resultAcks chunks waiting for the answer of the manager, by resultAckKey
+var (
+	resultAcksMu sync.Mutex
+	resultAcks   = map[string]chan bool{}
+)
+
+// TakeLargeOutputs removes from the task the outputs bigger than the outputThreshold of the config,
+// and then the largest ones until the callbackTask message fits in globalstructs.MaxMessageSize,
+// and returns them by command, the commands keep the key of the output in the result store.
+// The stdout and stderr of these commands are only in the output stream of the task
+func TakeLargeOutputs(config *utils.WorkerConfig, task *globalstructs.Task) map[int]string {
+	outputs := make(map[int]string)
+	for i := range task.Commands {
+		if len(task.Commands[i].CombinedOutput()) > config.OutputThreshold {
+			takeOutput(task, i, outputs)
+		}
+	}
+
+	for {
+		size, err := callbackSize(task)
+		if err != nil {
+			log.Println("ManagerRequest Error encoding the result:", err)
+			return outputs
+		}
+		if size <= globalstructs.MaxMessageSize {
+			return outputs
+		}
+		// the command with the largest output left in the message
+		largest, largestSize := -1, 0
+		for i, command := range task.Commands {
+			if commandSize := len(command.Stdout) + len(command.Stderr); command.OutputKey == "" && commandSize > largestSize {
+				largest, largestSize = i, commandSize
+			}
+		}
+		if largest < 0 {
+			log.Printf("ManagerRequest the result of task %s is %d bytes without outputs, bigger than the max message", task.ID, size)
+			return outputs
+		}
+		takeOutput(task, largest, outputs)
+	}
+}
+
+// takeOutput moves the output of a command of the task to outputs
+func takeOutput(task *globalstructs.Task, i int, outputs map[int]string) {
+	command := &task.Commands[i]
+	outputs[i] = command.CombinedOutput()
+	command.OutputKey = globalstructs.ResultKey(task.ID, task.Retries, i)
+	command.OutputSize = int64(len(outputs[i]))
+	command.Stdout, command.Stderr = "", ""
+}
+
+// DropOutputs removes the keys of the outputs that couldn't be uploaded from the commands of the task,
+// their error says that the output is lost
+func DropOutputs(task *globalstructs.Task, outputs map[int]string) {
+	for i := range outputs {
+		command := &task.Commands[i]
+		command.OutputKey = ""
+		command.OutputSize = 0
+		if command.Error != "" {
+			command.Error += "; "
+		}
+		command.Error += OutputUploadFailed
+	}
+}
+
+// callbackSize returns the size of the callbackTask message of the task
+func callbackSize(task *globalstructs.Task) (int, error) {
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		return 0, err
+	}
+	msg, err := json.Marshal(globalstructs.WebsocketMessage{Type: "callbackTask", JSON: string(taskJSON)})
+	return len(msg), err
+}
+
+// UploadOutputs sends the outputs to the result store of the manager in resultChunk messages,
+// each output is sent from the beginning so it can be called again if it fails
+func UploadOutputs(config *utils.WorkerConfig, task *globalstructs.Task, outputs map[int]string, verbose, debug bool, writeLock *sync.Mutex) error {
+	for command, output := range outputs {
+		chunk := globalstructs.ResultChunk{ID: task.ID, Attempt: task.Retries, Index: command}
+		if err := uploadResult(config, chunk, strings.NewReader(output), verbose, debug, writeLock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UploadArtifacts sends the files of the artifacts of the task to the result store of the manager,
+// a file that can't be read anymore is skipped
+func UploadArtifacts(config *utils.WorkerConfig, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) error {
+	for num, artifact := range task.ArtifactFiles {
+		file, err := os.Open(artifact.Path)
+		if err != nil {
+			log.Println("ManagerRequest Error opening artifact:", err)
+			continue
+		}
+		chunk := globalstructs.ResultChunk{ID: task.ID, Attempt: task.Retries, Index: num, Artifact: true}
+		err = uploadResult(config, chunk, io.LimitReader(file, artifact.Size), verbose, debug, writeLock)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadResult sends r in chunks of resultChunkSize starting at offset 0,
+// each chunk waits for the manager to save it
+func uploadResult(config *utils.WorkerConfig, chunk globalstructs.ResultChunk, r io.Reader, verbose, debug bool, writeLock *sync.Mutex) error {
+	buf := make([]byte, resultChunkSize)
+	for chunk.Offset = 0; !chunk.Last; chunk.Offset += int64(len(chunk.Data)) {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		chunk.Data = buf[:n]
+		chunk.Last = n < resultChunkSize
+		if err := sendResultChunk(config, chunk, verbose, debug, writeLock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendResultChunk sends a chunk and waits for the OK;resultChunk of the manager
+func sendResultChunk(config *utils.WorkerConfig, chunk globalstructs.ResultChunk, verbose, debug bool, writeLock *sync.Mutex) error {
+	key := resultAckKey(chunk)
+	ack := make(chan bool, 1)
+	resultAcksMu.Lock()
+	resultAcks[key] = ack
+	resultAcksMu.Unlock()
+	defer func() {
+		resultAcksMu.Lock()
+		delete(resultAcks, key)
+		resultAcksMu.Unlock()
+	}()
+
+	if err := sendWebSocketMessage(config, "resultChunk", chunk, verbose, debug, writeLock); err != nil {
+		return err
+	}
+	timeout := time.NewTimer(resultAckTimeout)
+	defer timeout.Stop()
+	select {
+	case ok := <-ack:
+		if !ok {
+			return fmt.Errorf("the manager couldn't save the chunk of %s at offset %d", chunk.Key(), chunk.Offset)
+		}
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("no answer of the manager to the chunk of %s at offset %d", chunk.Key(), chunk.Offset)
+	}
+}
+
+// ResultChunkAnswer passes the OK;resultChunk or FAILED;resultChunk message of the manager
+// to the upload waiting for it
+func ResultChunkAnswer(msg globalstructs.WebsocketMessage) error {
+	var chunk globalstructs.ResultChunk
+	if err := json.Unmarshal([]byte(msg.JSON), &chunk); err != nil {
+		return err
+	}
+	resultAcksMu.Lock()
+	ack, ok := resultAcks[resultAckKey(chunk)]
+	resultAcksMu.Unlock()
+	if ok {
+		select {
+		case ack <- msg.Type == "OK;resultChunk":
+		default:
+		}
+	}
+	return nil
+}
+
+// resultAckKey identifies a chunk in resultAcks
+func resultAckKey(chunk globalstructs.ResultChunk) string {
+	return chunk.Key() + "@" + strconv.FormatInt(chunk.Offset, 10)
+}
@@ -0,0 +1,108 @@
+package managerrequest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	globalstructs "github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+func TestTakeLargeOutputsThreshold(t *testing.T) {
+	config := &utils.WorkerConfig{OutputThreshold: 10}
+	task := &globalstructs.Task{ID: "task", Retries: 1, Commands: []globalstructs.Command{
+		{Stdout: "small"},
+		{Stdout: strings.Repeat("x", 6), Stderr: strings.Repeat("x", 4)},
+	}}
+
+	outputs := TakeLargeOutputs(config, task)
+	if len(outputs) != 1 || outputs[1] != strings.Repeat("x", 6)+"\n"+strings.Repeat("x", 4) {
+		t.Fatalf("outputs = %v, want the output of command 1", outputs)
+	}
+	if task.Commands[0].Stdout != "small" || task.Commands[0].OutputKey != "" {
+		t.Errorf("command 0 = %+v, want its output in the message", task.Commands[0])
+	}
+	command := task.Commands[1]
+	if command.Stdout != "" || command.Stderr != "" || command.OutputKey != globalstructs.ResultKey("task", 1, 1) || command.OutputSize != 11 {
+		t.Errorf("command 1 = %+v, want only the key of its output", command)
+	}
+}
+
+func TestTakeLargeOutputsMessageSize(t *testing.T) {
+	// every output is below the threshold but the message with all of them is too big
+	config := &utils.WorkerConfig{OutputThreshold: globalstructs.MaxMessageSize}
+	task := &globalstructs.Task{ID: "task"}
+	sizes := []int{100 << 10, 400 << 10, 300 << 10, 200 << 10, 10}
+	for _, size := range sizes {
+		output := strings.Repeat("\"", size) // escaped twice in the message
+		task.Commands = append(task.Commands, globalstructs.Command{Stdout: output})
+	}
+
+	outputs := TakeLargeOutputs(config, task)
+	size, err := callbackSize(task)
+	if err != nil || size > globalstructs.MaxMessageSize {
+		t.Fatalf("callbackTask message of %d bytes, %v, want at most %d", size, err, globalstructs.MaxMessageSize)
+	}
+	// only the largest outputs are moved
+	if len(outputs) == 0 || outputs[4] != "" || task.Commands[4].OutputKey != "" {
+		t.Errorf("outputs moved %d, command 4 %+v, want the largest ones moved", len(outputs), task.Commands[4])
+	}
+	if _, ok := outputs[1]; !ok {
+		t.Error("the largest output wasn't moved")
+	}
+	for i := range outputs {
+		if task.Commands[i].OutputKey == "" || task.Commands[i].Stdout != "" {
+			t.Errorf("command %d = %+v, want only the key of its output", i, task.Commands[i])
+		}
+	}
+}
+
+func TestResultChunkAnswer(t *testing.T) {
+	chunk := globalstructs.ResultChunk{ID: "task", Index: 2, Offset: 512}
+	ack := make(chan bool, 1)
+	resultAcks[resultAckKey(chunk)] = ack
+	defer delete(resultAcks, resultAckKey(chunk))
+
+	for _, tt := range []struct {
+		msgType string
+		want    bool
+	}{
+		{"OK;resultChunk", true},
+		{"FAILED;resultChunk", false},
+	} {
+		chunkJSON, _ := json.Marshal(chunk)
+		if err := ResultChunkAnswer(globalstructs.WebsocketMessage{Type: tt.msgType, JSON: string(chunkJSON)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-ack; got != tt.want {
+			t.Errorf("%s delivered %v, want %v", tt.msgType, got, tt.want)
+		}
+	}
+
+	// the answers of the chunks nobody waits for are ignored
+	other, _ := json.Marshal(globalstructs.ResultChunk{ID: "task", Index: 2, Offset: 0})
+	if err := ResultChunkAnswer(globalstructs.WebsocketMessage{Type: "OK;resultChunk", JSON: string(other)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 0 {
+		t.Error("the answer of another chunk was delivered")
+	}
+}
+
+func TestDropOutputs(t *testing.T) {
+	config := &utils.WorkerConfig{OutputThreshold: 1}
+	task := &globalstructs.Task{ID: "task", Commands: []globalstructs.Command{
+		{Stdout: "big output"},
+		{Stderr: "big output", Error: "limit exceeded: output bigger than 5 bytes"},
+		{},
+	}}
+
+	DropOutputs(task, TakeLargeOutputs(config, task))
+	for i, want := range []string{OutputUploadFailed, "limit exceeded: output bigger than 5 bytes; " + OutputUploadFailed, ""} {
+		command := task.Commands[i]
+		if command.Error != want || command.OutputKey != "" || command.OutputSize != 0 || command.CombinedOutput() != "" {
+			t.Errorf("command %d = %+v, want without output and error %q", i, command, want)
+		}
+	}
+}
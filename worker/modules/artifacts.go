@@ -0,0 +1,62 @@
+package modules
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+// maxArtifacts max files collected from the artifacts of a task
+const maxArtifacts = 100
+
+// CollectArtifacts returns the regular files matched by the artifacts glob paths of the task,
+// relative paths are inside the working directory of the task
+func CollectArtifacts(task *globalstructs.Task, config *utils.WorkerConfig, workDir string, verbose, debug bool) []globalstructs.Artifact {
+	var artifacts []globalstructs.Artifact
+	seen := make(map[string]bool)
+	for _, pattern := range task.Artifacts {
+		pattern, err := resolvePath(config, workDir, pattern)
+		if err != nil {
+			log.Println("Modules Error artifacts pattern:", err)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Println("Modules Error artifacts pattern:", pattern, err)
+			continue
+		}
+		if debug {
+			log.Println("Modules artifacts", pattern, matches)
+		}
+		for _, path := range matches {
+			// The commands can create symlinks to files outside the working directory
+			path, err = filepath.EvalSymlinks(path)
+			if err != nil || (!config.AllowOutsideWorkDir && !insideDir(workDir, path)) {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() || seen[path] {
+				continue
+			}
+			if len(artifacts) == maxArtifacts {
+				log.Printf("Modules task %s has more than %d artifacts, the rest are ignored", task.ID, maxArtifacts)
+				return artifacts
+			}
+			seen[path] = true
+			artifacts = append(artifacts, globalstructs.Artifact{
+				Num:     len(artifacts),
+				Attempt: task.Retries + 1,
+				Path:    path,
+				Key:     globalstructs.ArtifactKey(task.ID, task.Retries, len(artifacts)),
+				Size:    info.Size(),
+			})
+		}
+	}
+	if verbose && len(artifacts) > 0 {
+		log.Println("Modules collected", len(artifacts), "artifacts of task", task.ID)
+	}
+	return artifacts
+}
@@ -0,0 +1,91 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultCancelGrace time between SIGTERM and SIGKILL if the task doesn't set cancelGraceSeconds
+const defaultCancelGrace = 10 * time.Second
+
+// ErrTaskCancelled the task was stopped by a deleteTask message
+var ErrTaskCancelled = errors.New("task cancelled")
+
+// taskCancel cancel state of a task received by the worker
+type taskCancel struct {
+	cancel    context.CancelCauseFunc // cancels the commands of the task, nil while they aren't running
+	cancelled bool                    // a deleteTask was received, the commands are cancelled when they start
+}
+
+var (
+	cancelMutex sync.Mutex
+	cancelTasks = make(map[string]*taskCancel)
+)
+
+// RegisterTask saves that the worker received the task id, a deleteTask received
+// before its commands start cancels them when they do
+func RegisterTask(id string) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	cancelTasks[id] = &taskCancel{}
+}
+
+// UnregisterTask removes the task id when its commands end, a deleteTask
+// received after it fails
+func UnregisterTask(id string) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	delete(cancelTasks, id)
+}
+
+// TaskCancelled returns true if a deleteTask was received for the task id
+func TaskCancelled(id string) bool {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	task, ok := cancelTasks[id]
+	return ok && task.cancelled
+}
+
+// setCancelFunc saves the function that cancels the commands of the task id,
+// it's called at once if the task was already cancelled
+func setCancelFunc(id string, cancel context.CancelCauseFunc) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	task, ok := cancelTasks[id]
+	if !ok {
+		task = &taskCancel{}
+		cancelTasks[id] = task
+	}
+	task.cancel = cancel
+	if task.cancelled && cancel != nil {
+		cancel(ErrTaskCancelled)
+	}
+}
+
+// CancelTask stops the task id, the running command gets SIGTERM and its
+// process group SIGKILL after the grace period of the task. If its commands
+// haven't started yet they are cancelled when they start
+func CancelTask(id string) error {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	task, ok := cancelTasks[id]
+	if !ok {
+		return fmt.Errorf("task %s is not running", id)
+	}
+	task.cancelled = true
+	if task.cancel != nil {
+		task.cancel(ErrTaskCancelled)
+	}
+	return nil
+}
+
+// cancelGrace returns the grace period of a task
+func cancelGrace(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultCancelGrace
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,35 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCancelTaskBeforeCommands(t *testing.T) {
+	if err := CancelTask("unknown"); err == nil {
+		t.Error("CancelTask of a task not received returned no error")
+	}
+
+	// the deleteTask arrives while the files of the task are written
+	RegisterTask("task")
+	defer UnregisterTask("task")
+	if err := CancelTask("task"); err != nil {
+		t.Fatalf("CancelTask = %v", err)
+	}
+	if !TaskCancelled("task") {
+		t.Error("TaskCancelled = false after CancelTask")
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	setCancelFunc("task", cancel)
+	if !errors.Is(context.Cause(ctx), ErrTaskCancelled) {
+		t.Errorf("commands of a cancelled task not cancelled: cause %v", context.Cause(ctx))
+	}
+
+	UnregisterTask("task")
+	if err := CancelTask("task"); err == nil {
+		t.Error("CancelTask of a finished task returned no error")
+	}
+}
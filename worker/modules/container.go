@@ -0,0 +1,92 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+const (
+	// containerWorkDir path of the working directory of the task inside the container
+	containerWorkDir = "/ntask"
+	// containerRemoveTimeout max time to remove a container of a cancelled task
+	containerRemoveTimeout = 30 * time.Second
+)
+
+// containerName name of the container of a command of a task
+func containerName(id string, num int) string {
+	return "ntask-" + id + "-" + strconv.Itoa(num)
+}
+
+// createContainerCommand returns the command of the runtime that runs the module in a new container
+// with the working directory of the task mounted, the container is removed when it ends
+func createContainerCommand(ctx context.Context, module utils.Module, arguments string, results commandResults, limits globalstructs.Limits, workDir, name string, debug bool) *exec.Cmd {
+	container := module.Container
+	args := []string{
+		"run", "--rm", "--interactive",
+		"--name", name,
+		"--network", container.Network,
+		"--security-opt", "no-new-privileges",
+		"--volume", workDir + ":" + containerWorkDir,
+		"--workdir", containerWorkDir,
+		"--env", WorkDirEnv + "=" + containerWorkDir,
+	}
+	if limits.MemoryMB > 0 {
+		args = append(args, "--memory", strconv.Itoa(limits.MemoryMB)+"m", "--memory-swap", strconv.Itoa(limits.MemoryMB)+"m")
+	} else if container.Memory != "" {
+		args = append(args, "--memory", container.Memory)
+	}
+	if limits.CPUSeconds > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", limits.CPUSeconds, limits.CPUSeconds))
+	}
+	if limits.OpenFiles > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("nofile=%d:%d", limits.OpenFiles, limits.OpenFiles))
+	}
+	if container.CPUs != "" {
+		args = append(args, "--cpus", container.CPUs)
+	}
+	if container.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(container.PidsLimit))
+	}
+	if container.User != "" {
+		args = append(args, "--user", container.User)
+	}
+	args = append(args, container.ExtraArgs...)
+	args = append(args, container.Image)
+
+	// The command runs inside the container, with a shell only if the module allows it
+	commandLine := strings.TrimSpace(module.Exec + " " + arguments)
+	if container.Shell {
+		args = append(args, "sh", "-c", results.expand(commandLine, true))
+	} else {
+		for _, field := range strings.Fields(commandLine) {
+			args = append(args, results.expand(field, false))
+		}
+	}
+
+	if debug {
+		log.Println("Modules container:", container.Runtime, args)
+	}
+	return exec.CommandContext(ctx, container.Runtime, args...)
+}
+
+// removeContainer removes the container of a command if the task was cancelled, timed out or
+// exceeded a limit, the signal sent to the runtime client doesn't always stop it
+func removeContainer(ctx context.Context, container *utils.Container, name string, stopped, verbose, debug bool) {
+	if ctx.Err() == nil && !stopped {
+		return
+	}
+	rmCtx, cancel := context.WithTimeout(context.Background(), containerRemoveTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(rmCtx, container.Runtime, "rm", "--force", name).CombinedOutput()
+	if err != nil && (verbose || debug) {
+		log.Println("Modules Error removing container", name, fmt.Sprintf("%v: %s", err, output))
+	}
+}
@@ -0,0 +1,111 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// ErrLimitExceeded a command was stopped because it used more resources than the limits of the task
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// effectiveLimits returns the limits of the task, capped by the limits of the module
+func effectiveLimits(task, module globalstructs.Limits) globalstructs.Limits {
+	return globalstructs.Limits{
+		MemoryMB:    int(minLimit(int64(task.MemoryMB), int64(module.MemoryMB))),
+		CPUSeconds:  int(minLimit(int64(task.CPUSeconds), int64(module.CPUSeconds))),
+		OutputBytes: minLimit(task.OutputBytes, module.OutputBytes),
+		OpenFiles:   int(minLimit(int64(task.OpenFiles), int64(module.OpenFiles))),
+	}
+}
+
+// minLimit returns the lowest limit, 0 is no limit
+func minLimit(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// commandLimits enforces the limits of a command, the memory, CPU and open files
+// limits are applied by the platform in prepare and started
+type commandLimits struct {
+	limits globalstructs.Limits
+	name   string // unique name of the command, used for its cgroup
+
+	// cgroup of the command in Linux
+	cgroupDir  string
+	cgroupFile *os.File
+
+	mu       sync.Mutex
+	output   int64
+	exceeded string // reason of the first limit exceeded
+}
+
+func newCommandLimits(limits globalstructs.Limits, name string) *commandLimits {
+	return &commandLimits{limits: limits, name: name}
+}
+
+// setExceeded saves the reason of the first limit exceeded
+func (l *commandLimits) setExceeded(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exceeded == "" {
+		l.exceeded = reason
+	}
+}
+
+// err returns the ErrLimitExceeded error with the reason, nil if no limit was exceeded
+func (l *commandLimits) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exceeded == "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrLimitExceeded, l.exceeded)
+}
+
+// outputWriter returns w limited to the outputBytes shared by stdout and stderr,
+// kill is called once when the command writes more
+func (l *commandLimits) outputWriter(w io.Writer, kill func()) io.Writer {
+	if l.limits.OutputBytes <= 0 {
+		return w
+	}
+	return &limitWriter{limits: l, w: w, kill: kill}
+}
+
+type limitWriter struct {
+	limits *commandLimits
+	w      io.Writer
+	kill   func()
+}
+
+// Write discards the output after the limit, the command is killed but
+// it must not fail on write before that
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	l := lw.limits
+	l.mu.Lock()
+	allowed := l.limits.OutputBytes - l.output
+	l.output += int64(len(p))
+	l.mu.Unlock()
+
+	if allowed <= 0 {
+		return len(p), nil
+	}
+	if int64(len(p)) > allowed {
+		if _, err := lw.w.Write(p[:allowed]); err != nil {
+			return 0, err
+		}
+		l.setExceeded(fmt.Sprintf("output bigger than %d bytes", l.limits.OutputBytes))
+		lw.kill()
+		return len(p), nil
+	}
+	if _, err := lw.w.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+// ulimitScript sets the limits of the shell and replaces it with the command,
+// so the limits are inherited before the command starts
+const ulimitScript = `%s; exec "$@"`
+
+// prepare applies the limits to a command on the host before it starts, the memory with a
+// cgroup if the worker has cgroupPath and the CPU time and open files with ulimit.
+// It must be called after setProcessGroup
+func (l *commandLimits) prepare(cmd *exec.Cmd, config *utils.WorkerConfig, verbose, debug bool) error {
+	var ulimits []string
+	if l.limits.MemoryMB > 0 {
+		if config.CgroupPath != "" {
+			if err := l.createCgroup(cmd, config.CgroupPath); err != nil {
+				return fmt.Errorf("cgroup: %w", err)
+			}
+		} else {
+			// Without cgroup the memory is the max virtual memory of each process
+			ulimits = append(ulimits, "ulimit -v "+strconv.Itoa(l.limits.MemoryMB*1024))
+		}
+	}
+	if l.limits.CPUSeconds > 0 {
+		ulimits = append(ulimits, "ulimit -t "+strconv.Itoa(l.limits.CPUSeconds))
+	}
+	if l.limits.OpenFiles > 0 {
+		ulimits = append(ulimits, "ulimit -n "+strconv.Itoa(l.limits.OpenFiles))
+	}
+	if len(ulimits) == 0 {
+		return nil
+	}
+
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+	args := []string{"sh", "-c", fmt.Sprintf(ulimitScript, strings.Join(ulimits, " && ")), "sh", cmd.Path}
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = shell
+	if debug {
+		log.Println("Modules limits:", cmd.Args)
+	}
+	return nil
+}
+
+// createCgroup creates the cgroup of the command with its max memory, the
+// command starts inside it
+func (l *commandLimits) createCgroup(cmd *exec.Cmd, cgroupPath string) error {
+	// The controller must be enabled for the children of the cgroup of the worker
+	err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.subtree_control"), []byte("+memory"), 0)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(cgroupPath, l.name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	l.cgroupDir = dir
+
+	memory := strconv.FormatInt(int64(l.limits.MemoryMB)*1024*1024, 10)
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(memory), 0); err != nil {
+		return err
+	}
+	// Without swap the command is killed when it reaches the limit, the file
+	// doesn't exist if the kernel has no swap support
+	err = os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	l.cgroupFile = file
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(file.Fd())
+	return nil
+}
+
+// finish saves the limit that stopped the command, if any, and returns the ErrLimitExceeded error
+func (l *commandLimits) finish(state *os.ProcessState) error {
+	if l.cgroupDir != "" && l.oomKilled() {
+		l.setExceeded(fmt.Sprintf("memory bigger than %d MB", l.limits.MemoryMB))
+	}
+	if state != nil && l.limits.CPUSeconds > 0 {
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			cpu := state.UserTime() + state.SystemTime()
+			// SIGXCPU at the soft limit, SIGKILL at the hard limit
+			if ws.Signal() == syscall.SIGXCPU || (ws.Signal() == syscall.SIGKILL && cpu >= time.Duration(l.limits.CPUSeconds)*time.Second) {
+				l.setExceeded(fmt.Sprintf("CPU time bigger than %d seconds", l.limits.CPUSeconds))
+			}
+		}
+	}
+	return l.err()
+}
+
+// oomKilled returns true if a process of the cgroup was killed for using more memory than memory.max
+func (l *commandLimits) oomKilled() bool {
+	file, err := os.Open(filepath.Join(l.cgroupDir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return fields[1] != "0"
+		}
+	}
+	return false
+}
+
+// cleanup kills the processes left in the cgroup of the command and removes it
+func (l *commandLimits) cleanup(verbose, debug bool) {
+	if l.cgroupFile != nil {
+		l.cgroupFile.Close()
+	}
+	if l.cgroupDir == "" {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(l.cgroupDir, "cgroup.kill"), []byte("1"), 0)
+
+	// The cgroup can be removed once the killed processes are gone
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = syscall.Rmdir(l.cgroupDir); err == nil || err == syscall.ENOENT {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if verbose || debug {
+		log.Println("Modules Error removing cgroup", l.cgroupDir, err)
+	}
+}
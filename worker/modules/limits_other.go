@@ -0,0 +1,27 @@
+//go:build !linux
+
+package modules
+
+import (
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+// prepare only the output limit is supported outside Linux
+func (l *commandLimits) prepare(cmd *exec.Cmd, config *utils.WorkerConfig, verbose, debug bool) error {
+	if (l.limits.MemoryMB > 0 || l.limits.CPUSeconds > 0 || l.limits.OpenFiles > 0) && (verbose || debug) {
+		log.Println("Modules the memory, CPU and open files limits are only supported in Linux")
+	}
+	return nil
+}
+
+// finish returns the ErrLimitExceeded error if the command was stopped by the output limit
+func (l *commandLimits) finish(state *os.ProcessState) error {
+	return l.err()
+}
+
+// cleanup nothing to remove outside Linux
+func (l *commandLimits) cleanup(verbose, debug bool) {}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -38,32 +40,86 @@ func deleteWorkingID(status *globalstructs.WorkerStatus, id string) {
 	delete(status.WorkingIDs, id)
 }
 
-func runModule(config *utils.WorkerConfig, command string, arguments string, status *globalstructs.WorkerStatus, id string, verbose, debug bool) (string, error) {
+// runModule runs a command of a task and returns its stdout, stderr and exit code, -1 if it didn't exit normally
+func runModule(ctx context.Context, config *utils.WorkerConfig, module utils.Module, arguments, stdin string, results commandResults, taskLimits globalstructs.Limits, status *globalstructs.WorkerStatus, id, workDir string, num int, grace time.Duration, verbose, debug bool, writeLock *sync.Mutex) (string, string, int, error) {
 	// mark as starting (-1)
 	setWorkingID(status, id, -1)
 	defer cleanupWorkerStatus(status, id)
 
-	cmd, err := prepareCommand(config, command, arguments, debug)
-	if err != nil {
-		return "", err
+	name := containerName(id, num)
+	limits := newCommandLimits(effectiveLimits(taskLimits, module.Limits), name)
+
+	var cmd *exec.Cmd
+	var err error
+	if module.Container != nil {
+		// The runtime applies the limits to the container
+		cmd = createContainerCommand(ctx, module, arguments, results, limits.limits, workDir, name, debug)
+		// The runtime client may be killed before the container stops
+		defer func() {
+			removeContainer(ctx, module.Container, name, limits.err() != nil, verbose, debug)
+		}()
+	} else {
+		cmd, err = prepareCommand(ctx, config, module.Exec, arguments, results, debug)
+		if err != nil {
+			return "", "", -1, err
+		}
 	}
 
-	output, err := executeCommand(cmd, status, id, verbose, debug)
-	return strings.TrimRight(output, "\n"), err
+	// Run the command in the working directory of the task
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), WorkDirEnv+"="+workDir)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	// When the task is cancelled or times out the process group gets SIGTERM,
+	// and SIGKILL if it is still running after the grace period
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return terminateProcessGroup(cmd.Process.Pid)
+	}
+	cmd.WaitDelay = grace
+
+	if module.Container == nil {
+		defer limits.cleanup(verbose, debug)
+		if err := limits.prepare(cmd, config, verbose, debug); err != nil {
+			return "", "", -1, err
+		}
+	}
+
+	// Send the output to the manager while the command runs
+	stdoutStreamer := newOutputStreamer(config, id, num, "stdout", verbose, debug, writeLock)
+	stderrStreamer := newOutputStreamer(config, id, num, "stderr", verbose, debug, writeLock)
+	stdout, stderr, err := executeCommand(ctx, cmd, status, id, stdoutStreamer, stderrStreamer, limits, verbose, debug)
+	stdoutStreamer.Close()
+	stderrStreamer.Close()
+
+	// A command stopped by a limit fails with the limit, not with the signal
+	if limitErr := limits.finish(cmd.ProcessState); limitErr != nil {
+		err = limitErr
+	}
+
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	return stdout, stderr, exitCode, err
 }
 
 func cleanupWorkerStatus(status *globalstructs.WorkerStatus, id string) {
 	deleteWorkingID(status, id)
 }
 
-func prepareCommand(config *utils.WorkerConfig, command, arguments string, debug bool) (*exec.Cmd, error) {
+// prepareCommand returns the command of a module on the host, the placeholders of the
+// results are quoted for the shell of the insecure modules and are a single argument in the secure ones
+func prepareCommand(ctx context.Context, config *utils.WorkerConfig, command, arguments string, results commandResults, debug bool) (*exec.Cmd, error) {
 	var cmd *exec.Cmd
 
 	if config.InsecureModules {
-		cmd = createInsecureCommand(command, arguments, debug)
+		cmd = createInsecureCommand(ctx, command, results.expand(arguments, true), debug)
 	} else {
 		var err error
-		cmd, err = createSecureCommand(command, arguments, debug)
+		cmd, err = createSecureCommand(ctx, command, arguments, results, debug)
 		if err != nil {
 			return nil, err
 		}
@@ -72,25 +128,28 @@ func prepareCommand(config *utils.WorkerConfig, command, arguments string, debug
 	return cmd, nil
 }
 
-func createInsecureCommand(command, arguments string, debug bool) *exec.Cmd {
+func createInsecureCommand(ctx context.Context, command, arguments string, debug bool) *exec.Cmd {
 	cmdStr := command + " " + arguments
 	if debug {
 		log.Println("Modules cmdStr: ", cmdStr)
 	}
 
 	if runtime.GOOS == "windows" {
-		return exec.Command("cmd", "/c", cmdStr)
+		return exec.CommandContext(ctx, "cmd", "/c", cmdStr)
 	} else if runtime.GOOS == "linux" {
 		// use --login to load bashrc
-		return exec.Command("bash", "--login", "-c", cmdStr)
+		return exec.CommandContext(ctx, "bash", "--login", "-c", cmdStr)
 	}
 
 	log.Fatal("Unsupported operating system")
 	return nil
 }
 
-func createSecureCommand(command, arguments string, debug bool) (*exec.Cmd, error) {
+func createSecureCommand(ctx context.Context, command, arguments string, results commandResults, debug bool) (*exec.Cmd, error) {
 	argumentsArray := strings.Split(arguments, " ")
+	for i, argument := range argumentsArray {
+		argumentsArray[i] = results.expand(argument, false)
+	}
 	if command == "" && len(arguments) > 0 {
 		command = argumentsArray[0]
 		argumentsArray = argumentsArray[1:]
@@ -107,25 +166,33 @@ func createSecureCommand(command, arguments string, debug bool) (*exec.Cmd, erro
 		log.Println("Modules argumentsArray: ", argumentsArray)
 	}
 
-	return exec.Command(command, argumentsArray...), nil
+	return exec.CommandContext(ctx, command, argumentsArray...), nil
 }
 
-func executeCommand(cmd *exec.Cmd, status *globalstructs.WorkerStatus, id string, verbose, debug bool) (string, error) {
+func executeCommand(ctx context.Context, cmd *exec.Cmd, status *globalstructs.WorkerStatus, id string, stdoutStream, stderrStream io.Writer, limits *commandLimits, verbose, debug bool) (string, string, error) {
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// The command is killed when stdout and stderr are bigger than the output limit
+	kill := func() { _ = killProcessGroup(cmd.Process.Pid) }
+	cmd.Stdout = limits.outputWriter(io.MultiWriter(&stdout, stdoutStream), kill)
+	cmd.Stderr = limits.outputWriter(io.MultiWriter(&stderr, stderrStream), kill)
 
 	if err := cmd.Start(); err != nil {
 		logCommandError(err, &stderr, verbose, debug)
-		return "", err
+		return "", "", err
 	}
 
 	// update with actual PID
-	setWorkingID(status, id, cmd.Process.Pid)
+	pid := cmd.Process.Pid
+	setWorkingID(status, id, pid)
 
 	done := make(chan error, 1)
 	go func() {
-		done <- cmd.Wait()
+		err := cmd.Wait()
+		// Kill the children that ignored SIGTERM and are still in the group
+		if ctx.Err() != nil {
+			_ = killProcessGroup(pid)
+		}
+		done <- err
 	}()
 
 	return monitorCommandExecution(cmd, &stdout, &stderr, done, verbose, debug)
@@ -145,7 +212,7 @@ func logCommandError(err error, stderr *bytes.Buffer, verbose, debug bool) {
 	}
 }
 
-func monitorCommandExecution(cmd *exec.Cmd, stdout, stderr *bytes.Buffer, done chan error, verbose, debug bool) (string, error) {
+func monitorCommandExecution(cmd *exec.Cmd, stdout, stderr *bytes.Buffer, done chan error, verbose, debug bool) (string, string, error) {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
@@ -153,13 +220,13 @@ func monitorCommandExecution(cmd *exec.Cmd, stdout, stderr *bytes.Buffer, done c
 		select {
 		case <-ticker.C:
 			if err := isProcessRunning(cmd.Process.Pid, verbose, debug); err != nil {
-				return stdout.String() + stderr.String(), err
+				return stdout.String(), stderr.String(), err
 			}
 		case err := <-done:
 			if err != nil && debug {
 				log.Println("Modules Error waiting for command:", err)
 			}
-			return stdout.String() + stderr.String(), err
+			return stdout.String(), stderr.String(), err
 		}
 	}
 }
@@ -185,14 +252,18 @@ func isProcessRunning(pid int, verbose, debug bool) error {
 	return nil
 }
 
-// ProcessFiles decodes the base64 content of each file in task.Files and saves it to its RemoteFilePath.
+// ProcessFiles decodes the base64 content of each file in task.Files and saves it to its RemoteFilePath,
+// relative paths are inside the working directory of the task.
 // It updates the WorkerStatus and handles verbose and debug logging as needed.
-func ProcessFiles(task *globalstructs.Task, config *utils.WorkerConfig, status *globalstructs.WorkerStatus, id string, verbose, debug bool) error {
+func ProcessFiles(task *globalstructs.Task, config *utils.WorkerConfig, status *globalstructs.WorkerStatus, id, workDir string, verbose, debug bool) error {
 	for num, file := range task.Files {
 		// Assuming 'fileContentB64B64' is the base64-encoded content as a string
 		// If this is a typo, rename it appropriately (e.g., 'FileContentB64')
 		contentB64 := file.FileContentB64
-		path := file.RemoteFilePath
+		path, err := resolvePath(config, workDir, file.RemoteFilePath)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", num+1, err)
+		}
 
 		// Decode the base64 content
 		decodedBytes, err := base64.StdEncoding.DecodeString(contentB64)
@@ -202,7 +273,7 @@ func ProcessFiles(task *globalstructs.Task, config *utils.WorkerConfig, status *
 
 		// Ensure the directory exists
 		dir := getDirectory(path)
-		const dirPerm = 0600 // Use restricted permissions (0600)
+		const dirPerm = 0700 // Use restricted permissions (0700)
 		if err := os.MkdirAll(dir, dirPerm); err != nil {
 			return fmt.Errorf("file %d: failed to create directories for %s: %w", num+1, path, err)
 		}
@@ -230,13 +301,16 @@ func ProcessFiles(task *globalstructs.Task, config *utils.WorkerConfig, status *
 	return nil
 }
 
-// DeleteFiles delete files send
-func DeleteFiles(task *globalstructs.Task, verbose, debug bool) error {
+// DeleteFiles delete files send, the ones inside the working directory are removed with it
+func DeleteFiles(task *globalstructs.Task, config *utils.WorkerConfig, workDir string, verbose, debug bool) error {
 	for num, file := range task.Files {
-		path := file.RemoteFilePath
+		path, err := resolvePath(config, workDir, file.RemoteFilePath)
+		if err != nil {
+			continue
+		}
 
 		// Attempt to delete the file
-		err := os.Remove(path)
+		err = os.Remove(path)
 		if err != nil {
 			fmt.Printf("Error deleting file: %v\n", err)
 		}
@@ -260,17 +334,21 @@ func getDirectory(filePath string) string {
 	return filepath.Dir(filePath)
 }
 
-// ProcessModule processes a task by iterating through its commands and executing corresponding modules
-func ProcessModule(task *globalstructs.Task, config *utils.WorkerConfig, status *globalstructs.WorkerStatus, id string, verbose, debug bool) error {
-	// Define a context with timeout for the entire task
-	var ctx context.Context
-	var cancel context.CancelFunc
+// ProcessModule processes a task by iterating through its commands and executing corresponding modules.
+// A command that fails with onFailure continue or skip-rest doesn't return an error, the task is
+// done and the failure is only in the status of the command
+func ProcessModule(task *globalstructs.Task, config *utils.WorkerConfig, status *globalstructs.WorkerStatus, id, workDir string, verbose, debug bool, writeLock *sync.Mutex) error {
+	// Define a context for the entire task, cancelled by CancelTask or the timeout
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 	if task.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(task.Timeout)*time.Second)
-	} else {
-		ctx, cancel = context.WithCancel(context.Background())
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(task.Timeout)*time.Second)
+		defer cancelTimeout()
 	}
-	defer cancel()
+	setCancelFunc(id, cancel)
+	defer setCancelFunc(id, nil)
+	grace := cancelGrace(task.CancelGraceSeconds)
 
 	// Channel to signal a timeout or completion
 	done := make(chan error, 1)
@@ -279,35 +357,78 @@ func ProcessModule(task *globalstructs.Task, config *utils.WorkerConfig, status
 	go func() {
 		// Start timer to measure the command execution time
 		startTime := time.Now()
-		for num, command := range task.Commands {
+		// Clear the results of a previous attempt, the commands after a failure are skipped
+		for num := range task.Commands {
+			resetCommand(&task.Commands[num])
+		}
+	commands:
+		for num := range task.Commands {
+			// A task cancelled before its commands started doesn't run any
+			if ctx.Err() != nil {
+				done <- context.Cause(ctx)
+				return
+			}
+			command := &task.Commands[num]
 			module := command.Module
 			arguments := command.Args
 
+			// The command is skipped if its condition on the previous commands is false
+			if command.RunIf != "" {
+				condition, err := globalstructs.ParseCondition(command.RunIf, num)
+				if err != nil {
+					command.Status = globalstructs.CommandFailed
+					command.Error = err.Error()
+					done <- fmt.Errorf("invalid runIf of command %d: %v", num, err)
+					return
+				}
+				if !condition.Eval(task.Commands) {
+					continue
+				}
+			}
+
 			// Check if the module exists in the worker configuration
-			commandAux, found := config.Modules[module]
+			moduleConfig, found := config.Modules[module]
 			if !found {
 				// Send an error if the module is not found
+				command.Status = globalstructs.CommandFailed
+				command.Error = "unknown module"
 				done <- fmt.Errorf("unknown command: %s", module)
 				return
 			}
 
 			if verbose {
-				log.Println("Modules commandAux: ", commandAux)
+				log.Println("Modules exec: ", moduleConfig.Exec)
 				log.Println("Modules arguments: ", arguments)
 			}
 
-			// Execute the module and get the output and any error
-			outputCommand, err := runModule(config, commandAux, arguments, status, id, verbose, debug)
+			// Execute the module and save its result in the command, the args
+			// and the stdin can use the results of the previous commands
+			results := commandResults(task.Commands)
+			startedAt := time.Now()
+			stdout, stderr, exitCode, err := runModule(ctx, config, moduleConfig, arguments, results.stdin(command.Stdin), results, task.Limits, status, id, workDir, num, grace, verbose, debug, writeLock)
+			finishedAt := time.Now()
+			command.StartedAt = startedAt.UTC().Format(time.RFC3339Nano)
+			command.FinishedAt = finishedAt.UTC().Format(time.RFC3339Nano)
+			command.DurationMs = finishedAt.Sub(startedAt).Milliseconds()
+			command.ExitCode = &exitCode
+			command.Stdout = strings.TrimRight(stdout, "\n")
+			command.Stderr = strings.TrimRight(stderr, "\n")
 			if err != nil {
-				// Save the text error in the task output to review
-				task.Commands[num].Output = outputCommand + ";" + err.Error()
+				command.Status, command.Error = commandError(ctx, task.Timeout, err)
+				// A cancelled or timed out task always stops
+				if ctx.Err() == nil {
+					switch command.OnFailure {
+					case globalstructs.OnFailureContinue:
+						continue
+					case globalstructs.OnFailureSkipRest:
+						break commands
+					}
+				}
 				// Send an error if there is an issue running the module
-				done <- fmt.Errorf("error running %s task: %v", commandAux, err)
+				done <- fmt.Errorf("error running %s task: %v", module, err)
 				return
 			}
-
-			// Store the output in the task struct for the current command
-			task.Commands[num].Output = outputCommand
+			command.Status = globalstructs.CommandDone
 		}
 		// Calculate and save the duration in seconds
 		duration := time.Since(startTime).Seconds()
@@ -317,21 +438,40 @@ func ProcessModule(task *globalstructs.Task, config *utils.WorkerConfig, status
 		done <- nil
 	}()
 
-	// Wait for the task to complete or timeout
-	select {
-	case err := <-done:
-		if err != nil {
-			return err
-		}
+	// Wait for the task to complete, if the context is done the running
+	// command is stopped so the goroutine always ends
+	err := <-done
+	if err == nil {
 		// Return nil if the task is processed successfully
 		return nil
-	case <-ctx.Done():
-		// Set a timeout error for all commands if the context times out
-		for i := range task.Commands {
-			task.Commands[i].Output = "Timeout error: task exceeded the time limit"
-		}
+	}
+	if errors.Is(context.Cause(ctx), ErrTaskCancelled) {
+		return ErrTaskCancelled
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		return fmt.Errorf("timeout processing task: exceeded %d seconds", task.Timeout)
 	}
+	return err
+}
+
+// resetCommand removes the result of a command, it is skipped unless it runs
+func resetCommand(command *globalstructs.Command) {
+	command.Status = globalstructs.CommandSkipped
+	command.ExitCode = nil
+	command.Output, command.Stdout, command.Stderr, command.Error = "", "", "", ""
+	command.OutputKey, command.OutputSize = "", 0
+	command.StartedAt, command.FinishedAt, command.DurationMs = "", "", 0
+}
+
+// commandError returns the status and the error of a command that failed
+func commandError(ctx context.Context, timeout int, err error) (string, string) {
+	if errors.Is(context.Cause(ctx), ErrTaskCancelled) {
+		return globalstructs.CommandCancelled, ErrTaskCancelled.Error()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return globalstructs.CommandFailed, fmt.Sprintf("timeout: task exceeded %d seconds", timeout)
+	}
+	return globalstructs.CommandFailed, err.Error()
 }
 
 func stringList(list []string, verbose, debug bool) string {
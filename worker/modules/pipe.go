@@ -0,0 +1,56 @@
+package modules
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+)
+
+// commandResults commands of the task with the results of the ones already executed,
+// used to replace the placeholders of the args and the stdin
+type commandResults []globalstructs.Command
+
+// expand replaces the {{commands[N].field}} placeholders of s with the results of the previous
+// commands, quoted for the shell if quote is true. The commands that didn't run are empty
+func (r commandResults) expand(s string, quote bool) string {
+	return globalstructs.ResultPlaceholderRegex.ReplaceAllStringFunc(s, func(placeholder string) string {
+		match := globalstructs.ResultPlaceholderRegex.FindStringSubmatch(placeholder)
+		num, _ := strconv.Atoi(match[1])
+		value := ""
+		if num < len(r) {
+			command := r[num]
+			switch match[2] {
+			case "output":
+				value = command.CombinedOutput()
+			case "stdout":
+				value = command.Stdout
+			case "stderr":
+				value = command.Stderr
+			case "exitCode":
+				if command.ExitCode != nil {
+					value = strconv.Itoa(*command.ExitCode)
+				}
+			}
+		}
+		if quote {
+			return shellQuote(value)
+		}
+		return value
+	})
+}
+
+// stdin returns the input of a command with the placeholders replaced, ending with a new line
+// like the output of the previous commands before it was trimmed
+func (r commandResults) stdin(stdin string) string {
+	stdin = r.expand(stdin, false)
+	if stdin != "" && !strings.HasSuffix(stdin, "\n") {
+		stdin += "\n"
+	}
+	return stdin
+}
+
+// shellQuote quotes s as a single argument for sh and bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package modules
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup runs the command in its own process group so the
+// children it spawns can be stopped with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcessGroup asks the process tree to stop
+func terminateProcessGroup(pid int) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(pid)).Run()
+}
+
+// killProcessGroup kills the process tree
+func killProcessGroup(pid int) error {
+	// taskkill fails if the tree is already gone
+	_ = exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(pid)).Run()
+	return nil
+}
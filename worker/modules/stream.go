@@ -0,0 +1,163 @@
+package modules
+
+import (
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/r4ulcl/nTask/globalstructs"
+	"github.com/r4ulcl/nTask/worker/managerrequest"
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+const (
+	// streamFlushInterval max time a chunk waits before being sent to the manager
+	streamFlushInterval = 1 * time.Second
+	// streamChunkSize max size of a chunk, far below globalstructs.MaxMessageSize
+	streamChunkSize = 64 << 10 // 64 KiB
+	// streamMaxBuffered max output waiting to be sent, the rest isn't streamed if the manager is slow
+	streamMaxBuffered = 16 * streamChunkSize
+)
+
+// outputStreamer is an io.Writer that sends the output of a running command
+// to the manager in taskOutput messages
+type outputStreamer struct {
+	mu        sync.Mutex
+	buf       []byte
+	dropped   int
+	config    *utils.WorkerConfig
+	writeLock *sync.Mutex
+	id        string
+	command   int
+	stream    string
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	verbose   bool
+	debug     bool
+}
+
+func newOutputStreamer(config *utils.WorkerConfig, id string, command int, stream string, verbose, debug bool, writeLock *sync.Mutex) *outputStreamer {
+	s := &outputStreamer{
+		config:    config,
+		writeLock: writeLock,
+		id:        id,
+		command:   command,
+		stream:    stream,
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		verbose:   verbose,
+		debug:     debug,
+	}
+	go s.loop()
+	return s
+}
+
+// Write buffers p and wakes up the streamer when there is a full chunk,
+// the command never waits for the manager
+func (s *outputStreamer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if room := streamMaxBuffered - len(s.buf); len(p) > room {
+		s.buf = append(s.buf, p[:room]...)
+		s.dropped += len(p) - room
+	} else {
+		s.buf = append(s.buf, p...)
+	}
+	full := len(s.buf) >= streamChunkSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Close sends the remaining output and stops the streamer
+func (s *outputStreamer) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *outputStreamer) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.full:
+			s.flush(streamChunkSize, false)
+		case <-ticker.C:
+			s.flush(0, false)
+		case <-s.stop:
+			s.flush(0, true)
+			return
+		}
+	}
+}
+
+// flush sends the buffered output in chunks of at least size bytes. The chunks end at
+// the end of a UTF-8 character unless last is set, when the whole output is sent
+func (s *outputStreamer) flush(size int, last bool) {
+	for {
+		s.mu.Lock()
+		if len(s.buf) == 0 || len(s.buf) < size {
+			s.mu.Unlock()
+			break
+		}
+		n := len(s.buf)
+		if n > streamChunkSize {
+			n = streamChunkSize
+		}
+		if !last || n < len(s.buf) {
+			n = utf8Cut(s.buf, n)
+		}
+		chunk := s.buf[:n]
+		s.buf = append([]byte(nil), s.buf[n:]...)
+		dropped := s.dropped
+		s.dropped = 0
+		s.mu.Unlock()
+
+		if dropped > 0 && (s.verbose || s.debug) {
+			log.Printf("Modules: %d bytes of the %s of task %s not streamed, the manager is slow", dropped, s.stream, s.id)
+		}
+		if n == 0 {
+			break
+		}
+		s.send(chunk)
+	}
+}
+
+// utf8Cut returns where to cut b before n so a character isn't split between two chunks
+func utf8Cut(b []byte, n int) int {
+	for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:n]) {
+				return n
+			}
+			return i
+		}
+	}
+	return n
+}
+
+// send the chunk to the manager, the output is not lost if it fails
+// because the whole output is sent in the callbackTask message
+func (s *outputStreamer) send(chunk []byte) {
+	if s.config.Conn == nil {
+		return
+	}
+	output := globalstructs.TaskOutput{
+		ID:      s.id,
+		Command: s.command,
+		Stream:  s.stream,
+		Data:    string(chunk),
+	}
+	if err := managerrequest.TaskOutputMessage(s.config, &output, s.verbose, s.debug, s.writeLock); err != nil && (s.verbose || s.debug) {
+		log.Println("Modules Error TaskOutputMessage:", err)
+	}
+}
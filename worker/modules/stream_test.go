@@ -0,0 +1,32 @@
+package modules
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUTF8Cut(t *testing.T) {
+	b := []byte("ab€ñ") // € has 3 bytes, ñ 2
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{2, 2},
+		{3, 2},
+		{4, 2},
+		{5, 5},
+		{6, 5},
+		{7, 7},
+	}
+	for _, tt := range tests {
+		got := utf8Cut(b, tt.n)
+		if got != tt.want || !utf8.Valid(b[:got]) {
+			t.Errorf("utf8Cut(%q, %d) = %d, want %d", b, tt.n, got, tt.want)
+		}
+	}
+
+	// invalid bytes are cut anywhere
+	if got := utf8Cut([]byte{0xff, 0xff, 0xff, 0xff, 0xff}, 4); got != 4 {
+		t.Errorf("utf8Cut of invalid bytes = %d, want 4", got)
+	}
+}
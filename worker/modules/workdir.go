@@ -0,0 +1,48 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/r4ulcl/nTask/worker/utils"
+)
+
+// WorkDirEnv environment variable with the working directory of the task
+const WorkDirEnv = "NTASK_WORKDIR"
+
+// CreateWorkDir creates the empty working directory of a task inside the workDir of the config,
+// the caller removes it with os.RemoveAll when the task ends
+func CreateWorkDir(config *utils.WorkerConfig, id string) (string, error) {
+	dir, err := os.MkdirTemp(config.WorkDir, "ntask-"+id+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create working directory: %w", err)
+	}
+	// Resolve the symlinks so the paths checked later compare with the real directory
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+	return resolved, nil
+}
+
+// resolvePath returns the path inside workDir for a relative path. Paths outside workDir,
+// absolute or with "..", are only allowed with allowOutsideWorkDir in the config
+func resolvePath(config *utils.WorkerConfig, workDir, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	path = filepath.Clean(path)
+	if !config.AllowOutsideWorkDir && !insideDir(workDir, path) {
+		return "", fmt.Errorf("path %s is outside the working directory of the task", path)
+	}
+	return path, nil
+}
+
+// insideDir returns true if path is dir or is inside it, both must be clean
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
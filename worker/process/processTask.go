@@ -1,7 +1,9 @@
 package process
 
 import (
+	"errors"
 	"log"
+	"os"
 	"sync"
 	"time"
 
@@ -11,11 +13,15 @@ import (
 	"github.com/r4ulcl/nTask/worker/utils"
 )
 
+// uploadTries times the big outputs and the artifacts of a task are uploaded before giving up
+const uploadTries = 5
+
 // Task is a helper function that processes the given task in the background.
 // It sets the worker status to indicate that it is currently working on the task.
 // It calls the ProcessModule function to execute the task's module.
-// If an error occurs, it sets the task status to "failed".
+// If an error occurs, it sets the task status to "failed", or "cancelled" if it was stopped by the manager.
 // Otherwise, it sets the task status to "done" and assigns the output of the module to the task.
+// The files matched by the artifacts of the task and the big outputs are uploaded to the manager.
 // Finally, it calls the CallbackTaskMessage function to send the task result to the configured callback endpoint.
 // After completing the task, it resets the worker status to indicate that it is no longer working.
 func Task(status *globalstructs.WorkerStatus, config *utils.WorkerConfig, task *globalstructs.Task, verbose, debug bool, writeLock *sync.Mutex) {
@@ -23,13 +29,24 @@ func Task(status *globalstructs.WorkerStatus, config *utils.WorkerConfig, task *
 		log.Println("Process Start processing task", task.ID, " defaultThreads: ", config.DefaultThreads, " lenWorkCount: ", len(status.WorkingIDs))
 	}
 
-	err := modules.ProcessFiles(task, config, status, task.ID, verbose, debug)
+	// Every task runs in its own empty directory, removed when the result is sent
+	workDir, err := modules.CreateWorkDir(config, task.ID)
+	if err == nil {
+		defer os.RemoveAll(workDir)
+		err = modules.ProcessFiles(task, config, status, task.ID, workDir, verbose, debug)
+	}
 	if err != nil {
 		log.Println("Process Error ProcessFiles:", err)
 		task.Status = "failed"
+		if modules.TaskCancelled(task.ID) {
+			task.Status = "cancelled"
+		}
 	} else {
-		err := modules.ProcessModule(task, config, status, task.ID, verbose, debug)
-		if err != nil {
+		err := modules.ProcessModule(task, config, status, task.ID, workDir, verbose, debug, writeLock)
+		if errors.Is(err, modules.ErrTaskCancelled) {
+			log.Println("Process task cancelled:", task.ID)
+			task.Status = "cancelled"
+		} else if err != nil {
 			log.Println("Process Error ProcessModule:", err)
 			task.Status = "failed"
 		} else {
@@ -37,20 +54,50 @@ func Task(status *globalstructs.WorkerStatus, config *utils.WorkerConfig, task *
 		}
 	}
 
-	if config.DeleteFiles {
-		err = modules.DeleteFiles(task, verbose, debug)
-		if err != nil {
-			log.Println("Process Error DeleteFiles:", err)
-		}
+	// The commands ended, a deleteTask received from now on fails
+	modules.UnregisterTask(task.ID)
+
+	// Files produced by the commands, sent to the manager with the result
+	if workDir != "" {
+		task.ArtifactFiles = modules.CollectArtifacts(task, config, workDir, verbose, debug)
 	}
 
-	// While manager doesnt responds loop
-	for {
-		err = managerrequest.CallbackTaskMessage(config, task, verbose, debug, writeLock)
-		if err == nil {
-			break
+	// The big outputs are uploaded to the result store before the callback
+	outputs := managerrequest.TakeLargeOutputs(config, task)
+
+	// While manager doesnt responds loop, the result is sent without the outputs and
+	// artifacts that the manager can't save after uploadTries
+	uploaded := false
+	for try := 1; ; try++ {
+		if !uploaded {
+			err = managerrequest.UploadOutputs(config, task, outputs, verbose, debug, writeLock)
+			if err == nil {
+				err = managerrequest.UploadArtifacts(config, task, verbose, debug, writeLock)
+			}
+			if err == nil {
+				uploaded = true
+			} else if try >= uploadTries {
+				log.Println("Process Error uploading the results of task", task.ID, "sending it without them:", err)
+				managerrequest.DropOutputs(task, outputs)
+				task.ArtifactFiles = nil
+				uploaded = true
+			}
+		}
+		if uploaded {
+			err = managerrequest.CallbackTaskMessage(config, task, verbose, debug, writeLock)
+			if err == nil {
+				break
+			}
 		}
 		time.Sleep(time.Second * 10)
 	}
 
+	// After the upload, an artifact can be one of the files of the task
+	if config.DeleteFiles && workDir != "" {
+		err = modules.DeleteFiles(task, config, workDir, verbose, debug)
+		if err != nil {
+			log.Println("Process Error DeleteFiles:", err)
+		}
+	}
+
 }
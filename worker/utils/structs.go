@@ -1,25 +1,63 @@
 package utils
 
 import (
+	"encoding/json"
 	"net/http"
 	"sync"
 
 	"github.com/gorilla/websocket"
+	"github.com/r4ulcl/nTask/globalstructs"
 )
 
 // WorkerConfig Worker Config file struct
 type WorkerConfig struct {
-	Name              string            `json:"name"`
-	DefaultThreads    int               `json:"defaultThreads"`
-	ManagerIP         string            `json:"managerIP"`
-	ManagerPort       int               `json:"managerPort"`
-	ManagerOauthToken string            `json:"managerOauthToken"`
-	DeleteFiles       bool              `json:"deleteFiles"`
-	CA                string            `json:"ca"`
-	InsecureModules   bool              `json:"insecureModules"`
-	Modules           map[string]string `json:"modules"`
-	ClientHTTP        *http.Client      `json:"clientHTTP"`
-	Conn              *websocket.Conn   `json:"Conn"`
+	Name                string            `json:"name"`
+	DefaultThreads      int               `json:"defaultThreads"`
+	ManagerIP           string            `json:"managerIP"`
+	ManagerPort         int               `json:"managerPort"`
+	ManagerOauthToken   string            `json:"managerOauthToken"`
+	DeleteFiles         bool              `json:"deleteFiles"`
+	CA                  string            `json:"ca"`
+	InsecureModules     bool              `json:"insecureModules"`
+	Modules             map[string]Module `json:"modules"`
+	Labels              map[string]string `json:"labels"`
+	OutputThreshold     int               `json:"outputThreshold"`     // bytes, bigger outputs are uploaded to the result store of the manager
+	WorkDir             string            `json:"workDir"`             // folder of the working directories of the tasks, the temp folder by default
+	AllowOutsideWorkDir bool              `json:"allowOutsideWorkDir"` // allow files and artifacts outside the working directory of the task
+	CgroupPath          string            `json:"cgroupPath"`          // delegated cgroup v2 folder to limit the memory of the commands
+	ClientHTTP          *http.Client      `json:"clientHTTP"`
+	Conn                *websocket.Conn   `json:"Conn"`
+}
+
+// Module command of a module, in the config file a string runs the command on the host
+// and an object with container runs it inside a container
+type Module struct {
+	Exec      string               `json:"exec"`
+	Container *Container           `json:"container,omitempty"`
+	Limits    globalstructs.Limits `json:"limits"` // max limits of the commands, the tasks can only lower them
+}
+
+// Container OCI container where the command of a module runs, with the working directory of the task mounted
+type Container struct {
+	Image     string   `json:"image"`
+	Runtime   string   `json:"runtime"`   // podman (default) or docker
+	Network   string   `json:"network"`   // none (default), bridge, host or a network of the runtime
+	Memory    string   `json:"memory"`    // max memory, e.g. 512m
+	CPUs      string   `json:"cpus"`      // max CPUs, e.g. 1.5
+	PidsLimit int      `json:"pidsLimit"` // max processes
+	User      string   `json:"user"`      // user of the command, the one of the image by default
+	Shell     bool     `json:"shell"`     // run the command with sh -c inside the container
+	ExtraArgs []string `json:"extraArgs"` // other options of the run command
+}
+
+// UnmarshalJSON accepts the command as a string for the modules on the host
+func (m *Module) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*m = Module{}
+		return json.Unmarshal(data, &m.Exec)
+	}
+	type module Module // without the UnmarshalJSON method
+	return json.Unmarshal(data, (*module)(m))
 }
 
 // Task Task struct
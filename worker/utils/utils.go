@@ -8,6 +8,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // CreateTLSClientWithCACert from cert.pem
@@ -31,6 +34,10 @@ func CreateTLSClientWithCACert(caCertPath string, verifyAltName, verbose, debug
 	return client, nil
 }
 
+// DefaultOutputThreshold outputs bigger than this are not sent in the callbackTask message,
+// the largest of the rest are not sent either while the message is bigger than globalstructs.MaxMessageSize
+const DefaultOutputThreshold = 128 << 10 // 128 KiB
+
 // LoadWorkerConfig funct to load worker config file
 func LoadWorkerConfig(filename string, verbose, debug bool) (*WorkerConfig, error) {
 	var config WorkerConfig
@@ -65,13 +72,29 @@ func LoadWorkerConfig(filename string, verbose, debug bool) (*WorkerConfig, erro
 		config.Name = hostname
 	}
 
+	if config.OutputThreshold <= 0 {
+		config.OutputThreshold = DefaultOutputThreshold
+	}
+
+	// The commands run in the working directory of each task
+	if err := absModulePaths(&config); err != nil {
+		return &config, err
+	}
+	if err := checkContainerModules(&config); err != nil {
+		return &config, err
+	}
+
 	// Print the values from the struct
 	if debug {
 		log.Println("Utils Name:", config.Name)
 		log.Println("Utils Tasks:")
 
-		for module, exec := range config.Modules {
-			log.Printf("  Module: %s, Exec: %s\n", module, exec)
+		for name, module := range config.Modules {
+			if module.Container != nil {
+				log.Printf("  Module: %s, Exec: %s, Image: %s\n", name, module.Exec, module.Container.Image)
+			} else {
+				log.Printf("  Module: %s, Exec: %s\n", name, module.Exec)
+			}
 		}
 	}
 
@@ -82,6 +105,58 @@ func LoadWorkerConfig(filename string, verbose, debug bool) (*WorkerConfig, erro
 	return &config, nil
 }
 
+// absModulePaths makes absolute the relative paths of the modules on the host, like ./worker/modules/nmapIPs.sh,
+// so they don't depend on the directory where the commands run
+func absModulePaths(config *WorkerConfig) error {
+	for name, module := range config.Modules {
+		if module.Container != nil {
+			continue
+		}
+		parts := strings.Split(module.Exec, " ")
+		for i, part := range parts {
+			if strings.HasPrefix(part, "./") || strings.HasPrefix(part, "../") {
+				abs, err := filepath.Abs(part)
+				if err != nil {
+					return err
+				}
+				parts[i] = abs
+			}
+		}
+		module.Exec = strings.Join(parts, " ")
+		config.Modules[name] = module
+	}
+	return nil
+}
+
+// checkContainerModules checks the modules that run in containers and sets the default runtime
+func checkContainerModules(config *WorkerConfig) error {
+	for name, module := range config.Modules {
+		if module.Container == nil {
+			continue
+		}
+		if module.Container.Image == "" {
+			return fmt.Errorf("module %s: the container needs an image", name)
+		}
+		if module.Container.Runtime == "" {
+			module.Container.Runtime = "podman"
+		}
+		if module.Container.Network == "" {
+			module.Container.Network = "none"
+		}
+	}
+	return nil
+}
+
+// ModuleNames returns the sorted names of the modules configured in the worker
+func ModuleNames(config *WorkerConfig) []string {
+	names := make([]string, 0, len(config.Modules))
+	for module := range config.Modules {
+		names = append(names, module)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // GenerateTLSConfig Function to generate the TLS config
 func GenerateTLSConfig(caCertPath string, verifyAltName, verbose, debug bool) (*tls.Config, error) {
 	var tlsConfig *tls.Config
@@ -1,19 +1,17 @@
 package websockets
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net"
-	"os/exec"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/r4ulcl/nTask/globalstructs"
 	"github.com/r4ulcl/nTask/worker/managerrequest"
+	"github.com/r4ulcl/nTask/worker/modules"
 	"github.com/r4ulcl/nTask/worker/process"
 	"github.com/r4ulcl/nTask/worker/utils"
 )
@@ -69,7 +67,9 @@ func GetMessage(config *utils.WorkerConfig, status *globalstructs.WorkerStatus,
 		case "addTask":
 			response, handlerErr = messageAddTask(config, status, msg, verbose, debug, writeLock)
 		case "deleteTask":
-			response, handlerErr = messageDeleteTask(status, msg, verbose, debug)
+			response, handlerErr = messageDeleteTask(msg, verbose, debug)
+		case "OK;resultChunk", "FAILED;resultChunk":
+			handlerErr = managerrequest.ResultChunkAnswer(msg)
 		default:
 			if debug {
 				log.Printf("Unhandled message type: %s", msg.Type)
@@ -193,6 +193,8 @@ func messageAddTask(config *utils.WorkerConfig, status *globalstructs.WorkerStat
 		if debug {
 			log.Println("WebSockets Task")
 		}
+		// Registered before the next message, a deleteTask that arrives before its commands start cancels them
+		modules.RegisterTask(requestTask.ID)
 		go process.Task(status, config, &requestTask, verbose, debug, writeLock)
 		response.Type = "OK;addTask"
 		response.JSON = msg.JSON
@@ -209,7 +211,7 @@ func messageAddTask(config *utils.WorkerConfig, status *globalstructs.WorkerStat
 	return response, nil
 }
 
-func messageDeleteTask(status *globalstructs.WorkerStatus, msg globalstructs.WebsocketMessage, verbose, debug bool) (globalstructs.WebsocketMessage, error) {
+func messageDeleteTask(msg globalstructs.WebsocketMessage, verbose, debug bool) (globalstructs.WebsocketMessage, error) {
 	response := globalstructs.WebsocketMessage{
 		Type: "",
 		JSON: "",
@@ -224,26 +226,12 @@ func messageDeleteTask(status *globalstructs.WorkerStatus, msg globalstructs.Web
 		return response, fmt.Errorf("WebSockets deleteTask Unmarshal error: %s", err.Error())
 	}
 
-	cmdID := status.WorkingIDs[requestTask.ID]
-
-	if cmdID < 0 {
-		log.Println("Invalid cmdID")
-		return response, fmt.Errorf("Invalid cmdID")
-	}
-	cmdIDString := strconv.Itoa(cmdID)
-
-	// Kill the process using cmdID
-	cmd := exec.Command("kill", "-9", cmdIDString)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	err = cmd.Run()
-
+	// Stop the process group of the task, the task is sent back as cancelled
+	// in its callbackTask when the command ends. It fails if the commands ended
+	err = modules.CancelTask(requestTask.ID)
 	if err != nil {
 		if debug {
-			log.Println("WebSockets Error killing process:", err)
-			log.Println("WebSockets Error details:", stderr.String())
+			log.Println("WebSockets Error cancelling task:", err)
 		}
 		response.Type = "FAILED;deleteTask"
 		response.JSON = msg.JSON
@@ -30,6 +30,7 @@ func StartWorker(swagger bool, configFile string, verifyAltName, verbose, debug
 		Name:         config.Name,
 		IddleThreads: config.DefaultThreads,
 		WorkingIDs:   make(map[string]int),
+		Modules:      utils.ModuleNames(config),
 	}
 
 	// Create a channel to receive signals for Ctrl+C